@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+	"lego-catalog/migrations"
+)
+
+const usage = `usage:
+  server                      start the API server (applies pending migrations)
+  server migrate up           apply all pending migrations
+  server migrate down [n]     roll back the last n migrations (default 1)
+  server migrate status       list migrations and whether they are applied
+  server backup <file>        write every set and image to a backup bundle
+  server restore [-strategy skip|overwrite] [-atomic] [-dry-run] <file>
+                              restore sets and images from a backup bundle
+  server images regenerate [-missing]
+                              regenerate the resized variants of every set image`
+
+// runCommand dispatches command line subcommands
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "backup":
+		return runBackupCommand(args[1:])
+	case "restore":
+		return runRestoreCommand(args[1:])
+	case "images":
+		return runImagesCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate subcommand\n%s", usage)
+	}
+
+	database, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	migrator, err := newMigrator(database)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", len(rolledBack))
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		return printMigrationStatus(statuses)
+
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q\n%s", args[0], usage)
+	}
+}
+
+func runBackupCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: server backup <file>")
+	}
+
+	database, err := openMigratedDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	repo := db.NewLegoSetRepository(database)
+	sets, err := repo.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		return fmt.Errorf("failed to load sets: %w", err)
+	}
+	images, err := repo.ListAllImages()
+	if err != nil {
+		return fmt.Errorf("failed to load images: %w", err)
+	}
+
+	// Write to a temporary file so an interrupted backup never replaces a
+	// good one
+	tmp := args[0] + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	backupService, err := newBackupService(repo)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	manifest, err := backupService.CreateBackup(sets, images, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, args[0]); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	fmt.Printf("Backed up %d set(s) and %d image(s) to %s\n", len(manifest.Catalog.Sets), len(manifest.Images), args[0])
+	for _, ref := range manifest.MissingImages {
+		fmt.Printf("Missing image for set %s: %s\n", ref.SetNumber, ref.Filename)
+	}
+	return nil
+}
+
+func runRestoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	strategy := flags.String("strategy", string(models.ImportStrategySkip), "how to handle sets that already exist: skip or overwrite")
+	atomic := flags.Bool("atomic", false, "roll back every set if any fails")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: server restore [-strategy skip|overwrite] [-atomic] [-dry-run] <file>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	database, err := openMigratedDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	backupService, err := newBackupService(db.NewLegoSetRepository(database))
+	if err != nil {
+		return err
+	}
+	result, err := backupService.RestoreBackup(file, info.Size(), services.ImportOptions{
+		Strategy: models.ImportStrategy(*strategy),
+		Atomic:   *atomic,
+		DryRun:   *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	sets := result.Sets
+	fmt.Printf("Sets: %d created, %d updated, %d skipped, %d failed\n", sets.Imported, sets.Updated, sets.Skipped, sets.Failed)
+	fmt.Printf("Images: %d restored, %d unchanged, %d kept\n", result.ImagesRestored, result.ImagesUnchanged, result.ImagesKept)
+	for _, row := range sets.Rows {
+		if row.Action == models.ImportActionError {
+			fmt.Printf("Set %s: %s\n", row.SetNumber, row.Reason)
+		}
+	}
+	for _, ref := range result.DanglingImages {
+		fmt.Printf("Dangling image for set %s: %s\n", ref.SetNumber, ref.Filename)
+	}
+	for _, filename := range result.UnreferencedImages {
+		fmt.Printf("Unreferenced image not restored: %s\n", filename)
+	}
+	for _, msg := range result.Errors {
+		fmt.Println(msg)
+	}
+
+	if sets.RolledBack {
+		return fmt.Errorf("restore rolled back, nothing was changed")
+	}
+	if *dryRun {
+		fmt.Println("Dry run, nothing was changed")
+	}
+	return nil
+}
+
+func runImagesCommand(args []string) error {
+	if len(args) == 0 || args[0] != "regenerate" {
+		return fmt.Errorf("usage: server images regenerate [-missing]")
+	}
+
+	flags := flag.NewFlagSet("images regenerate", flag.ContinueOnError)
+	missing := flags.Bool("missing", false, "only generate variants for images that have none")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	database, err := openMigratedDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	repo := db.NewLegoSetRepository(database)
+	sets, err := repo.GetAll(nil, "set_number", "ASC")
+	if err != nil {
+		return fmt.Errorf("failed to load sets: %w", err)
+	}
+
+	imageStorage, err := newImageStorage()
+	if err != nil {
+		return err
+	}
+	imageService := services.NewImageServiceWithStorage(imageStorage)
+	generated, skipped, failed := 0, 0, 0
+	for _, set := range sets {
+		images, err := repo.ListImages(set.ID)
+		if err != nil {
+			return fmt.Errorf("failed to load images of set %s: %w", set.SetNumber, err)
+		}
+
+		for _, image := range images {
+			if *missing && imageService.HasVariants(image.Filename) {
+				skipped++
+				continue
+			}
+			if err := imageService.GenerateVariants(image.Filename); err != nil {
+				fmt.Printf("Set %s: %v\n", set.SetNumber, err)
+				failed++
+				continue
+			}
+			generated++
+		}
+	}
+
+	fmt.Printf("Images: %d regenerated, %d skipped, %d failed\n", generated, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d image(s) failed", failed)
+	}
+	return nil
+}
+
+// newBackupService creates a backup service over repo and the configured
+// image storage
+func newBackupService(repo db.LegoSetStore) (*services.BackupService, error) {
+	imageStorage, err := newImageStorage()
+	if err != nil {
+		return nil, err
+	}
+	imageService := services.NewImageServiceWithStorage(imageStorage)
+	importService := services.NewImportService(repo, services.NewCSVService())
+	return services.NewBackupService(imageService, importService), nil
+}
+
+// newImageStorage creates the image storage selected by IMAGE_STORAGE:
+// UPLOAD_DIR on local disk (the default) or an S3-compatible bucket
+func newImageStorage() (services.ImageStorage, error) {
+	switch storage := getEnv("IMAGE_STORAGE", "local"); storage {
+	case "local":
+		uploadDir := getEnv("UPLOAD_DIR", "./images")
+		if err := os.MkdirAll(uploadDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create image storage directory: %w", err)
+		}
+		return services.NewFileImageStorage(uploadDir), nil
+
+	case "s3":
+		pathStyle, err := strconv.ParseBool(getEnv("S3_PATH_STYLE", strconv.FormatBool(os.Getenv("S3_ENDPOINT") != "")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PATH_STYLE: %w", err)
+		}
+		proxy, err := strconv.ParseBool(getEnv("S3_PROXY", "false"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PROXY: %w", err)
+		}
+		expiry, err := time.ParseDuration(getEnv("S3_PRESIGN_EXPIRY", "15m"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PRESIGN_EXPIRY: %w", err)
+		}
+		cacheTTL, err := time.ParseDuration(getEnv("S3_CACHE_TTL", "1m"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_CACHE_TTL: %w", err)
+		}
+		if cacheTTL == 0 {
+			cacheTTL = -1
+		}
+
+		s3, err := services.NewS3ImageStorage(services.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+			Proxy:           proxy,
+			PresignExpiry:   expiry,
+			CacheTTL:        cacheTTL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s3, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported IMAGE_STORAGE %q (expected local or s3)", storage)
+	}
+}
+
+// openDatabase connects to the configured database
+func openDatabase() (*db.Database, error) {
+	if err := db.InitDatabase(); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	database, err := db.NewDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return database, nil
+}
+
+// openMigratedDatabase connects to the configured database and applies
+// pending migrations
+func openMigratedDatabase() (*db.Database, error) {
+	database, err := openDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(database)
+	if err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	return database, nil
+}
+
+func printMigrationStatus(statuses []db.MigrationStatus) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, status := range statuses {
+		state := "pending"
+		appliedAt := ""
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if status.Modified {
+			state = "modified"
+		}
+		if status.Missing {
+			state = "missing"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+
+	return w.Flush()
+}
+
+// newMigrator creates a migrator for the embedded migrations of the
+// database's dialect, or for MIGRATIONS_DIR when it is set
+func newMigrator(database *db.Database) (*db.Migrator, error) {
+	if dir := os.Getenv("MIGRATIONS_DIR"); dir != "" {
+		return db.NewMigrator(database, os.DirFS(dir))
+	}
+
+	fsys, err := migrations.ForDialect(database.Dialect.Name())
+	if err != nil {
+		return nil, err
+	}
+	return db.NewMigrator(database, fsys)
+}
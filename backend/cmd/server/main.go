@@ -1,22 +1,29 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
+	"context"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 
 	"lego-catalog/internal/api/handlers"
 	"lego-catalog/internal/db"
 	"lego-catalog/internal/services"
+	"lego-catalog/internal/web"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize database
 	if err := db.InitDatabase(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -30,23 +37,38 @@ func main() {
 	defer database.Close()
 
 	// Run migrations
-	if err := runMigrations(database); err != nil {
+	migrator, err := newMigrator(database)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	log.Println("Migrations completed successfully")
 
-	// Create image storage directory
-	uploadDir := getEnv("UPLOAD_DIR", "./images")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Fatalf("Failed to create image storage directory: %v", err)
+	// Set up image storage
+	imageStorage, err := newImageStorage()
+	if err != nil {
+		log.Fatalf("Failed to set up image storage: %v", err)
 	}
 
 	// Initialize services
 	legoSetRepo := db.NewLegoSetRepository(database)
-	imageService := services.NewImageService(uploadDir)
+	imageService := services.NewImageServiceWithStorage(imageStorage)
 	csvService := services.NewCSVService()
+	importService := services.NewImportService(legoSetRepo, csvService)
+	jobManager := services.NewJobManager(importService, 2)
+	backupService := services.NewBackupService(imageService, importService)
+	reportService := services.NewReportService(imageService)
+	bulkImageService := services.NewBulkImageService(legoSetRepo, imageService)
 
 	// Initialize handlers
 	legoSetHandler := handlers.NewLegoSetHandler(legoSetRepo, imageService, csvService)
+	jobHandler := handlers.NewJobHandler(jobManager)
+	backupHandler := handlers.NewBackupHandler(legoSetRepo, backupService)
+	reportHandler := handlers.NewReportHandler(legoSetRepo, reportService)
+	imageHandler := handlers.NewImageHandler(bulkImageService)
+	setImageHandler := handlers.NewSetImageHandler(legoSetRepo, imageService)
 
 	// Setup router
 	router := mux.NewRouter()
@@ -56,17 +78,42 @@ func main() {
 	api.HandleFunc("/lego-sets", legoSetHandler.GetAllLegoSets).Methods("GET")
 	api.HandleFunc("/lego-sets", legoSetHandler.CreateLegoSet).Methods("POST")
 	api.HandleFunc("/lego-sets/search", legoSetHandler.SearchLegoSets).Methods("GET")
-	api.HandleFunc("/lego-sets/export", legoSetHandler.ExportCSV).Methods("GET")
-	api.HandleFunc("/lego-sets/import", legoSetHandler.ImportCSV).Methods("POST")
+	api.HandleFunc("/lego-sets/export", legoSetHandler.Export).Methods("GET")
+	api.HandleFunc("/lego-sets/import", legoSetHandler.Import).Methods("POST")
 	api.HandleFunc("/lego-sets/{id}", legoSetHandler.GetLegoSet).Methods("GET")
 	api.HandleFunc("/lego-sets/{id}", legoSetHandler.UpdateLegoSet).Methods("PUT")
 	api.HandleFunc("/lego-sets/{id}", legoSetHandler.DeleteLegoSet).Methods("DELETE")
 	api.HandleFunc("/lego-sets/{id}/image", legoSetHandler.UploadImage).Methods("POST")
+	api.HandleFunc("/lego-sets/{id}/images", setImageHandler.ListImages).Methods("GET")
+	api.HandleFunc("/lego-sets/{id}/images", setImageHandler.AddImage).Methods("POST")
+	api.HandleFunc("/lego-sets/{id}/images/order", setImageHandler.ReorderImages).Methods("PUT")
+	api.HandleFunc("/lego-sets/{id}/images/{imageId}", setImageHandler.UpdateImage).Methods("PATCH")
+	api.HandleFunc("/lego-sets/{id}/images/{imageId}", setImageHandler.DeleteImage).Methods("DELETE")
+	api.HandleFunc("/lego-sets/{id}/images/{imageId}/primary", setImageHandler.SetPrimaryImage).Methods("POST")
 	api.HandleFunc("/series", legoSetHandler.GetAllSeries).Methods("GET")
 	api.HandleFunc("/statistics", legoSetHandler.GetStatistics).Methods("GET")
-
-	// Serve images
-	router.PathPrefix("/images/").Handler(http.StripPrefix("/images/", http.FileServer(http.Dir(uploadDir))))
+	api.HandleFunc("/jobs", jobHandler.ListJobs).Methods("GET")
+	api.HandleFunc("/jobs/import", jobHandler.CreateImportJob).Methods("POST")
+	api.HandleFunc("/jobs/{id}", jobHandler.GetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}/cancel", jobHandler.CancelJob).Methods("POST")
+	api.HandleFunc("/backup", backupHandler.CreateBackup).Methods("GET")
+	api.HandleFunc("/backup/restore", backupHandler.RestoreBackup).Methods("POST")
+	api.HandleFunc("/reports/insurance", reportHandler.InsuranceReport).Methods("GET")
+	api.HandleFunc("/images/bulk", imageHandler.BulkUpload).Methods("POST")
+
+	// Serve images, from disk or by way of the bucket
+	router.PathPrefix("/images/").Handler(http.StripPrefix("/images/", imageStorage))
+
+	// Serve the frontend, preferring FRONTEND_DIR over the embedded build
+	var frontend fs.FS = web.DistFS()
+	if dir := os.Getenv("FRONTEND_DIR"); dir != "" {
+		frontend = os.DirFS(dir)
+	}
+	if web.HasIndex(frontend) {
+		router.PathPrefix("/").Handler(web.NewSPAHandler(frontend))
+	} else {
+		log.Println("Frontend build not found; serving API only")
+	}
 
 	// CORS configuration
 	c := cors.New(cors.Options{
@@ -74,7 +121,7 @@ func main() {
 			// Allow localhost and any IP address for development (WSL support)
 			return true
 		},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Authorization"},
 		AllowCredentials: true,
 	})
@@ -87,35 +134,6 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, handler))
 }
 
-func runMigrations(database *db.Database) error {
-	migrationsDir := "./migrations"
-
-	files, err := ioutil.ReadDir(migrationsDir)
-	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
-	}
-
-	for _, file := range files {
-		if filepath.Ext(file.Name()) != ".sql" {
-			continue
-		}
-
-		log.Printf("Running migration: %s", file.Name())
-
-		content, err := ioutil.ReadFile(filepath.Join(migrationsDir, file.Name()))
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", file.Name(), err)
-		}
-
-		if _, err := database.Exec(string(content)); err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", file.Name(), err)
-		}
-	}
-
-	log.Println("Migrations completed successfully")
-	return nil
-}
-
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/services"
+)
+
+// maxBackupUploadSize caps uploaded backup bundles (4GB)
+const maxBackupUploadSize = 4 << 30
+
+// BackupHandler handles HTTP requests for backup bundles
+type BackupHandler struct {
+	repo          db.LegoSetStore
+	backupService *services.BackupService
+}
+
+// NewBackupHandler creates a new handler
+func NewBackupHandler(repo db.LegoSetStore, backupService *services.BackupService) *BackupHandler {
+	return &BackupHandler{
+		repo:          repo,
+		backupService: backupService,
+	}
+}
+
+// CreateBackup handles GET /api/backup
+func (h *BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	sets, err := h.repo.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	images, err := h.repo.ListAllImages()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	filename := fmt.Sprintf("lego-catalog-backup-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+
+	// The archive is streamed, so a failure part way through can only be logged
+	if _, err := h.backupService.CreateBackup(sets, images, w); err != nil {
+		log.Printf("Failed to write backup: %v", err)
+	}
+}
+
+// RestoreBackup handles POST /api/backup/restore. The bundle is sent as the
+// request body or as a multipart "backup" field.
+func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		body, err = multipartFile(r, "backup")
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Backup file is required")
+			return
+		}
+	}
+
+	// Reading a zip needs random access, so stage the upload on disk first
+	file, err := os.CreateTemp("", "lego-restore-*.zip")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store upload")
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := io.Copy(file, io.LimitReader(body, maxBackupUploadSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read upload")
+		return
+	}
+	if size > maxBackupUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Backup file is too large")
+		return
+	}
+
+	result, err := h.backupService.RestoreBackup(file, size, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to restore backup: %v", err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to restore backup")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// multipartFile returns the first part of a streamed multipart form with the
+// given field name
+func multipartFile(r *http.Request, field string) (io.Reader, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field {
+			return part, nil
+		}
+		part.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// exportFlushRows is how many rows a streamed export writes between flushes
+const exportFlushRows = 500
+
+// Trailers reporting how an export ended. X-Export-Status is "complete" or
+// "incomplete"; X-Export-Error says why an export is incomplete.
+const (
+	exportStatusTrailer = "X-Export-Status"
+	exportRowsTrailer   = "X-Export-Rows"
+	exportErrorTrailer  = "X-Export-Error"
+)
+
+// exportStream is the body of an export download. The status and headers
+// are only sent with the first bytes written, so a failure before then can
+// still get a normal error response. Once the download has started, how it
+// ended is reported in trailers instead.
+type exportStream struct {
+	w           http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+func newExportStream(w http.ResponseWriter, contentType, filename string) *exportStream {
+	return &exportStream{w: w, contentType: contentType, filename: filename}
+}
+
+func (s *exportStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	header := s.w.Header()
+	header.Set("Content-Type", s.contentType)
+	header.Set("Content-Disposition", "attachment; filename="+s.filename)
+	header.Add("Trailer", exportStatusTrailer)
+	header.Add("Trailer", exportRowsTrailer)
+	header.Add("Trailer", exportErrorTrailer)
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// Write sends the headers if they haven't been sent, then writes p
+func (s *exportStream) Write(p []byte) (int, error) {
+	s.start()
+	return s.w.Write(p)
+}
+
+// Flush sends anything buffered by the server to the client
+func (s *exportStream) Flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish reports how an export of rows rows ended. An error before anything
+// was sent gets an error response with message. A later one is logged,
+// marked at the end of the body with abort when it isn't nil, and reported
+// in the trailers. Nothing more is sent once the client has gone away.
+func (s *exportStream) finish(r *http.Request, rows int, err error, message string, abort func(reason string) error) {
+	if err == nil {
+		s.start()
+		s.w.Header().Set(exportStatusTrailer, "complete")
+		s.w.Header().Set(exportRowsTrailer, strconv.Itoa(rows))
+		return
+	}
+
+	gone := r.Context().Err() != nil
+	if !s.started {
+		if !gone {
+			respondWithError(s.w, http.StatusInternalServerError, message)
+		}
+		return
+	}
+
+	log.Printf("Export of %s failed after %d rows: %v", s.filename, rows, err)
+	reason := fmt.Sprintf("export failed after %d rows", rows)
+	if abort != nil && !gone {
+		if err := abort(reason); err != nil {
+			log.Printf("Failed to mark %s as incomplete: %v", s.filename, err)
+		}
+	}
+	s.w.Header().Set(exportStatusTrailer, "incomplete")
+	s.w.Header().Set(exportRowsTrailer, strconv.Itoa(rows))
+	s.w.Header().Set(exportErrorTrailer, reason)
+}
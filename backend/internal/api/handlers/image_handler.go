@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"lego-catalog/internal/services"
+)
+
+// maxBulkImageUploadSize caps zip archives sent to BulkUpload (1GB)
+const maxBulkImageUploadSize = 1 << 30
+
+// ImageHandler handles HTTP requests for set images
+type ImageHandler struct {
+	bulkImageService *services.BulkImageService
+}
+
+// NewImageHandler creates a new handler
+func NewImageHandler(bulkImageService *services.BulkImageService) *ImageHandler {
+	return &ImageHandler{bulkImageService: bulkImageService}
+}
+
+// BulkUpload handles POST /api/images/bulk. The zip archive is sent as the
+// request body or as a multipart "zip" field; ?dryRun=true reports what
+// would be matched without storing anything, and ?replace=true lets files
+// replace sets' primary images.
+func (h *ImageHandler) BulkUpload(w http.ResponseWriter, r *http.Request) {
+	var opts services.BulkImageOptions
+	opts.DryRun, _ = strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	opts.Replace, _ = strconv.ParseBool(r.URL.Query().Get("replace"))
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		var err error
+		body, err = multipartFile(r, "zip")
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Zip file is required")
+			return
+		}
+	}
+
+	// Reading a zip needs random access, so stage the upload on disk first
+	file, err := os.CreateTemp("", "lego-images-*.zip")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to store upload")
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := io.Copy(file, io.LimitReader(body, maxBulkImageUploadSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read upload")
+		return
+	}
+	if size > maxBulkImageUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Zip file is too large")
+		return
+	}
+
+	result, err := h.bulkImageService.ImportZip(file, size, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to read zip: %v", err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to upload images")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"lego-catalog/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// maxJobUploadSize caps files uploaded for background imports (1GB)
+const maxJobUploadSize = 1 << 30
+
+// JobHandler handles HTTP requests for background jobs
+type JobHandler struct {
+	jobs *services.JobManager
+}
+
+// NewJobHandler creates a new handler
+func NewJobHandler(jobs *services.JobManager) *JobHandler {
+	return &JobHandler{jobs: jobs}
+}
+
+// CreateImportJob handles POST /api/jobs/import
+func (h *JobHandler) CreateImportJob(w http.ResponseWriter, r *http.Request) {
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+	if opts.CSV.Dialect, err = csvDialectFromQuery(r); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid CSV dialect: %v", err))
+		return
+	}
+
+	// Stream the upload to disk instead of buffering it with ParseMultipartForm
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return
+	}
+
+	var path, filename string
+	var size int64
+	submitted := false
+	defer func() {
+		if path != "" && !submitted {
+			os.Remove(path)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+			return
+		}
+
+		switch part.FormName() {
+		case "csv":
+			if path != "" {
+				respondWithError(w, http.StatusBadRequest, "Only one CSV file may be uploaded")
+				return
+			}
+			filename = part.FileName()
+			path, size, err = h.jobs.StageUpload(part, maxJobUploadSize)
+			if errors.Is(err, services.ErrUploadTooLarge) {
+				respondWithError(w, http.StatusRequestEntityTooLarge, "CSV file is too large")
+				return
+			}
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Failed to store upload")
+				return
+			}
+		case "mapping":
+			data, err := io.ReadAll(io.LimitReader(part, 1<<20))
+			if err != nil || json.Unmarshal(data, &opts.CSV.ColumnMapping) != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid column mapping")
+				return
+			}
+		}
+		part.Close()
+	}
+
+	if path == "" {
+		respondWithError(w, http.StatusBadRequest, "CSV file is required")
+		return
+	}
+
+	job, err := h.jobs.SubmitImport(path, filename, size, opts)
+	if errors.Is(err, services.ErrJobQueueFull) {
+		respondWithError(w, http.StatusServiceUnavailable, "Too many imports are queued, try again later")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to start import")
+		return
+	}
+	submitted = true
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// ListJobs handles GET /api/jobs
+func (h *JobHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, h.jobs.List())
+}
+
+// GetJob handles GET /api/jobs/{id}
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// CancelJob handles POST /api/jobs/{id}/cancel
+func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Cancel(mux.Vars(r)["id"])
+	if errors.Is(err, services.ErrJobNotFound) {
+		respondWithError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if errors.Is(err, services.ErrJobFinished) {
+		respondWithError(w, http.StatusConflict, "Job already finished")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel job")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"lego-catalog/internal/db"
 	"lego-catalog/internal/models"
@@ -14,19 +18,32 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// maxJSONImportSize caps JSON catalogs sent to ImportJSON (100MB)
+const maxJSONImportSize = 100 << 20
+
 // LegoSetHandler handles HTTP requests for Lego sets
 type LegoSetHandler struct {
-	repo         *db.LegoSetRepository
-	imageService *services.ImageService
-	csvService   *services.CSVService
+	repo               db.LegoSetStore
+	imageService       *services.ImageService
+	csvService         *services.CSVService
+	importService      *services.ImportService
+	jsonService        *services.JSONService
+	rebrickableService *services.RebrickableService
+	brickLinkService   *services.BrickLinkService
+	xlsxService        *services.XLSXService
 }
 
 // NewLegoSetHandler creates a new handler
-func NewLegoSetHandler(repo *db.LegoSetRepository, imageService *services.ImageService, csvService *services.CSVService) *LegoSetHandler {
+func NewLegoSetHandler(repo db.LegoSetStore, imageService *services.ImageService, csvService *services.CSVService) *LegoSetHandler {
 	return &LegoSetHandler{
-		repo:         repo,
-		imageService: imageService,
-		csvService:   csvService,
+		repo:               repo,
+		imageService:       imageService,
+		csvService:         csvService,
+		importService:      services.NewImportService(repo, csvService),
+		jsonService:        services.NewJSONService(),
+		rebrickableService: services.NewRebrickableService(),
+		brickLinkService:   services.NewBrickLinkService(),
+		xlsxService:        services.NewXLSXService(),
 	}
 }
 
@@ -56,36 +73,19 @@ func (h *LegoSetHandler) CreateLegoSet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert request to model
-	set := &models.LegoSet{
-		SetNumber:          req.SetNumber,
-		AlternateSetNumber: req.AlternateSetNumber,
-		Title:              req.Title,
-		Owned:              req.Owned,
-		QuantityOwned:      req.QuantityOwned,
-		ReleaseYear:        req.ReleaseYear,
-		Description:        req.Description,
-		Series:             req.Series,
-		NumParts:           req.NumParts,
-		NumMinifigs:        req.NumMinifigs,
-		BricklinkURL:       req.BricklinkURL,
-		ApproximateValue:   req.ApproximateValue,
-		Notes:              req.Notes,
-	}
-
-	// Parse value last updated date
-	if req.ValueLastUpdated != nil && *req.ValueLastUpdated != "" {
-		t, err := time.Parse("2006-01-02", *req.ValueLastUpdated)
-		if err == nil {
-			set.ValueLastUpdated = &t
-		}
-	}
+	set := req.ToLegoSet()
 
 	// Create the set
 	if err := h.repo.Create(set); err != nil {
+		if errors.Is(err, db.ErrDuplicateSetNumber) {
+			respondWithError(w, http.StatusConflict, "Set number already exists")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to create set")
 		return
 	}
 
+	h.imageService.AttachImageURLs(set)
 	respondWithJSON(w, http.StatusCreated, set)
 }
 
@@ -105,33 +105,51 @@ func (h *LegoSetHandler) GetLegoSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.imageService.AttachImageURLs(set)
 	respondWithJSON(w, http.StatusOK, set)
 }
 
 // GetAllLegoSets handles GET /api/lego-sets
 func (h *LegoSetHandler) GetAllLegoSets(w http.ResponseWriter, r *http.Request) {
+	filters, sortBy, sortOrder := legoSetQuery(r)
+
+	sets, err := h.repo.GetAll(filters, sortBy, sortOrder)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	h.imageService.AttachImageURLs(sets...)
+	respondWithJSON(w, http.StatusOK, sets)
+}
+
+// legoSetQuery reads the ?series=, ?owned= and ?q= filters and the ?sortBy=
+// and ?sortOrder= sort shared by the set list and CSV export. Searches are
+// sorted by title unless a sort is given, as SearchLegoSets sorts them.
+func legoSetQuery(r *http.Request) (map[string]interface{}, string, string) {
+	query := r.URL.Query()
 	filters := make(map[string]interface{})
 
-	// Parse query parameters
-	if series := r.URL.Query().Get("series"); series != "" {
+	if series := query.Get("series"); series != "" {
 		filters["series"] = series
 	}
 
-	if ownedStr := r.URL.Query().Get("owned"); ownedStr != "" {
+	if ownedStr := query.Get("owned"); ownedStr != "" {
 		owned, _ := strconv.ParseBool(ownedStr)
 		filters["owned"] = owned
 	}
 
-	sortBy := r.URL.Query().Get("sortBy")
-	sortOrder := r.URL.Query().Get("sortOrder")
+	sortBy := query.Get("sortBy")
+	sortOrder := query.Get("sortOrder")
 
-	sets, err := h.repo.GetAll(filters, sortBy, sortOrder)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error")
-		return
+	if search := query.Get("q"); search != "" {
+		filters["search"] = search
+		if sortBy == "" {
+			sortBy, sortOrder = "title", "ASC"
+		}
 	}
 
-	respondWithJSON(w, http.StatusOK, sets)
+	return filters, sortBy, sortOrder
 }
 
 // SearchLegoSets handles GET /api/lego-sets/search
@@ -148,6 +166,7 @@ func (h *LegoSetHandler) SearchLegoSets(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	h.imageService.AttachImageURLs(sets...)
 	respondWithJSON(w, http.StatusOK, sets)
 }
 
@@ -221,6 +240,9 @@ func (h *LegoSetHandler) UpdateLegoSet(w http.ResponseWriter, r *http.Request) {
 	if req.BricklinkURL != nil {
 		updates["bricklink_url"] = *req.BricklinkURL
 	}
+	if req.RebrickableURL != nil {
+		updates["rebrickable_url"] = *req.RebrickableURL
+	}
 	if req.ApproximateValue != nil {
 		updates["approximate_value"] = *req.ApproximateValue
 	}
@@ -232,12 +254,19 @@ func (h *LegoSetHandler) UpdateLegoSet(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	if req.ConditionDescription != nil {
+		updates["condition_description"] = *req.ConditionDescription
+	}
 	if req.Notes != nil {
 		updates["notes"] = *req.Notes
 	}
 
 	// Update the set
 	if err := h.repo.Update(id, updates); err != nil {
+		if errors.Is(err, db.ErrDuplicateSetNumber) {
+			respondWithError(w, http.StatusConflict, "Set number already exists")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to update set")
 		return
 	}
@@ -249,6 +278,7 @@ func (h *LegoSetHandler) UpdateLegoSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.imageService.AttachImageURLs(updatedSet)
 	respondWithJSON(w, http.StatusOK, updatedSet)
 }
 
@@ -268,17 +298,26 @@ func (h *LegoSetHandler) DeleteLegoSet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete image if exists
-	if set.ImageFilename != nil {
-		h.imageService.DeleteImage(*set.ImageFilename)
+	images, err := h.repo.ListImages(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
 	}
 
-	// Delete the set
+	// Delete the set, which deletes its images
 	if err := h.repo.Delete(id); err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to delete set")
 		return
 	}
 
+	// Then delete the image files
+	if set.ImageFilename != nil {
+		h.imageService.DeleteImage(*set.ImageFilename)
+	}
+	for _, image := range images {
+		h.imageService.DeleteImage(image.Filename)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -311,15 +350,10 @@ func (h *LegoSetHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Delete old image if exists
-	if set.ImageFilename != nil {
-		h.imageService.DeleteImage(*set.ImageFilename)
-	}
-
 	// Save new image
 	filename, err := h.imageService.SaveImage(file, header, id, set.SetNumber)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save image: %v", err))
+		respondWithImageError(w, err)
 		return
 	}
 
@@ -332,7 +366,30 @@ func (h *LegoSetHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"imageFilename": filename})
+	// Delete the old image once the new one is in place. It has the same
+	// name, and was overwritten, unless the extension changed.
+	if set.ImageFilename != nil && *set.ImageFilename != filename {
+		h.imageService.DeleteImage(*set.ImageFilename)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"imageFilename": filename,
+		"imageUrls":     h.imageService.ImageURLs(filename),
+	})
+}
+
+// respondWithImageError reports why an uploaded image couldn't be saved
+func respondWithImageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnsupportedImage):
+		respondWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("Unsupported image: %v", err))
+	case errors.Is(err, services.ErrImageTooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Image too large: %v", err))
+	case errors.Is(err, services.ErrInvalidImage):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image: %v", err))
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Failed to save image")
+	}
 }
 
 // GetStatistics handles GET /api/statistics
@@ -343,27 +400,114 @@ func (h *LegoSetHandler) GetStatistics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.imageService.AttachImageURLs(stats.MostExpensiveSet, stats.LargestSet, stats.OldestSet, stats.NewestSet)
 	respondWithJSON(w, http.StatusOK, stats)
 }
 
-// ExportCSV handles GET /api/lego-sets/export
+// csvExportParams are the export parameters only the CSV export reads. The
+// other formats always export the whole catalog, so they reject them rather
+// than silently export more than was asked for.
+var csvExportParams = []string{
+	"series", "owned", "q", "sortBy", "sortOrder", "fields",
+	"dialect", "delimiter", "decimal", "dateFormat", "bom",
+}
+
+// Export handles GET /api/lego-sets/export, in the format given by ?format=
+func (h *LegoSetHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "csv" {
+		for _, param := range csvExportParams {
+			if r.URL.Query().Has(param) {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("The %s parameter is only supported by CSV exports", param))
+				return
+			}
+		}
+	}
+
+	switch format {
+	case "", "csv":
+		h.ExportCSV(w, r)
+	case "json":
+		h.ExportJSON(w, r)
+	case "xlsx":
+		h.ExportXLSX(w, r)
+	case "bricklink":
+		h.ExportBrickLink(w, r)
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unsupported export format")
+	}
+}
+
+// Import handles POST /api/lego-sets/import, in the format given by ?format=
+func (h *LegoSetHandler) Import(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		format = "json"
+	}
+
+	switch format {
+	case "", "csv":
+		h.ImportCSV(w, r)
+	case "json":
+		h.ImportJSON(w, r)
+	case "rebrickable":
+		h.ImportRebrickable(w, r)
+	case "bricklink":
+		h.ImportBrickLink(w, r)
+	case "brickset":
+		h.ImportBrickset(w, r)
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unsupported import format")
+	}
+}
+
+// ExportCSV writes sets as CSV. It takes the same filter, search and sort
+// parameters as GetAllLegoSets, ?fields= to choose and order the columns,
+// and the dialect parameters read by csvDialectFromQuery. Rows are streamed
+// from the database and flushed as they go; see exportStream for how
+// failures part way through are reported.
 func (h *LegoSetHandler) ExportCSV(w http.ResponseWriter, r *http.Request) {
-	sets, err := h.repo.GetAll(nil, "", "")
+	fields, err := services.ParseCSVFields(r.URL.Query().Get("fields"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error")
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid fields: %v", err))
+		return
+	}
+	dialect, err := csvDialectFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid CSV dialect: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", "attachment; filename=lego_sets.csv")
-
-	if err := h.csvService.ExportToCSV(sets, w); err != nil {
+	filters, sortBy, sortOrder := legoSetQuery(r)
+	stream := newExportStream(w, "text/csv", "lego_sets.csv")
+	exporter, err := h.csvService.NewExporter(stream, services.CSVExportOptions{Fields: fields, Dialect: dialect})
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to export CSV")
 		return
 	}
+
+	rows := 0
+	err = h.repo.EachSet(r.Context(), filters, sortBy, sortOrder, func(set *models.LegoSet) error {
+		if err := exporter.Write(set); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushRows == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			stream.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = exporter.Close()
+	}
+
+	stream.finish(r, rows, err, "Failed to export CSV", exporter.Abort)
 }
 
-// ImportCSV handles POST /api/lego-sets/import
+// ImportCSV imports sets from an uploaded CSV file
 func (h *LegoSetHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	// Parse multipart form (max 10MB)
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
@@ -378,73 +522,291 @@ func (h *LegoSetHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Parse CSV
-	sets, err := h.csvService.ImportFromCSV(file)
+	opts, err := importOptionsFromQuery(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse CSV: %v", err))
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+	if opts.CSV.Dialect, err = csvDialectFromQuery(r); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid CSV dialect: %v", err))
 		return
 	}
 
-	// Import each set
-	imported := 0
-	skipped := 0
-	errors := []string{}
+	// Optional column mapping, as a JSON object of CSV header to field
+	if mapping := r.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.CSV.ColumnMapping); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid column mapping")
+			return
+		}
+	}
 
-	for _, setReq := range sets {
-		// Check if set already exists
-		existing, err := h.repo.GetBySetNumber(setReq.SetNumber)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("Error checking set %s: %v", setReq.SetNumber, err))
-			continue
+	result, err := h.importService.ImportCSV(file, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse CSV: %v", err))
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to import CSV")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ImportBrickset imports a Brickset collection export sent as a "csv" field
+func (h *LegoSetHandler) ImportBrickset(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return
+	}
+
+	file, _, err := r.FormFile("csv")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "CSV file is required")
+		return
+	}
+	defer file.Close()
 
-		if existing != nil {
-			skipped++
-			continue
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+
+	result, err := h.importService.ImportBrickset(file, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse Brickset CSV: %v", err))
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to import Brickset CSV")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ExportXLSX writes every set as an Excel workbook, with statistics and a
+// per-series summary on their own sheets
+func (h *LegoSetHandler) ExportXLSX(w http.ResponseWriter, r *http.Request) {
+	sets, err := h.repo.GetAll(nil, "", "")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	stats, err := h.repo.GetStatistics()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	stream := newExportStream(w, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "lego_sets.xlsx")
+	err = h.xlsxService.ExportToXLSX(sets, stats, stream)
+	stream.finish(r, len(sets), err, "Failed to export XLSX", nil)
+}
+
+// ExportJSON writes the whole catalog, including IDs, timestamps and every
+// set's images, as JSON
+func (h *LegoSetHandler) ExportJSON(w http.ResponseWriter, r *http.Request) {
+	sets, err := h.repo.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	images, err := h.repo.ListAllImages()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	stream := newExportStream(w, "application/json", "lego_sets.json")
+	err = h.jsonService.ExportToJSON(sets, images, stream)
+	stream.finish(r, len(sets), err, "Failed to export JSON", nil)
+}
 
-		// Convert request to model
-		set := &models.LegoSet{
-			SetNumber:          setReq.SetNumber,
-			AlternateSetNumber: setReq.AlternateSetNumber,
-			Title:              setReq.Title,
-			Owned:              setReq.Owned,
-			QuantityOwned:      setReq.QuantityOwned,
-			ReleaseYear:        setReq.ReleaseYear,
-			Description:        setReq.Description,
-			Series:             setReq.Series,
-			NumParts:           setReq.NumParts,
-			NumMinifigs:        setReq.NumMinifigs,
-			BricklinkURL:       setReq.BricklinkURL,
-			ApproximateValue:   setReq.ApproximateValue,
-			Notes:              setReq.Notes,
+// ImportJSON restores sets from a JSON catalog, sent as the request body or
+// as a multipart "file" field
+func (h *LegoSetHandler) ImportJSON(w http.ResponseWriter, r *http.Request) {
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxJSONImportSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+			return
 		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "JSON file is required")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
 
-		// Parse value last updated date
-		if setReq.ValueLastUpdated != nil && *setReq.ValueLastUpdated != "" {
-			t, err := time.Parse("2006-01-02", *setReq.ValueLastUpdated)
-			if err == nil {
-				set.ValueLastUpdated = &t
-			}
+	result, err := h.importService.ImportJSON(body, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse JSON: %v", err))
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to import JSON")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ImportRebrickable imports a Rebrickable set list ("setlist" field) with
+// metadata from a sets.csv dump ("sets") and optional themes.csv ("themes").
+// With only a dump, it fills in metadata for the sets already in the catalog.
+func (h *LegoSetHandler) ImportRebrickable(w http.ResponseWriter, r *http.Request) {
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+
+	// The public sets.csv dump is a few MB, so allow more than for CSV
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return
+	}
 
-		if err := h.repo.Create(set); err != nil {
-			errors = append(errors, fmt.Sprintf("Error importing set %s: %v", setReq.SetNumber, err))
-			continue
+	catalog, err := h.rebrickableCatalogFromForm(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse Rebrickable dump: %v", err))
+		return
+	}
+
+	var result *models.ImportResult
+	setList, _, err := r.FormFile("setlist")
+	switch {
+	case err == nil:
+		defer setList.Close()
+		result, err = h.importService.ImportRebrickable(setList, catalog, opts)
+	case catalog != nil:
+		result, err = h.importService.EnrichFromRebrickable(catalog, opts)
+	default:
+		respondWithError(w, http.StatusBadRequest, "A Rebrickable set list or sets dump is required")
+		return
+	}
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse Rebrickable set list: %v", err))
+			return
 		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to import from Rebrickable")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// rebrickableCatalogFromForm loads the Rebrickable dump sent in the parsed
+// multipart form's "sets" and optional "themes" fields, or returns nil if
+// there is none
+func (h *LegoSetHandler) rebrickableCatalogFromForm(r *http.Request) (*services.RebrickableCatalog, error) {
+	setsFile, _, err := r.FormFile("sets")
+	if err != nil {
+		return nil, nil
+	}
+	defer setsFile.Close()
+
+	var themes io.Reader
+	if themesFile, _, err := r.FormFile("themes"); err == nil {
+		defer themesFile.Close()
+		themes = themesFile
+	}
+
+	return h.rebrickableService.LoadCatalog(setsFile, themes)
+}
 
-		imported++
+// ExportBrickLink writes the owned sets as a BrickLink XML inventory, or
+// with ?list=wanted the sets not owned as a wanted list
+func (h *LegoSetHandler) ExportBrickLink(w http.ResponseWriter, r *http.Request) {
+	list, ok := brickLinkListFromQuery(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid BrickLink list")
+		return
+	}
+
+	sets, err := h.repo.GetAll(nil, "set_number", "ASC")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	stream := newExportStream(w, "application/xml", fmt.Sprintf("bricklink_%s.xml", list))
+	err = h.brickLinkService.ExportToXML(sets, list, stream)
+	stream.finish(r, len(sets), err, "Failed to export BrickLink XML", nil)
+}
+
+// ImportBrickLink imports a BrickLink XML inventory, or with ?list=wanted a
+// wanted list, sent as an "xml" field. Titles come from an optional
+// Rebrickable dump in the "sets" and "themes" fields.
+func (h *LegoSetHandler) ImportBrickLink(w http.ResponseWriter, r *http.Request) {
+	list, ok := brickLinkListFromQuery(r)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Invalid BrickLink list")
+		return
+	}
+
+	opts, err := importOptionsFromQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid import strategy")
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return
+	}
+
+	file, _, err := r.FormFile("xml")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "XML file is required")
+		return
+	}
+	defer file.Close()
+
+	catalog, err := h.rebrickableCatalogFromForm(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse Rebrickable dump: %v", err))
+		return
 	}
 
-	result := map[string]interface{}{
-		"imported": imported,
-		"skipped":  skipped,
-		"errors":   errors,
+	result, err := h.importService.ImportBrickLink(file, list, catalog, opts)
+	if err != nil {
+		var fileErr *services.ImportFileError
+		if errors.As(err, &fileErr) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse XML: %v", err))
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Failed to import BrickLink XML")
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, result)
 }
 
+// brickLinkListFromQuery reads ?list=, defaulting to the inventory
+func brickLinkListFromQuery(r *http.Request) (services.BrickLinkList, bool) {
+	list := services.BrickLinkList(r.URL.Query().Get("list"))
+	if list == "" {
+		list = services.BrickLinkInventory
+	}
+	return list, list.Valid()
+}
+
 // GetAllSeries handles GET /api/series
 func (h *LegoSetHandler) GetAllSeries(w http.ResponseWriter, r *http.Request) {
 	series, err := h.repo.GetAllSeries()
@@ -457,6 +819,67 @@ func (h *LegoSetHandler) GetAllSeries(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper functions
+func importOptionsFromQuery(r *http.Request) (services.ImportOptions, error) {
+	query := r.URL.Query()
+	opts := services.ImportOptions{}
+
+	opts.DryRun, _ = strconv.ParseBool(query.Get("dryRun"))
+
+	// Atomic imports apply every row or none
+	opts.Atomic, _ = strconv.ParseBool(query.Get("atomic"))
+
+	// Strategy for sets that already exist: skip (default), overwrite or merge
+	opts.Strategy = models.ImportStrategy(query.Get("strategy"))
+	if opts.Strategy != "" && !opts.Strategy.Valid() {
+		return opts, fmt.Errorf("invalid import strategy %q", opts.Strategy)
+	}
+
+	return opts, nil
+}
+
+// csvDialectFromQuery reads a CSV dialect from ?dialect=default|excel-eu,
+// with ?delimiter= (a character, or "tab"), ?decimal=, ?dateFormat= and
+// ?bom= overriding parts of it
+func csvDialectFromQuery(r *http.Request) (services.CSVDialect, error) {
+	query := r.URL.Query()
+
+	var dialect services.CSVDialect
+	if name := query.Get("dialect"); name != "" {
+		var ok bool
+		if dialect, ok = services.CSVDialectByName(name); !ok {
+			return dialect, fmt.Errorf("unknown dialect %q", name)
+		}
+	}
+
+	if value := query.Get("delimiter"); value != "" {
+		if strings.EqualFold(value, "tab") {
+			value = "\t"
+		}
+		if utf8.RuneCountInString(value) != 1 {
+			return dialect, fmt.Errorf("invalid delimiter %q", value)
+		}
+		dialect.Delimiter, _ = utf8.DecodeRuneInString(value)
+	}
+	if value := query.Get("decimal"); value != "" {
+		if utf8.RuneCountInString(value) != 1 {
+			return dialect, fmt.Errorf("invalid decimal separator %q", value)
+		}
+		dialect.DecimalSeparator, _ = utf8.DecodeRuneInString(value)
+	}
+	if value := query.Get("dateFormat"); value != "" {
+		dialect.DateFormat = value
+	}
+	if value := query.Get("bom"); value != "" {
+		bom, err := strconv.ParseBool(value)
+		if err != nil {
+			return dialect, fmt.Errorf("invalid bom %q", value)
+		}
+		dialect.BOM = bom
+	}
+
+	return dialect, dialect.Validate()
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
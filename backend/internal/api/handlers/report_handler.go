@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/services"
+)
+
+// ReportHandler handles HTTP requests for printable reports
+type ReportHandler struct {
+	repo          db.LegoSetStore
+	reportService *services.ReportService
+}
+
+// NewReportHandler creates a new handler
+func NewReportHandler(repo db.LegoSetStore, reportService *services.ReportService) *ReportHandler {
+	return &ReportHandler{
+		repo:          repo,
+		reportService: reportService,
+	}
+}
+
+// InsuranceReport handles GET /api/reports/insurance, writing a PDF of the
+// collection. It lists owned sets unless ?ownedOnly=false, and groups them
+// by series with ?groupBy=series. ?preparedBy= names who signs the summary
+// page and ?date=YYYY-MM-DD dates it, defaulting to today.
+func (h *ReportHandler) InsuranceReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := services.ReportOptions{
+		OwnedOnly:  true,
+		PreparedBy: query.Get("preparedBy"),
+	}
+
+	if value := query.Get("ownedOnly"); value != "" {
+		ownedOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid ownedOnly")
+			return
+		}
+		opts.OwnedOnly = ownedOnly
+	}
+
+	switch query.Get("groupBy") {
+	case "":
+	case "series":
+		opts.GroupBySeries = true
+	default:
+		respondWithError(w, http.StatusBadRequest, "Unsupported groupBy")
+		return
+	}
+
+	if value := query.Get("date"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		opts.Date = date
+	}
+
+	var filters map[string]interface{}
+	if opts.OwnedOnly {
+		filters = map[string]interface{}{"owned": true}
+	}
+	sets, err := h.repo.GetAll(filters, "set_number", "ASC")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	stats, err := h.repo.GetStatistics()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	stream := newExportStream(w, "application/pdf", "lego_insurance_report.pdf")
+	err = h.reportService.GenerateReport(sets, stats, opts, stream)
+	stream.finish(r, len(sets), err, "Failed to generate report", nil)
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImageCaptionLength is the longest caption a set image can have
+const maxImageCaptionLength = 500
+
+// SetImageHandler handles HTTP requests for the images of a set
+type SetImageHandler struct {
+	repo         db.LegoSetStore
+	imageService *services.ImageService
+}
+
+// NewSetImageHandler creates a new handler
+func NewSetImageHandler(repo db.LegoSetStore, imageService *services.ImageService) *SetImageHandler {
+	return &SetImageHandler{
+		repo:         repo,
+		imageService: imageService,
+	}
+}
+
+// setImageRequest is the body of UpdateImage. Fields left out are kept and
+// empty strings clear them.
+type setImageRequest struct {
+	Caption *string `json:"caption"`
+	Kind    *string `json:"kind"`
+}
+
+// imageOrderRequest is the body of ReorderImages
+type imageOrderRequest struct {
+	ImageIDs []string `json:"imageIds"`
+}
+
+// ListImages handles GET /api/lego-sets/{id}/images
+func (h *SetImageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	if h.findSet(w, r) == nil {
+		return
+	}
+	h.respondWithImages(w, mux.Vars(r)["id"])
+}
+
+// AddImage handles POST /api/lego-sets/{id}/images. The multipart form has
+// the "image" file and optional "caption" and "kind" fields.
+func (h *SetImageHandler) AddImage(w http.ResponseWriter, r *http.Request) {
+	set := h.findSet(w, r)
+	if set == nil {
+		return
+	}
+
+	// Parse multipart form (max 10MB)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return
+	}
+
+	image := &models.SetImage{SetID: set.ID}
+	var err error
+	if image.Caption, image.Kind, err = setImageFields(r.FormValue("caption"), r.FormValue("kind")); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image details: %v", err))
+		return
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Image file is required")
+		return
+	}
+	defer file.Close()
+
+	image.Filename, err = h.imageService.SaveSetImage(file, header, set.ID, set.SetNumber)
+	if err != nil {
+		respondWithImageError(w, err)
+		return
+	}
+
+	if err := h.repo.AddImage(image); err != nil {
+		h.imageService.DeleteImage(image.Filename)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add image")
+		return
+	}
+
+	image.URLs = h.imageService.ImageURLs(image.Filename)
+	respondWithJSON(w, http.StatusCreated, image)
+}
+
+// UpdateImage handles PATCH /api/lego-sets/{id}/images/{imageId}
+func (h *SetImageHandler) UpdateImage(w http.ResponseWriter, r *http.Request) {
+	image := h.findImage(w, r)
+	if image == nil {
+		return
+	}
+
+	var req setImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var caption, kind string
+	if image.Caption != nil {
+		caption = *image.Caption
+	}
+	if image.Kind != nil {
+		kind = *image.Kind
+	}
+	if req.Caption != nil {
+		caption = *req.Caption
+	}
+	if req.Kind != nil {
+		kind = *req.Kind
+	}
+	var err error
+	if image.Caption, image.Kind, err = setImageFields(caption, kind); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image details: %v", err))
+		return
+	}
+
+	if err := h.repo.UpdateImage(image); err != nil {
+		h.respondWithStoreError(w, err, "Failed to update image")
+		return
+	}
+
+	image.URLs = h.imageService.ImageURLs(image.Filename)
+	respondWithJSON(w, http.StatusOK, image)
+}
+
+// ReorderImages handles PUT /api/lego-sets/{id}/images/order. The body lists
+// every image ID of the set in the new order.
+func (h *SetImageHandler) ReorderImages(w http.ResponseWriter, r *http.Request) {
+	set := h.findSet(w, r)
+	if set == nil {
+		return
+	}
+
+	var req imageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.repo.ReorderImages(set.ID, req.ImageIDs); err != nil {
+		h.respondWithStoreError(w, err, "Failed to reorder images")
+		return
+	}
+	h.respondWithImages(w, set.ID)
+}
+
+// SetPrimaryImage handles POST /api/lego-sets/{id}/images/{imageId}/primary
+func (h *SetImageHandler) SetPrimaryImage(w http.ResponseWriter, r *http.Request) {
+	image := h.findImage(w, r)
+	if image == nil {
+		return
+	}
+
+	if err := h.repo.SetPrimaryImage(image.SetID, image.ID); err != nil {
+		h.respondWithStoreError(w, err, "Failed to set primary image")
+		return
+	}
+	h.respondWithImages(w, image.SetID)
+}
+
+// DeleteImage handles DELETE /api/lego-sets/{id}/images/{imageId}. If it
+// was the primary image, the next image takes its place.
+func (h *SetImageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	image := h.findImage(w, r)
+	if image == nil {
+		return
+	}
+
+	if err := h.repo.DeleteImage(image.SetID, image.ID); err != nil {
+		h.respondWithStoreError(w, err, "Failed to delete image")
+		return
+	}
+	h.imageService.DeleteImage(image.Filename)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findSet looks up the set in the URL, responding with an error and
+// returning nil if there is none
+func (h *SetImageHandler) findSet(w http.ResponseWriter, r *http.Request) *models.LegoSet {
+	set, err := h.repo.GetByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if set == nil {
+		respondWithError(w, http.StatusNotFound, "Set not found")
+		return nil
+	}
+	return set
+}
+
+// findImage looks up the set image in the URL, responding with an error
+// and returning nil if there is none
+func (h *SetImageHandler) findImage(w http.ResponseWriter, r *http.Request) *models.SetImage {
+	vars := mux.Vars(r)
+	image, err := h.repo.GetImage(vars["id"], vars["imageId"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if image == nil {
+		respondWithError(w, http.StatusNotFound, "Image not found")
+		return nil
+	}
+	return image
+}
+
+// respondWithImages responds with a set's images and their URLs
+func (h *SetImageHandler) respondWithImages(w http.ResponseWriter, setID string) {
+	images, err := h.repo.ListImages(setID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	for _, image := range images {
+		image.URLs = h.imageService.ImageURLs(image.Filename)
+	}
+	respondWithJSON(w, http.StatusOK, images)
+}
+
+// respondWithStoreError maps the store's image errors onto statuses
+func (h *SetImageHandler) respondWithStoreError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, db.ErrImageNotFound):
+		respondWithError(w, http.StatusNotFound, "Image not found")
+	case errors.Is(err, db.ErrInvalidImageOrder):
+		respondWithError(w, http.StatusBadRequest, "Image order must list each of the set's images once")
+	default:
+		respondWithError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// setImageFields checks an image's caption and kind, returning nil for
+// empty values
+func setImageFields(caption, kind string) (*string, *string, error) {
+	caption = strings.TrimSpace(caption)
+	kind = strings.TrimSpace(kind)
+
+	if utf8.RuneCountInString(caption) > maxImageCaptionLength {
+		return nil, nil, fmt.Errorf("caption is longer than %d characters", maxImageCaptionLength)
+	}
+	if kind != "" && !models.SetImageKinds[kind] {
+		kinds := make([]string, 0, len(models.SetImageKinds))
+		for k := range models.SetImageKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return nil, nil, fmt.Errorf("unknown kind %q (expected one of %s)", kind, strings.Join(kinds, ", "))
+	}
+
+	var captionPtr, kindPtr *string
+	if caption != "" {
+		captionPtr = &caption
+	}
+	if kind != "" {
+		kindPtr = &kind
+	}
+	return captionPtr, kindPtr, nil
+}
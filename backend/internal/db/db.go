@@ -1,69 +1,125 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 // Database wraps the SQL database connection
 type Database struct {
 	*sql.DB
+	Dialect Dialect
 }
 
-// NewDatabase creates a new database connection
+// NewDatabase creates a new connection to the database selected by DB_DRIVER
 func NewDatabase() (*Database, error) {
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "3306")
-	dbName := getEnv("DB_NAME", "lego_catalog")
+	dialect, err := DialectFromEnv()
+	if err != nil {
+		return nil, err
+	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+	return Open(dialect)
+}
 
-	db, err := sql.Open("mysql", dsn)
+// Open connects to the database described by dialect
+func Open(dialect Dialect) (*Database, error) {
+	db, err := sql.Open(dialect.DriverName(), dialect.DSN())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Database connection established successfully")
+	log.Printf("Database connection established successfully (%s)", dialect.Name())
 
-	return &Database{db}, nil
+	return &Database{DB: db, Dialect: dialect}, nil
 }
 
-// InitDatabase creates the database if it doesn't exist
-func InitDatabase() error {
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "3306")
-	dbName := getEnv("DB_NAME", "lego_catalog")
-
-	// Connect without specifying a database
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/", dbUser, dbPassword, dbHost, dbPort)
-	db, err := sql.Open("mysql", dsn)
+// Exec executes a query written with ? placeholders
+func (d *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.DB.Exec(d.Dialect.Rebind(query), args...)
+}
+
+// Query runs a query written with ? placeholders
+func (d *Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.Query(d.Dialect.Rebind(query), args...)
+}
+
+// QueryContext runs a query written with ? placeholders that is cancelled
+// with ctx
+func (d *Database) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.QueryContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+// QueryRow runs a single-row query written with ? placeholders
+func (d *Database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRow(d.Dialect.Rebind(query), args...)
+}
+
+// Begin starts a transaction whose queries are rebound like Database's
+func (d *Database) Begin() (*Tx, error) {
+	tx, err := d.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer db.Close()
+	return &Tx{Tx: tx, dialect: d.Dialect}, nil
+}
 
-	// Create database if it doesn't exist
-	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", dbName))
+// Tx wraps a SQL transaction
+type Tx struct {
+	*sql.Tx
+	dialect Dialect
+}
+
+// Exec executes a query written with ? placeholders
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.Rebind(query), args...)
+}
+
+// Query runs a query written with ? placeholders
+func (t *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.Rebind(query), args...)
+}
+
+// QueryContext runs a query written with ? placeholders that is cancelled
+// with ctx
+func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.dialect.Rebind(query), args...)
+}
+
+// QueryRow runs a single-row query written with ? placeholders
+func (t *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.Rebind(query), args...)
+}
+
+// querier is implemented by Database and Tx so repositories can run the same
+// queries inside and outside of a transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// InitDatabase creates the database if it doesn't exist
+func InitDatabase() error {
+	dialect, err := DialectFromEnv()
 	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+		return err
 	}
 
-	log.Printf("Database '%s' initialized successfully", dbName)
-	return nil
+	return dialect.CreateDatabase()
 }
 
 func getEnv(key, defaultValue string) string {
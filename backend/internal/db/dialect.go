@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect captures what differs between the supported SQL databases
+type Dialect interface {
+	// Name identifies the dialect and selects its migrations directory
+	Name() string
+	// DriverName is the database/sql driver to open
+	DriverName() string
+	// DSN is the connection string for the catalog database
+	DSN() string
+	// CreateDatabase creates the catalog database if it doesn't exist
+	CreateDatabase() error
+	// Rebind rewrites ? placeholders into the dialect's placeholder syntax
+	Rebind(query string) string
+	// LikeOperator is the case-insensitive pattern match operator
+	LikeOperator() string
+	// NullsOrder returns the clause appended to ORDER BY ... ASC|DESC so
+	// NULLs sort the same way on every dialect
+	NullsOrder(order string) string
+	// TableExists reports whether a table exists in the catalog database
+	TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error)
+	// AcquireLock takes a named session lock on conn, waiting up to timeout
+	AcquireLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error
+	// ReleaseLock releases a lock taken with AcquireLock
+	ReleaseLock(ctx context.Context, conn *sql.Conn, name string) error
+	// IsUniqueViolation reports whether err is a unique constraint failure
+	IsUniqueViolation(err error) bool
+}
+
+// DialectFromEnv selects the dialect named by DB_DRIVER (default mysql)
+func DialectFromEnv() (Dialect, error) {
+	switch driver := getEnv("DB_DRIVER", "mysql"); driver {
+	case "mysql":
+		return newMySQLDialectFromEnv(), nil
+	case "sqlite", "sqlite3":
+		return NewSQLiteDialect(getEnv("DB_PATH", "./lego_catalog.db")), nil
+	case "postgres", "postgresql":
+		return newPostgresDialectFromEnv(), nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q (expected mysql, sqlite or postgres)", driver)
+	}
+}
+
+// rebindNumbered rewrites ? placeholders outside of string literals into
+// $1, $2, ... placeholders
+func rebindNumbered(query string) string {
+	var out strings.Builder
+	out.Grow(len(query) + 16)
+
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		out.WriteByte(c)
+	}
+
+	return out.String()
+}
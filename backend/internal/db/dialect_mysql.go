@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlDialect connects to a MySQL server
+type mysqlDialect struct {
+	user     string
+	password string
+	host     string
+	port     string
+	name     string
+}
+
+func newMySQLDialectFromEnv() *mysqlDialect {
+	return &mysqlDialect{
+		user:     getEnv("DB_USER", "root"),
+		password: getEnv("DB_PASSWORD", ""),
+		host:     getEnv("DB_HOST", "localhost"),
+		port:     getEnv("DB_PORT", "3306"),
+		name:     getEnv("DB_NAME", "lego_catalog"),
+	}
+}
+
+func (d *mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (d *mysqlDialect) DriverName() string {
+	return "mysql"
+}
+
+func (d *mysqlDialect) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&charset=utf8mb4",
+		d.user, d.password, d.host, d.port, d.name)
+}
+
+func (d *mysqlDialect) CreateDatabase() error {
+	// Connect without specifying a database
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/", d.user, d.password, d.host, d.port)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer db.Close()
+
+	// Create database if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci", d.name))
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	log.Printf("Database '%s' initialized successfully", d.name)
+	return nil
+}
+
+func (d *mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (d *mysqlDialect) LikeOperator() string {
+	return "LIKE"
+}
+
+func (d *mysqlDialect) NullsOrder(order string) string {
+	return ""
+}
+
+func (d *mysqlDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = ?
+	`, table).Scan(&count)
+	return count > 0, err
+}
+
+func (d *mysqlDialect) AcquireLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout/time.Second)).Scan(&acquired); err != nil {
+		return err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return fmt.Errorf("lock %s is held by another session", name)
+	}
+	return nil
+}
+
+func (d *mysqlDialect) ReleaseLock(ctx context.Context, conn *sql.Conn, name string) error {
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+	return err
+}
+
+func (d *mysqlDialect) IsUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresDialect connects to a PostgreSQL server
+type postgresDialect struct {
+	user     string
+	password string
+	host     string
+	port     string
+	name     string
+	sslMode  string
+}
+
+func newPostgresDialectFromEnv() *postgresDialect {
+	return &postgresDialect{
+		user:     getEnv("DB_USER", "postgres"),
+		password: getEnv("DB_PASSWORD", ""),
+		host:     getEnv("DB_HOST", "localhost"),
+		port:     getEnv("DB_PORT", "5432"),
+		name:     getEnv("DB_NAME", "lego_catalog"),
+		sslMode:  getEnv("DB_SSLMODE", "disable"),
+	}
+}
+
+func (d *postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (d *postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (d *postgresDialect) DSN() string {
+	return d.dsnFor(d.name)
+}
+
+func (d *postgresDialect) dsnFor(database string) string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(d.user, d.password),
+		Host:     d.host + ":" + d.port,
+		Path:     "/" + database,
+		RawQuery: url.Values{"sslmode": {d.sslMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+func (d *postgresDialect) CreateDatabase() error {
+	// Connect to the maintenance database; PostgreSQL has no
+	// CREATE DATABASE IF NOT EXISTS
+	db, err := sql.Open("postgres", d.dsnFor("postgres"))
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", d.name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check for database: %w", err)
+	}
+
+	if !exists {
+		_, err = db.Exec(fmt.Sprintf("CREATE DATABASE %s ENCODING 'UTF8'", pq.QuoteIdentifier(d.name)))
+		if err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+	}
+
+	log.Printf("Database '%s' initialized successfully", d.name)
+	return nil
+}
+
+func (d *postgresDialect) Rebind(query string) string {
+	return rebindNumbered(query)
+}
+
+func (d *postgresDialect) LikeOperator() string {
+	return "ILIKE"
+}
+
+// NullsOrder makes NULLs sort first ascending and last descending, which is
+// MySQL's behaviour and the reverse of PostgreSQL's default
+func (d *postgresDialect) NullsOrder(order string) string {
+	if order == "DESC" {
+		return " NULLS LAST"
+	}
+	return " NULLS FIRST"
+}
+
+func (d *postgresDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var exists bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name = $1
+		)
+	`, table).Scan(&exists)
+	return exists, err
+}
+
+// AcquireLock polls for a session-level advisory lock until timeout
+func (d *postgresDialect) AcquireLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockKey(name)).Scan(&acquired); err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("lock %s is held by another session", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (d *postgresDialect) ReleaseLock(ctx context.Context, conn *sql.Conn, name string) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryLockKey(name))
+	return err
+}
+
+func (d *postgresDialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// advisoryLockKey maps a lock name onto PostgreSQL's bigint lock keys
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDialect stores the catalog in a single SQLite file using a pure-Go
+// driver, so no database server or cgo toolchain is required
+type sqliteDialect struct {
+	path string
+}
+
+// NewSQLiteDialect creates a dialect for the SQLite database file at path
+func NewSQLiteDialect(path string) Dialect {
+	return &sqliteDialect{path: path}
+}
+
+func (d *sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (d *sqliteDialect) DriverName() string {
+	return "sqlite"
+}
+
+func (d *sqliteDialect) DSN() string {
+	// Store times in a format the driver parses back into time.Time, wait
+	// on locks instead of failing immediately and enforce foreign keys
+	return fmt.Sprintf("file:%s?_time_format=sqlite&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)", d.path)
+}
+
+func (d *sqliteDialect) CreateDatabase() error {
+	// The database file is created on first connect; only its directory
+	// has to exist
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	log.Printf("Database '%s' initialized successfully", d.path)
+	return nil
+}
+
+func (d *sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (d *sqliteDialect) LikeOperator() string {
+	return "LIKE"
+}
+
+func (d *sqliteDialect) NullsOrder(order string) string {
+	return ""
+}
+
+func (d *sqliteDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table,
+	).Scan(&count)
+	return count > 0, err
+}
+
+// AcquireLock is a no-op: SQLite serialises writers itself, and because its
+// DDL is transactional the schema_migrations primary key stops a second
+// process from applying the same migration twice
+func (d *sqliteDialect) AcquireLock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) error {
+	return nil
+}
+
+func (d *sqliteDialect) ReleaseLock(ctx context.Context, conn *sql.Conn, name string) error {
+	return nil
+}
+
+func (d *sqliteDialect) IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
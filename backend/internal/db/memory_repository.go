@@ -0,0 +1,609 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// MemoryLegoSetRepository is an in-memory LegoSetStore with the same
+// semantics as LegoSetRepository. It is intended for tests.
+type MemoryLegoSetRepository struct {
+	mu   sync.RWMutex
+	sets map[string]*models.LegoSet
+	// images holds set images by image ID
+	images map[string]*models.SetImage
+}
+
+// NewMemoryLegoSetRepository creates an empty in-memory repository
+func NewMemoryLegoSetRepository() *MemoryLegoSetRepository {
+	return &MemoryLegoSetRepository{
+		sets:   map[string]*models.LegoSet{},
+		images: map[string]*models.SetImage{},
+	}
+}
+
+// Create inserts a new Lego set
+func (r *MemoryLegoSetRepository) Create(set *models.LegoSet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.findBySetNumber(set.SetNumber) != nil {
+		return ErrDuplicateSetNumber
+	}
+
+	set.ID = uuid.New().String()
+	set.CreatedAt = time.Now()
+	set.UpdatedAt = time.Now()
+
+	r.sets[set.ID] = cloneLegoSet(set)
+	r.syncPrimaryImage(set.ID)
+	return nil
+}
+
+// GetByID retrieves a Lego set by its ID
+func (r *MemoryLegoSetRepository) GetByID(id string) (*models.LegoSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, ok := r.sets[id]
+	if !ok {
+		return nil, nil
+	}
+	return cloneLegoSet(set), nil
+}
+
+// GetBySetNumber retrieves a Lego set by its set number
+func (r *MemoryLegoSetRepository) GetBySetNumber(setNumber string) (*models.LegoSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := r.findBySetNumber(setNumber)
+	if set == nil {
+		return nil, nil
+	}
+	return cloneLegoSet(set), nil
+}
+
+// GetAll retrieves all Lego sets with optional filtering and sorting
+func (r *MemoryLegoSetRepository) GetAll(filters map[string]interface{}, sortBy, sortOrder string) ([]*models.LegoSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sets := []*models.LegoSet{}
+	for _, set := range r.sets {
+		if series, ok := filters["series"].(string); ok && series != "" {
+			if set.Series == nil || !strings.EqualFold(*set.Series, series) {
+				continue
+			}
+		}
+		if owned, ok := filters["owned"].(bool); ok && set.Owned != owned {
+			continue
+		}
+		if search, ok := filters["search"].(string); ok && search != "" && !matchesSearch(set, search) {
+			continue
+		}
+		sets = append(sets, cloneLegoSet(set))
+	}
+
+	if sortBy == "" || !validSortFields[sortBy] {
+		sortBy = "created_at"
+		sortOrder = "DESC"
+	}
+	descending := strings.ToUpper(sortOrder) == "DESC"
+
+	sortByInsertion(sets)
+	sort.SliceStable(sets, func(i, j int) bool {
+		cmp := compareColumn(sets[i], sets[j], sortBy)
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	return sets, nil
+}
+
+// EachSet calls fn with each set GetAll would return. The sets are copied
+// up front, so fn sees a snapshot.
+func (r *MemoryLegoSetRepository) EachSet(ctx context.Context, filters map[string]interface{}, sortBy, sortOrder string, fn func(*models.LegoSet) error) error {
+	sets, err := r.GetAll(filters, sortBy, sortOrder)
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search searches for Lego sets across multiple fields
+func (r *MemoryLegoSetRepository) Search(searchTerm string) ([]*models.LegoSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sets := []*models.LegoSet{}
+	for _, set := range r.sets {
+		if matchesSearch(set, searchTerm) {
+			sets = append(sets, cloneLegoSet(set))
+		}
+	}
+
+	sortByInsertion(sets)
+	sort.SliceStable(sets, func(i, j int) bool {
+		return compareColumn(sets[i], sets[j], "title") < 0
+	})
+
+	return sets, nil
+}
+
+// matchesSearch reports whether searchTerm appears, ignoring case, in any of
+// the fields Search looks at
+func matchesSearch(set *models.LegoSet, searchTerm string) bool {
+	term := strings.ToLower(searchTerm)
+	matches := func(value string) bool {
+		return strings.Contains(strings.ToLower(value), term)
+	}
+	return matches(set.SetNumber) || matches(set.Title) || matches(stringValue(set.Description)) ||
+		matches(stringValue(set.Series)) || matches(stringValue(set.Notes))
+}
+
+// Update updates an existing Lego set
+func (r *MemoryLegoSetRepository) Update(id string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.sets[id]
+	if !ok {
+		return fmt.Errorf("no rows updated")
+	}
+
+	updated := cloneLegoSet(existing)
+	for column, value := range updates {
+		if err := setColumn(updated, column, value); err != nil {
+			return err
+		}
+	}
+
+	if duplicate := r.findBySetNumber(updated.SetNumber); duplicate != nil && duplicate.ID != id {
+		return ErrDuplicateSetNumber
+	}
+
+	updated.UpdatedAt = time.Now()
+	r.sets[id] = updated
+	if _, ok := updates["image_filename"]; ok {
+		r.syncPrimaryImage(id)
+	}
+	return nil
+}
+
+// Delete removes a Lego set
+func (r *MemoryLegoSetRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sets[id]; !ok {
+		return fmt.Errorf("no rows deleted")
+	}
+
+	delete(r.sets, id)
+	for imageID, image := range r.images {
+		if image.SetID == id {
+			delete(r.images, imageID)
+		}
+	}
+	return nil
+}
+
+// GetStatistics retrieves aggregate statistics for the collection
+func (r *MemoryLegoSetRepository) GetStatistics() (*models.Statistics, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := &models.Statistics{}
+	owned := []*models.LegoSet{}
+	for _, set := range r.sets {
+		stats.TotalSets++
+		if !set.Owned {
+			continue
+		}
+		owned = append(owned, set)
+		stats.OwnedSets++
+		stats.TotalPieces += set.NumParts * set.QuantityOwned
+		stats.TotalMinifigs += set.NumMinifigs * set.QuantityOwned
+		if set.ApproximateValue != nil {
+			stats.TotalValue += *set.ApproximateValue * float64(set.QuantityOwned)
+		}
+	}
+	sortByInsertion(owned)
+
+	// Calculate average value
+	if stats.OwnedSets > 0 {
+		stats.AverageValue = stats.TotalValue / float64(stats.OwnedSets)
+	}
+
+	for _, set := range owned {
+		if set.ApproximateValue != nil && (stats.MostExpensiveSet == nil || *set.ApproximateValue > *stats.MostExpensiveSet.ApproximateValue) {
+			stats.MostExpensiveSet = set
+		}
+		if stats.LargestSet == nil || set.NumParts > stats.LargestSet.NumParts {
+			stats.LargestSet = set
+		}
+		if set.ReleaseYear != nil && (stats.OldestSet == nil || *set.ReleaseYear < *stats.OldestSet.ReleaseYear) {
+			stats.OldestSet = set
+		}
+		if set.ReleaseYear != nil && (stats.NewestSet == nil || *set.ReleaseYear > *stats.NewestSet.ReleaseYear) {
+			stats.NewestSet = set
+		}
+	}
+
+	stats.MostExpensiveSet = cloneLegoSet(stats.MostExpensiveSet)
+	stats.LargestSet = cloneLegoSet(stats.LargestSet)
+	stats.OldestSet = cloneLegoSet(stats.OldestSet)
+	stats.NewestSet = cloneLegoSet(stats.NewestSet)
+
+	return stats, nil
+}
+
+// GetAllSeries retrieves all unique series names
+func (r *MemoryLegoSetRepository) GetAllSeries() ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := map[string]bool{}
+	series := []string{}
+	for _, set := range r.sets {
+		if set.Series == nil || *set.Series == "" {
+			continue
+		}
+		key := strings.ToLower(*set.Series)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		series = append(series, *set.Series)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return strings.ToLower(series[i]) < strings.ToLower(series[j])
+	})
+
+	return series, nil
+}
+
+// GetBySetNumbers retrieves the sets with the given set numbers, keyed by
+// lowercased set number
+func (r *MemoryLegoSetRepository) GetBySetNumbers(setNumbers []string) (map[string]*models.LegoSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	found := map[string]*models.LegoSet{}
+	for _, setNumber := range setNumbers {
+		if set := r.findBySetNumber(setNumber); set != nil {
+			found[strings.ToLower(set.SetNumber)] = cloneLegoSet(set)
+		}
+	}
+	return found, nil
+}
+
+// CreateMany inserts all of the sets or, if any set number is taken, none
+func (r *MemoryLegoSetRepository) CreateMany(sets []*models.LegoSet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, set := range sets {
+		key := strings.ToLower(set.SetNumber)
+		if seen[key] || r.findBySetNumber(set.SetNumber) != nil {
+			return ErrDuplicateSetNumber
+		}
+		seen[key] = true
+	}
+
+	now := time.Now()
+	for _, set := range sets {
+		set.ID = uuid.New().String()
+		set.CreatedAt = now
+		set.UpdatedAt = now
+		r.sets[set.ID] = cloneLegoSet(set)
+		r.syncPrimaryImage(set.ID)
+	}
+	return nil
+}
+
+// Restore inserts a set with its own ID and timestamps, or replaces the
+// existing set with that ID
+func (r *MemoryLegoSetRepository) Restore(set *models.LegoSet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fillRestoreDefaults(set)
+
+	if other := r.findBySetNumber(set.SetNumber); other != nil && other.ID != set.ID {
+		return ErrDuplicateSetNumber
+	}
+
+	r.sets[set.ID] = cloneLegoSet(set)
+	r.syncPrimaryImage(set.ID)
+	return nil
+}
+
+// RunInTx runs fn against a copy of the repository and swaps the copy in
+// when fn succeeds. The repository stays locked until fn returns, so other
+// callers block instead of writing to maps the swap would throw away.
+func (r *MemoryLegoSetRepository) RunInTx(fn func(store LegoSetStore) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &MemoryLegoSetRepository{
+		sets:   make(map[string]*models.LegoSet, len(r.sets)),
+		images: make(map[string]*models.SetImage, len(r.images)),
+	}
+	for id, set := range r.sets {
+		tx.sets[id] = cloneLegoSet(set)
+	}
+	for id, image := range r.images {
+		tx.images[id] = cloneSetImage(image)
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.sets = tx.sets
+	r.images = tx.images
+	return nil
+}
+
+// findBySetNumber compares case-insensitively like the MySQL collation does.
+// The caller must hold the lock.
+func (r *MemoryLegoSetRepository) findBySetNumber(setNumber string) *models.LegoSet {
+	for _, set := range r.sets {
+		if strings.EqualFold(set.SetNumber, setNumber) {
+			return set
+		}
+	}
+	return nil
+}
+
+// sortByInsertion gives map iteration a deterministic starting order
+func sortByInsertion(sets []*models.LegoSet) {
+	sort.Slice(sets, func(i, j int) bool {
+		if !sets[i].CreatedAt.Equal(sets[j].CreatedAt) {
+			return sets[i].CreatedAt.Before(sets[j].CreatedAt)
+		}
+		return sets[i].ID < sets[j].ID
+	})
+}
+
+// compareColumn orders two sets by a sortable column. NULLs sort first, as
+// they do in MySQL.
+func compareColumn(a, b *models.LegoSet, column string) int {
+	switch column {
+	case "title":
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case "set_number":
+		return strings.Compare(strings.ToLower(a.SetNumber), strings.ToLower(b.SetNumber))
+	case "release_year":
+		if a.ReleaseYear == nil || b.ReleaseYear == nil {
+			return compareNil(a.ReleaseYear == nil, b.ReleaseYear == nil)
+		}
+		return *a.ReleaseYear - *b.ReleaseYear
+	case "approximate_value":
+		if a.ApproximateValue == nil || b.ApproximateValue == nil {
+			return compareNil(a.ApproximateValue == nil, b.ApproximateValue == nil)
+		}
+		switch {
+		case *a.ApproximateValue < *b.ApproximateValue:
+			return -1
+		case *a.ApproximateValue > *b.ApproximateValue:
+			return 1
+		}
+		return 0
+	case "num_parts":
+		return a.NumParts - b.NumParts
+	default:
+		return a.CreatedAt.Compare(b.CreatedAt)
+	}
+}
+
+func compareNil(aNil, bNil bool) int {
+	switch {
+	case aNil && bNil:
+		return 0
+	case aNil:
+		return -1
+	}
+	return 1
+}
+
+// setColumn applies a single column update the way the SQL UPDATE would
+func setColumn(set *models.LegoSet, column string, value interface{}) error {
+	var err error
+
+	switch column {
+	case "set_number":
+		set.SetNumber, err = toString(column, value)
+	case "alternate_set_number":
+		set.AlternateSetNumber, err = toStringPtr(column, value)
+	case "title":
+		set.Title, err = toString(column, value)
+	case "owned":
+		owned, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("invalid value for %s: %v", column, value)
+		}
+		set.Owned = owned
+	case "quantity_owned":
+		set.QuantityOwned, err = toInt(column, value)
+	case "release_year":
+		if value == nil {
+			set.ReleaseYear = nil
+			break
+		}
+		var year int
+		year, err = toInt(column, value)
+		set.ReleaseYear = &year
+	case "description":
+		set.Description, err = toStringPtr(column, value)
+	case "series":
+		set.Series, err = toStringPtr(column, value)
+	case "num_parts":
+		set.NumParts, err = toInt(column, value)
+	case "num_minifigs":
+		set.NumMinifigs, err = toInt(column, value)
+	case "bricklink_url":
+		set.BricklinkURL, err = toStringPtr(column, value)
+	case "rebrickable_url":
+		set.RebrickableURL, err = toStringPtr(column, value)
+	case "approximate_value":
+		switch v := value.(type) {
+		case nil:
+			set.ApproximateValue = nil
+		case float64:
+			set.ApproximateValue = &v
+		case *float64:
+			set.ApproximateValue = cloneFloat64(v)
+		case int:
+			f := float64(v)
+			set.ApproximateValue = &f
+		default:
+			return fmt.Errorf("invalid value for %s: %v", column, value)
+		}
+	case "value_last_updated":
+		switch v := value.(type) {
+		case nil:
+			set.ValueLastUpdated = nil
+		case time.Time:
+			set.ValueLastUpdated = &v
+		case *time.Time:
+			set.ValueLastUpdated = cloneTime(v)
+		default:
+			return fmt.Errorf("invalid value for %s: %v", column, value)
+		}
+	case "condition_description":
+		set.ConditionDescription, err = toStringPtr(column, value)
+	case "image_filename":
+		set.ImageFilename, err = toStringPtr(column, value)
+	case "notes":
+		set.Notes, err = toStringPtr(column, value)
+	default:
+		return fmt.Errorf("unknown column %q", column)
+	}
+
+	return err
+}
+
+func toString(column string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case *string:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value for %s: %v", column, value)
+}
+
+func toStringPtr(column string, value interface{}) (*string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case *string:
+		return cloneString(v), nil
+	}
+	return nil, fmt.Errorf("invalid value for %s: %v", column, value)
+}
+
+func toInt(column string, value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case *int:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid value for %s: %v", column, value)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// cloneLegoSet returns a deep copy so callers cannot mutate stored sets
+func cloneLegoSet(set *models.LegoSet) *models.LegoSet {
+	if set == nil {
+		return nil
+	}
+
+	clone := *set
+	clone.AlternateSetNumber = cloneString(set.AlternateSetNumber)
+	clone.ReleaseYear = cloneInt(set.ReleaseYear)
+	clone.Description = cloneString(set.Description)
+	clone.Series = cloneString(set.Series)
+	clone.BricklinkURL = cloneString(set.BricklinkURL)
+	clone.RebrickableURL = cloneString(set.RebrickableURL)
+	clone.ApproximateValue = cloneFloat64(set.ApproximateValue)
+	clone.ValueLastUpdated = cloneTime(set.ValueLastUpdated)
+	clone.ConditionDescription = cloneString(set.ConditionDescription)
+	clone.ImageFilename = cloneString(set.ImageFilename)
+	clone.Notes = cloneString(set.Notes)
+	return &clone
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func cloneInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func cloneFloat64(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	v := *f
+	return &v
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
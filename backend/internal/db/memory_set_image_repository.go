@@ -0,0 +1,261 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ListImages returns a set's images in display order
+func (r *MemoryLegoSetRepository) ListImages(setID string) ([]*models.SetImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	images := []*models.SetImage{}
+	for _, image := range r.setImages(setID) {
+		images = append(images, cloneSetImage(image))
+	}
+	return images, nil
+}
+
+// ListAllImages returns the images of every set
+func (r *MemoryLegoSetRepository) ListAllImages() ([]*models.SetImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	setIDs := []string{}
+	for id := range r.sets {
+		setIDs = append(setIDs, id)
+	}
+	sort.Strings(setIDs)
+
+	images := []*models.SetImage{}
+	for _, id := range setIDs {
+		for _, image := range r.setImages(id) {
+			images = append(images, cloneSetImage(image))
+		}
+	}
+	return images, nil
+}
+
+// GetImage retrieves one of a set's images
+func (r *MemoryLegoSetRepository) GetImage(setID, imageID string) (*models.SetImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	image, ok := r.images[imageID]
+	if !ok || image.SetID != setID {
+		return nil, nil
+	}
+	return cloneSetImage(image), nil
+}
+
+// AddImage inserts an image after the set's other images
+func (r *MemoryLegoSetRepository) AddImage(image *models.SetImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sets[image.SetID]; !ok {
+		return fmt.Errorf("failed to add image: set %s not found", image.SetID)
+	}
+
+	images := r.setImages(image.SetID)
+	image.ID = uuid.New().String()
+	image.SortOrder = 0
+	if len(images) > 0 {
+		image.SortOrder = images[len(images)-1].SortOrder + 1
+	}
+	image.IsPrimary = r.primaryImage(image.SetID) == nil
+	image.CreatedAt = time.Now()
+
+	r.images[image.ID] = cloneSetImage(image)
+	if image.IsPrimary {
+		r.setImageFilename(image.SetID, &image.Filename)
+	}
+	return nil
+}
+
+// UpdateImage writes an image's caption and kind
+func (r *MemoryLegoSetRepository) UpdateImage(image *models.SetImage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.images[image.ID]
+	if !ok || existing.SetID != image.SetID {
+		return ErrImageNotFound
+	}
+	existing.Caption = cloneString(image.Caption)
+	existing.Kind = cloneString(image.Kind)
+	return nil
+}
+
+// ReorderImages numbers a set's images in the given order
+func (r *MemoryLegoSetRepository) ReorderImages(setID string, imageIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := checkImageOrder(r.setImages(setID), imageIDs); err != nil {
+		return err
+	}
+	for i, id := range imageIDs {
+		r.images[id].SortOrder = i
+	}
+	return nil
+}
+
+// SetPrimaryImage makes an image the set's primary image
+func (r *MemoryLegoSetRepository) SetPrimaryImage(setID, imageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	image, ok := r.images[imageID]
+	if !ok || image.SetID != setID {
+		return ErrImageNotFound
+	}
+	r.makePrimary(image)
+	return nil
+}
+
+// DeleteImage removes an image, promoting the next one if it was primary
+func (r *MemoryLegoSetRepository) DeleteImage(setID, imageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	image, ok := r.images[imageID]
+	if !ok || image.SetID != setID {
+		return ErrImageNotFound
+	}
+
+	delete(r.images, imageID)
+	if !image.IsPrimary {
+		return nil
+	}
+	if images := r.setImages(setID); len(images) > 0 {
+		r.makePrimary(images[0])
+	} else {
+		r.setImageFilename(setID, nil)
+	}
+	return nil
+}
+
+// syncPrimaryImage makes a set's primary image match its ImageFilename like
+// LegoSetRepository does. The caller must hold the lock.
+func (r *MemoryLegoSetRepository) syncPrimaryImage(setID string) {
+	filename := r.sets[setID].ImageFilename
+	images := r.setImages(setID)
+	primary := r.primaryImage(setID)
+
+	var named *models.SetImage
+	for _, image := range images {
+		if filename != nil && image.Filename == *filename {
+			named = image
+			break
+		}
+	}
+
+	switch {
+	case filename == nil || *filename == "":
+		// The next image takes the primary image's place, as in DeleteImage
+		if primary != nil {
+			delete(r.images, primary.ID)
+		}
+		if remaining := r.setImages(setID); len(remaining) > 0 {
+			next := remaining[0]
+			for _, image := range remaining {
+				image.IsPrimary = image == next
+			}
+			updated := cloneLegoSet(r.sets[setID])
+			updated.ImageFilename = cloneString(&next.Filename)
+			r.sets[setID] = updated
+		}
+	case primary != nil && primary.Filename == *filename:
+	case named != nil:
+		for _, image := range images {
+			image.IsPrimary = image == named
+		}
+	case primary != nil:
+		primary.Filename = *filename
+	default:
+		sortOrder := 0
+		if len(images) > 0 {
+			sortOrder = images[len(images)-1].SortOrder + 1
+		}
+		image := &models.SetImage{
+			ID:        uuid.New().String(),
+			SetID:     setID,
+			Filename:  *filename,
+			SortOrder: sortOrder,
+			IsPrimary: true,
+			CreatedAt: time.Now(),
+		}
+		r.images[image.ID] = image
+	}
+}
+
+// setImages returns a set's stored images in display order. The caller must
+// hold the lock.
+func (r *MemoryLegoSetRepository) setImages(setID string) []*models.SetImage {
+	images := []*models.SetImage{}
+	for _, image := range r.images {
+		if image.SetID == setID {
+			images = append(images, image)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		a, b := images[i], images[j]
+		if a.SortOrder != b.SortOrder {
+			return a.SortOrder < b.SortOrder
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return images
+}
+
+// primaryImage returns a set's stored primary image, or nil. The caller
+// must hold the lock.
+func (r *MemoryLegoSetRepository) primaryImage(setID string) *models.SetImage {
+	for _, image := range r.images {
+		if image.SetID == setID && image.IsPrimary {
+			return image
+		}
+	}
+	return nil
+}
+
+// makePrimary marks an image as its set's only primary image and copies its
+// filename to the set. The caller must hold the lock.
+func (r *MemoryLegoSetRepository) makePrimary(primary *models.SetImage) {
+	for _, image := range r.images {
+		if image.SetID == primary.SetID {
+			image.IsPrimary = image == primary
+		}
+	}
+	r.setImageFilename(primary.SetID, &primary.Filename)
+}
+
+// setImageFilename writes a set's ImageFilename without touching its
+// images. The caller must hold the lock.
+func (r *MemoryLegoSetRepository) setImageFilename(setID string, filename *string) {
+	updated := cloneLegoSet(r.sets[setID])
+	updated.ImageFilename = cloneString(filename)
+	updated.UpdatedAt = time.Now()
+	r.sets[setID] = updated
+}
+
+func cloneSetImage(image *models.SetImage) *models.SetImage {
+	if image == nil {
+		return nil
+	}
+	clone := *image
+	clone.Caption = cloneString(image.Caption)
+	clone.Kind = cloneString(image.Kind)
+	clone.URLs = nil
+	return &clone
+}
@@ -0,0 +1,518 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockName is the advisory lock held while migrations run so that
+// two servers starting at the same time cannot migrate concurrently
+const migrationLockName = "lego_catalog_schema_migrations"
+
+// LegacyBaselineVersion is the last migration that was applied by the old
+// run-everything-on-boot runner. Databases that already contain lego_sets but
+// no schema_migrations table are assumed to be at this version.
+const LegacyBaselineVersion = 2
+
+// ErrChecksumMismatch is returned when an applied migration file has been
+// edited after it was run
+var ErrChecksumMismatch = errors.New("migration checksum mismatch")
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change with paired up and down scripts
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus describes the state of a single migration
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Checksum  string
+	// Modified is true when the file no longer matches the applied checksum
+	Modified bool
+	// Missing is true when the migration is recorded as applied but its
+	// file is no longer present
+	Missing bool
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Migrator applies and rolls back versioned migrations
+type Migrator struct {
+	db          *Database
+	migrations  []*Migration
+	LockTimeout time.Duration
+}
+
+// NewMigrator creates a migrator for the migrations found in fsys
+func NewMigrator(db *Database, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          db,
+		migrations:  migrations,
+		LockTimeout: 30 * time.Second,
+	}, nil
+}
+
+// LoadMigrations reads NNN_name.up.sql / NNN_name.down.sql pairs from fsys
+// and returns them ordered by version
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration filename %s: expected NNN_name.up.sql or NNN_name.down.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Checksum == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations and returns the ones that were run
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	applied := []*Migration{}
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		recorded, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if existing, ok := recorded[migration.Version]; ok {
+				if existing.Checksum != migration.Checksum {
+					return fmt.Errorf("%w: %03d_%s was modified after it was applied", ErrChecksumMismatch, migration.Version, migration.Name)
+				}
+				continue
+			}
+
+			log.Printf("Applying migration %03d_%s", migration.Version, migration.Name)
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	rolledBack := []*Migration{}
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		recorded, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		byVersion := map[int64]*Migration{}
+		for _, migration := range m.migrations {
+			byVersion[migration.Version] = migration
+		}
+
+		versions := make([]int64, 0, len(recorded))
+		for version := range recorded {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for i := 0; i < steps && i < len(versions); i++ {
+			migration, ok := byVersion[versions[i]]
+			if !ok {
+				return fmt.Errorf("cannot roll back migration %d (%s): file not found", versions[i], recorded[versions[i]].Name)
+			}
+			if strings.TrimSpace(migration.Down) == "" {
+				return fmt.Errorf("cannot roll back migration %03d_%s: no down script", migration.Version, migration.Name)
+			}
+
+			log.Printf("Rolling back migration %03d_%s", migration.Version, migration.Name)
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+// Status reports every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		recorded, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		seen := map[int64]bool{}
+		for _, migration := range m.migrations {
+			status := MigrationStatus{
+				Version:  migration.Version,
+				Name:     migration.Name,
+				Checksum: migration.Checksum,
+			}
+			if existing, ok := recorded[migration.Version]; ok {
+				appliedAt := existing.AppliedAt
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+				status.Modified = existing.Checksum != migration.Checksum
+			}
+			seen[migration.Version] = true
+			statuses = append(statuses, status)
+		}
+
+		for version, existing := range recorded {
+			if seen[version] {
+				continue
+			}
+			appliedAt := existing.AppliedAt
+			statuses = append(statuses, MigrationStatus{
+				Version:   version,
+				Name:      existing.Name,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Checksum:  existing.Checksum,
+				Missing:   true,
+			})
+		}
+
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i].Version < statuses[j].Version
+		})
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock runs fn on a dedicated connection while holding the migration lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := m.db.Dialect.AcquireLock(ctx, conn, migrationLockName, m.LockTimeout); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		if err := m.db.Dialect.ReleaseLock(context.Background(), conn, migrationLockName); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+// prepare ensures the schema_migrations table exists, adopts databases
+// created by the legacy runner and returns the applied migrations
+func (m *Migrator) prepare(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	recorded, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recorded) == 0 {
+		if err := m.baselineLegacy(ctx, conn); err != nil {
+			return nil, err
+		}
+		return m.applied(ctx, conn)
+	}
+
+	return recorded, nil
+}
+
+// baselineLegacy records the migrations the legacy runner already applied
+// when lego_sets exists but nothing has been recorded yet
+func (m *Migrator) baselineLegacy(ctx context.Context, conn *sql.Conn) error {
+	exists, err := m.db.Dialect.TableExists(ctx, conn, "lego_sets")
+	if err != nil {
+		return fmt.Errorf("failed to inspect existing schema: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > LegacyBaselineVersion {
+			break
+		}
+		log.Printf("Recording existing migration %03d_%s as applied", migration.Version, migration.Name)
+		if err := m.record(ctx, conn, migration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	recorded := map[int64]appliedMigration{}
+	for rows.Next() {
+		var migration appliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.Checksum, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+		recorded[migration.Version] = migration
+	}
+
+	return recorded, rows.Err()
+}
+
+func (m *Migrator) record(ctx context.Context, execer execer, migration *Migration) error {
+	_, err := execer.ExecContext(ctx,
+		m.db.Dialect.Rebind("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+		migration.Version, migration.Name, migration.Checksum, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %03d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// apply runs a migration and records it in one transaction. Dialects with
+// transactional DDL roll back a failed migration completely; MySQL commits
+// each DDL statement implicitly.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range SplitStatements(migration.Up) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to execute migration %03d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if err := m.record(ctx, tx, migration); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range SplitStatements(migration.Down) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to roll back migration %03d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, m.db.Dialect.Rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version); err != nil {
+		return fmt.Errorf("failed to remove migration record %03d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// execer is satisfied by *sql.Conn and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SplitStatements splits a migration script into individual statements on
+// semicolons that are not inside quotes, dollar-quoted bodies or comments.
+// Comment-only fragments are dropped.
+func SplitStatements(script string) []string {
+	statements := []string{}
+	var current strings.Builder
+	hasCode := false
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			current.WriteString(script[i : i+end])
+			i += end - 1
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i - 2
+			} else {
+				end += 2
+			}
+			current.WriteString(script[i : i+2+end])
+			i += 1 + end
+		case c == '$' && dollarQuoteTag(script[i:]) != "":
+			// PostgreSQL dollar-quoted bodies such as $$ ... $$ may contain
+			// semicolons
+			tag := dollarQuoteTag(script[i:])
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				end = len(script) - i - len(tag)
+			} else {
+				end += len(tag)
+			}
+			current.WriteString(script[i : i+len(tag)+end])
+			hasCode = true
+			i += len(tag) + end - 1
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(script) {
+				if script[end] == '\\' && c != '`' {
+					end += 2
+					continue
+				}
+				if script[end] == c {
+					break
+				}
+				end++
+			}
+			if end >= len(script) {
+				end = len(script) - 1
+			}
+			current.WriteString(script[i : end+1])
+			hasCode = true
+			i = end
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+
+	return statements
+}
+
+// dollarQuoteTag returns the $tag$ opening s, or "" if s doesn't start with one
+func dollarQuoteTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
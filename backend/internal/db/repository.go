@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -14,11 +15,13 @@ import (
 // LegoSetRepository handles database operations for Lego sets
 type LegoSetRepository struct {
 	db *Database
+	// q runs the queries, either db or the transaction from RunInTx
+	q querier
 }
 
 // NewLegoSetRepository creates a new repository
 func NewLegoSetRepository(db *Database) *LegoSetRepository {
-	return &LegoSetRepository{db: db}
+	return &LegoSetRepository{db: db, q: db}
 }
 
 // Create inserts a new Lego set into the database
@@ -36,14 +39,32 @@ func (r *LegoSetRepository) Create(set *models.LegoSet) error {
 	set.CreatedAt = time.Now()
 	set.UpdatedAt = time.Now()
 
-	_, err := r.db.Exec(query,
-		set.ID, set.SetNumber, set.AlternateSetNumber, set.Title, set.Owned, set.QuantityOwned,
-		set.ReleaseYear, set.Description, set.Series, set.NumParts, set.NumMinifigs,
-		set.BricklinkURL, set.RebrickableURL, set.ApproximateValue, set.ValueLastUpdated,
-		set.ConditionDescription, set.ImageFilename, set.Notes,
-	)
+	insert := func(tx *LegoSetRepository) error {
+		_, err := tx.q.Exec(query,
+			set.ID, set.SetNumber, set.AlternateSetNumber, set.Title, set.Owned, set.QuantityOwned,
+			set.ReleaseYear, set.Description, set.Series, set.NumParts, set.NumMinifigs,
+			set.BricklinkURL, set.RebrickableURL, set.ApproximateValue, set.ValueLastUpdated,
+			set.ConditionDescription, set.ImageFilename, set.Notes,
+		)
+		if err != nil {
+			return tx.translateError(err)
+		}
+		return tx.insertSetImage(set)
+	}
 
-	return err
+	// A set with an image is inserted along with its set_images row
+	if set.ImageFilename == nil || *set.ImageFilename == "" {
+		return insert(r)
+	}
+	return r.inTx(insert)
+}
+
+// insertSetImage adds the primary image of a newly inserted set
+func (r *LegoSetRepository) insertSetImage(set *models.LegoSet) error {
+	if set.ImageFilename == nil || *set.ImageFilename == "" {
+		return nil
+	}
+	return r.insertPrimaryImage(set.ID, *set.ImageFilename, 0)
 }
 
 // GetByID retrieves a Lego set by its ID
@@ -58,7 +79,7 @@ func (r *LegoSetRepository) GetByID(id string) (*models.LegoSet, error) {
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.q.QueryRow(query, id).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -87,7 +108,7 @@ func (r *LegoSetRepository) GetBySetNumber(setNumber string) (*models.LegoSet, e
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query, setNumber).Scan(
+	err := r.q.QueryRow(query, setNumber).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -106,6 +127,20 @@ func (r *LegoSetRepository) GetBySetNumber(setNumber string) (*models.LegoSet, e
 
 // GetAll retrieves all Lego sets with optional filtering and sorting
 func (r *LegoSetRepository) GetAll(filters map[string]interface{}, sortBy, sortOrder string) ([]*models.LegoSet, error) {
+	sets := []*models.LegoSet{}
+	err := r.EachSet(context.Background(), filters, sortBy, sortOrder, func(set *models.LegoSet) error {
+		sets = append(sets, set)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// EachSet calls fn with each set GetAll would return, reading them from a
+// cursor one at a time
+func (r *LegoSetRepository) EachSet(ctx context.Context, filters map[string]interface{}, sortBy, sortOrder string, fn func(*models.LegoSet) error) error {
 	query := `
 		SELECT id, set_number, alternate_set_number, title, owned, quantity_owned,
 		       release_year, description, series, num_parts, num_minifigs,
@@ -127,33 +162,30 @@ func (r *LegoSetRepository) GetAll(filters map[string]interface{}, sortBy, sortO
 		args = append(args, owned)
 	}
 
-	// Apply sorting
-	validSortFields := map[string]bool{
-		"title":             true,
-		"set_number":        true,
-		"release_year":      true,
-		"approximate_value": true,
-		"num_parts":         true,
-		"created_at":        true,
+	if search, ok := filters["search"].(string); ok && search != "" {
+		query += fmt.Sprintf(" AND (set_number %[1]s ? OR title %[1]s ? OR description %[1]s ? OR series %[1]s ? OR notes %[1]s ?)",
+			r.db.Dialect.LikeOperator())
+		searchPattern := "%" + search + "%"
+		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
 	}
 
+	// Apply sorting
 	if sortBy != "" && validSortFields[sortBy] {
 		order := "ASC"
 		if strings.ToUpper(sortOrder) == "DESC" {
 			order = "DESC"
 		}
-		query += fmt.Sprintf(" ORDER BY %s %s", sortBy, order)
+		query += fmt.Sprintf(" ORDER BY %s %s%s", sortBy, order, r.db.Dialect.NullsOrder(order))
 	} else {
 		query += " ORDER BY created_at DESC"
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.q.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	sets := []*models.LegoSet{}
 	for rows.Next() {
 		set := &models.LegoSet{}
 		err := rows.Scan(
@@ -163,32 +195,34 @@ func (r *LegoSetRepository) GetAll(filters map[string]interface{}, sortBy, sortO
 			&set.ConditionDescription, &set.ImageFilename, &set.Notes, &set.CreatedAt, &set.UpdatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(set); err != nil {
+			return err
 		}
-		sets = append(sets, set)
 	}
 
-	return sets, nil
+	return rows.Err()
 }
 
 // Search searches for Lego sets across multiple fields
 func (r *LegoSetRepository) Search(searchTerm string) ([]*models.LegoSet, error) {
-	query := `
+	query := fmt.Sprintf(`
 		SELECT id, set_number, alternate_set_number, title, owned, quantity_owned,
 		       release_year, description, series, num_parts, num_minifigs,
 		       bricklink_url, rebrickable_url, approximate_value, value_last_updated,
 		       condition_description, image_filename, notes, created_at, updated_at
 		FROM lego_sets
-		WHERE set_number LIKE ?
-		   OR title LIKE ?
-		   OR description LIKE ?
-		   OR series LIKE ?
-		   OR notes LIKE ?
+		WHERE set_number %[1]s ?
+		   OR title %[1]s ?
+		   OR description %[1]s ?
+		   OR series %[1]s ?
+		   OR notes %[1]s ?
 		ORDER BY title ASC
-	`
+	`, r.db.Dialect.LikeOperator())
 
 	searchPattern := "%" + searchTerm + "%"
-	rows, err := r.db.Query(query, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
+	rows, err := r.q.Query(query, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
 	if err != nil {
 		return nil, err
 	}
@@ -218,6 +252,25 @@ func (r *LegoSetRepository) Update(id string, updates map[string]interface{}) er
 		return nil
 	}
 
+	filename, syncImage := updates["image_filename"]
+	if syncImage {
+		imageFilename, err := toStringPtr("image_filename", filename)
+		if err != nil {
+			return err
+		}
+		return r.inTx(func(tx *LegoSetRepository) error {
+			if err := tx.updateSet(id, updates); err != nil {
+				return err
+			}
+			return tx.syncPrimaryImage(id, imageFilename)
+		})
+	}
+
+	return r.updateSet(id, updates)
+}
+
+// updateSet runs the UPDATE for Update
+func (r *LegoSetRepository) updateSet(id string, updates map[string]interface{}) error {
 	query := "UPDATE lego_sets SET "
 	args := []interface{}{}
 	setClauses := []string{}
@@ -231,9 +284,9 @@ func (r *LegoSetRepository) Update(id string, updates map[string]interface{}) er
 	query += ", updated_at = ? WHERE id = ?"
 	args = append(args, time.Now(), id)
 
-	result, err := r.db.Exec(query, args...)
+	result, err := r.q.Exec(query, args...)
 	if err != nil {
-		return err
+		return r.translateError(err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -251,7 +304,7 @@ func (r *LegoSetRepository) Update(id string, updates map[string]interface{}) er
 // Delete removes a Lego set from the database
 func (r *LegoSetRepository) Delete(id string) error {
 	query := "DELETE FROM lego_sets WHERE id = ?"
-	result, err := r.db.Exec(query, id)
+	result, err := r.q.Exec(query, id)
 	if err != nil {
 		return err
 	}
@@ -284,7 +337,7 @@ func (r *LegoSetRepository) GetStatistics() (*models.Statistics, error) {
 	`
 
 	var totalValue sql.NullFloat64
-	err := r.db.QueryRow(query).Scan(
+	err := r.q.QueryRow(query).Scan(
 		&stats.TotalSets,
 		&stats.OwnedSets,
 		&stats.TotalPieces,
@@ -344,7 +397,7 @@ func (r *LegoSetRepository) getMostExpensiveSet() (*models.LegoSet, error) {
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query).Scan(
+	err := r.q.QueryRow(query).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -374,7 +427,7 @@ func (r *LegoSetRepository) getLargestSet() (*models.LegoSet, error) {
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query).Scan(
+	err := r.q.QueryRow(query).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -404,7 +457,7 @@ func (r *LegoSetRepository) getOldestSet() (*models.LegoSet, error) {
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query).Scan(
+	err := r.q.QueryRow(query).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -434,7 +487,7 @@ func (r *LegoSetRepository) getNewestSet() (*models.LegoSet, error) {
 	`
 
 	set := &models.LegoSet{}
-	err := r.db.QueryRow(query).Scan(
+	err := r.q.QueryRow(query).Scan(
 		&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
 		&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
 		&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
@@ -460,7 +513,7 @@ func (r *LegoSetRepository) GetAllSeries() ([]string, error) {
 		ORDER BY series ASC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.q.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -477,3 +530,229 @@ func (r *LegoSetRepository) GetAllSeries() ([]string, error) {
 
 	return series, nil
 }
+
+// Restore inserts a set with its own ID and timestamps, or replaces the
+// existing set with that ID
+func (r *LegoSetRepository) Restore(set *models.LegoSet) error {
+	fillRestoreDefaults(set)
+
+	return r.inTx(func(tx *LegoSetRepository) error {
+		if err := tx.restoreSet(set); err != nil {
+			return err
+		}
+		return tx.syncPrimaryImage(set.ID, set.ImageFilename)
+	})
+}
+
+// restoreSet runs the INSERT or UPDATE for Restore
+func (r *LegoSetRepository) restoreSet(set *models.LegoSet) error {
+	existing, err := r.GetByID(set.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		query := `
+			INSERT INTO lego_sets (
+				id, set_number, alternate_set_number, title, owned, quantity_owned,
+				release_year, description, series, num_parts, num_minifigs,
+				bricklink_url, rebrickable_url, approximate_value, value_last_updated,
+				condition_description, image_filename, notes, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = r.q.Exec(query,
+			set.ID, set.SetNumber, set.AlternateSetNumber, set.Title, set.Owned, set.QuantityOwned,
+			set.ReleaseYear, set.Description, set.Series, set.NumParts, set.NumMinifigs,
+			set.BricklinkURL, set.RebrickableURL, set.ApproximateValue, set.ValueLastUpdated,
+			set.ConditionDescription, set.ImageFilename, set.Notes, set.CreatedAt, set.UpdatedAt,
+		)
+		return r.translateError(err)
+	}
+
+	query := `
+		UPDATE lego_sets SET
+			set_number = ?, alternate_set_number = ?, title = ?, owned = ?, quantity_owned = ?,
+			release_year = ?, description = ?, series = ?, num_parts = ?, num_minifigs = ?,
+			bricklink_url = ?, rebrickable_url = ?, approximate_value = ?, value_last_updated = ?,
+			condition_description = ?, image_filename = ?, notes = ?, created_at = ?, updated_at = ?
+		WHERE id = ?
+	`
+	_, err = r.q.Exec(query,
+		set.SetNumber, set.AlternateSetNumber, set.Title, set.Owned, set.QuantityOwned,
+		set.ReleaseYear, set.Description, set.Series, set.NumParts, set.NumMinifigs,
+		set.BricklinkURL, set.RebrickableURL, set.ApproximateValue, set.ValueLastUpdated,
+		set.ConditionDescription, set.ImageFilename, set.Notes, set.CreatedAt, set.UpdatedAt,
+		set.ID,
+	)
+	return r.translateError(err)
+}
+
+// createBatchSize is how many sets CreateMany inserts per statement. At 18
+// parameters a row it stays well under every driver's parameter limit.
+const createBatchSize = 100
+
+// CreateMany inserts sets using multi-row inserts, inside a transaction
+// unless the repository is already running in one
+func (r *LegoSetRepository) CreateMany(sets []*models.LegoSet) error {
+	if len(sets) == 0 {
+		return nil
+	}
+	if _, ok := r.q.(*Tx); !ok {
+		return r.RunInTx(func(store LegoSetStore) error {
+			return store.CreateMany(sets)
+		})
+	}
+
+	for start := 0; start < len(sets); start += createBatchSize {
+		end := start + createBatchSize
+		if end > len(sets) {
+			end = len(sets)
+		}
+		if err := r.createBatch(sets[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *LegoSetRepository) createBatch(sets []*models.LegoSet) error {
+	query := `
+		INSERT INTO lego_sets (
+			id, set_number, alternate_set_number, title, owned, quantity_owned,
+			release_year, description, series, num_parts, num_minifigs,
+			bricklink_url, rebrickable_url, approximate_value, value_last_updated,
+			condition_description, image_filename, notes
+		) VALUES `
+
+	placeholders := make([]string, len(sets))
+	args := make([]interface{}, 0, len(sets)*18)
+	now := time.Now()
+
+	for i, set := range sets {
+		set.ID = uuid.New().String()
+		set.CreatedAt = now
+		set.UpdatedAt = now
+
+		placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		args = append(args,
+			set.ID, set.SetNumber, set.AlternateSetNumber, set.Title, set.Owned, set.QuantityOwned,
+			set.ReleaseYear, set.Description, set.Series, set.NumParts, set.NumMinifigs,
+			set.BricklinkURL, set.RebrickableURL, set.ApproximateValue, set.ValueLastUpdated,
+			set.ConditionDescription, set.ImageFilename, set.Notes,
+		)
+	}
+
+	if _, err := r.q.Exec(query+strings.Join(placeholders, ", "), args...); err != nil {
+		return r.translateError(err)
+	}
+
+	for _, set := range sets {
+		if err := r.insertSetImage(set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupBatchSize is how many set numbers GetBySetNumbers puts in one IN list
+const lookupBatchSize = 500
+
+// GetBySetNumbers retrieves the sets with the given set numbers
+func (r *LegoSetRepository) GetBySetNumbers(setNumbers []string) (map[string]*models.LegoSet, error) {
+	found := map[string]*models.LegoSet{}
+
+	for start := 0; start < len(setNumbers); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(setNumbers) {
+			end = len(setNumbers)
+		}
+		batch := setNumbers[start:end]
+
+		query := fmt.Sprintf(`
+			SELECT id, set_number, alternate_set_number, title, owned, quantity_owned,
+			       release_year, description, series, num_parts, num_minifigs,
+			       bricklink_url, rebrickable_url, approximate_value, value_last_updated,
+			       condition_description, image_filename, notes, created_at, updated_at
+			FROM lego_sets
+			WHERE set_number IN (%s)
+		`, strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", "))
+
+		args := make([]interface{}, len(batch))
+		for i, setNumber := range batch {
+			args[i] = setNumber
+		}
+
+		rows, err := r.q.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			set := &models.LegoSet{}
+			err := rows.Scan(
+				&set.ID, &set.SetNumber, &set.AlternateSetNumber, &set.Title, &set.Owned, &set.QuantityOwned,
+				&set.ReleaseYear, &set.Description, &set.Series, &set.NumParts, &set.NumMinifigs,
+				&set.BricklinkURL, &set.RebrickableURL, &set.ApproximateValue, &set.ValueLastUpdated,
+				&set.ConditionDescription, &set.ImageFilename, &set.Notes, &set.CreatedAt, &set.UpdatedAt,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[strings.ToLower(set.SetNumber)] = set
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// RunInTx runs fn against a repository bound to a new transaction. Calls
+// made while already in a transaction join it.
+func (r *LegoSetRepository) RunInTx(fn func(store LegoSetStore) error) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		return fn(tx)
+	})
+}
+
+// inTx is RunInTx for the repository's own multi-statement writes
+func (r *LegoSetRepository) inTx(fn func(tx *LegoSetRepository) error) error {
+	if _, ok := r.q.(*Tx); ok {
+		return fn(r)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	if err := fn(&LegoSetRepository{db: r.db, q: tx}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// translateError maps driver errors onto the store's sentinel errors
+func (r *LegoSetRepository) translateError(err error) error {
+	if err != nil && r.db.Dialect.IsUniqueViolation(err) {
+		return ErrDuplicateSetNumber
+	}
+	return err
+}
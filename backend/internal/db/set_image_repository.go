@@ -0,0 +1,315 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// setImageColumns are the set_images columns scanned by scanSetImage
+const setImageColumns = "id, set_id, filename, caption, kind, sort_order, is_primary, created_at"
+
+// setImageOrder is the display order of a set's images
+const setImageOrder = "ORDER BY sort_order ASC, created_at ASC, id ASC"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSetImage(row rowScanner) (*models.SetImage, error) {
+	image := &models.SetImage{}
+	err := row.Scan(
+		&image.ID, &image.SetID, &image.Filename, &image.Caption, &image.Kind,
+		&image.SortOrder, &image.IsPrimary, &image.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// ListImages returns a set's images in display order
+func (r *LegoSetRepository) ListImages(setID string) ([]*models.SetImage, error) {
+	rows, err := r.q.Query("SELECT "+setImageColumns+" FROM set_images WHERE set_id = ? "+setImageOrder, setID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.SetImage{}
+	for rows.Next() {
+		image, err := scanSetImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// ListAllImages returns the images of every set
+func (r *LegoSetRepository) ListAllImages() ([]*models.SetImage, error) {
+	rows, err := r.q.Query("SELECT " + setImageColumns + " FROM set_images ORDER BY set_id ASC, sort_order ASC, created_at ASC, id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.SetImage{}
+	for rows.Next() {
+		image, err := scanSetImage(rows)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// GetImage retrieves one of a set's images
+func (r *LegoSetRepository) GetImage(setID, imageID string) (*models.SetImage, error) {
+	row := r.q.QueryRow("SELECT "+setImageColumns+" FROM set_images WHERE id = ? AND set_id = ?", imageID, setID)
+	image, err := scanSetImage(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return image, err
+}
+
+// AddImage inserts an image after the set's other images
+func (r *LegoSetRepository) AddImage(image *models.SetImage) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		var next, primaries int
+		err := tx.q.QueryRow(
+			"SELECT COALESCE(MAX(sort_order) + 1, 0), COUNT(CASE WHEN is_primary = ? THEN 1 END) FROM set_images WHERE set_id = ?",
+			true, image.SetID,
+		).Scan(&next, &primaries)
+		if err != nil {
+			return err
+		}
+
+		image.ID = uuid.New().String()
+		image.SortOrder = next
+		image.IsPrimary = primaries == 0
+		image.CreatedAt = time.Now()
+		if err := tx.insertImage(image); err != nil {
+			return err
+		}
+
+		if image.IsPrimary {
+			return tx.setImageFilename(image.SetID, &image.Filename)
+		}
+		return nil
+	})
+}
+
+// UpdateImage writes an image's caption and kind
+func (r *LegoSetRepository) UpdateImage(image *models.SetImage) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		existing, err := tx.GetImage(image.SetID, image.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return ErrImageNotFound
+		}
+
+		_, err = tx.q.Exec("UPDATE set_images SET caption = ?, kind = ? WHERE id = ?", image.Caption, image.Kind, image.ID)
+		return err
+	})
+}
+
+// ReorderImages numbers a set's images in the given order
+func (r *LegoSetRepository) ReorderImages(setID string, imageIDs []string) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		images, err := tx.ListImages(setID)
+		if err != nil {
+			return err
+		}
+		if err := checkImageOrder(images, imageIDs); err != nil {
+			return err
+		}
+
+		for i, id := range imageIDs {
+			if _, err := tx.q.Exec("UPDATE set_images SET sort_order = ? WHERE id = ?", i, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetPrimaryImage makes an image the set's primary image
+func (r *LegoSetRepository) SetPrimaryImage(setID, imageID string) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		image, err := tx.GetImage(setID, imageID)
+		if err != nil {
+			return err
+		}
+		if image == nil {
+			return ErrImageNotFound
+		}
+		return tx.makePrimary(image)
+	})
+}
+
+// DeleteImage removes an image, promoting the next one if it was primary
+func (r *LegoSetRepository) DeleteImage(setID, imageID string) error {
+	return r.inTx(func(tx *LegoSetRepository) error {
+		image, err := tx.GetImage(setID, imageID)
+		if err != nil {
+			return err
+		}
+		if image == nil {
+			return ErrImageNotFound
+		}
+
+		if _, err := tx.q.Exec("DELETE FROM set_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		if !image.IsPrimary {
+			return nil
+		}
+
+		images, err := tx.ListImages(setID)
+		if err != nil {
+			return err
+		}
+		if len(images) == 0 {
+			return tx.setImageFilename(setID, nil)
+		}
+		return tx.makePrimary(images[0])
+	})
+}
+
+// syncPrimaryImage makes a set's primary image match a new image_filename.
+// It must run in a transaction.
+func (r *LegoSetRepository) syncPrimaryImage(setID string, filename *string) error {
+	images, err := r.ListImages(setID)
+	if err != nil {
+		return err
+	}
+
+	var primary, named *models.SetImage
+	for _, image := range images {
+		if image.IsPrimary {
+			primary = image
+		}
+		if filename != nil && image.Filename == *filename && named == nil {
+			named = image
+		}
+	}
+
+	switch {
+	case filename == nil || *filename == "":
+		err = r.clearPrimaryImage(setID, images, primary)
+	case primary != nil && primary.Filename == *filename:
+	case named != nil:
+		// The set's image is now one of its other images
+		_, err = r.q.Exec("UPDATE set_images SET is_primary = (id = ?) WHERE set_id = ?", named.ID, setID)
+	case primary != nil:
+		_, err = r.q.Exec("UPDATE set_images SET filename = ? WHERE id = ?", *filename, primary.ID)
+	default:
+		next := 0
+		if len(images) > 0 {
+			next = images[len(images)-1].SortOrder + 1
+		}
+		err = r.insertPrimaryImage(setID, *filename, next)
+	}
+	return err
+}
+
+// clearPrimaryImage removes the primary image of a set whose image_filename
+// was cleared. The set's next image takes its place, as when the primary
+// image is deleted, so a set with images always has a primary one.
+func (r *LegoSetRepository) clearPrimaryImage(setID string, images []*models.SetImage, primary *models.SetImage) error {
+	remaining := images
+	if primary != nil {
+		if _, err := r.q.Exec("DELETE FROM set_images WHERE id = ?", primary.ID); err != nil {
+			return err
+		}
+		remaining = nil
+		for _, image := range images {
+			if image != primary {
+				remaining = append(remaining, image)
+			}
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	next := remaining[0]
+	if _, err := r.q.Exec("UPDATE set_images SET is_primary = (id = ?) WHERE set_id = ?", next.ID, setID); err != nil {
+		return err
+	}
+	_, err := r.q.Exec("UPDATE lego_sets SET image_filename = ? WHERE id = ?", next.Filename, setID)
+	return err
+}
+
+// insertPrimaryImage adds the primary image of a set that has none
+func (r *LegoSetRepository) insertPrimaryImage(setID, filename string, sortOrder int) error {
+	return r.insertImage(&models.SetImage{
+		ID:        uuid.New().String(),
+		SetID:     setID,
+		Filename:  filename,
+		SortOrder: sortOrder,
+		IsPrimary: true,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (r *LegoSetRepository) insertImage(image *models.SetImage) error {
+	_, err := r.q.Exec(`
+		INSERT INTO set_images (`+setImageColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		image.ID, image.SetID, image.Filename, image.Caption, image.Kind,
+		image.SortOrder, image.IsPrimary, image.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add image: %w", err)
+	}
+	return nil
+}
+
+// makePrimary marks an image as its set's only primary image and copies its
+// filename to the set
+func (r *LegoSetRepository) makePrimary(image *models.SetImage) error {
+	if _, err := r.q.Exec("UPDATE set_images SET is_primary = (id = ?) WHERE set_id = ?", image.ID, image.SetID); err != nil {
+		return err
+	}
+	return r.setImageFilename(image.SetID, &image.Filename)
+}
+
+// setImageFilename writes a set's image_filename without touching its images
+func (r *LegoSetRepository) setImageFilename(setID string, filename *string) error {
+	_, err := r.q.Exec("UPDATE lego_sets SET image_filename = ?, updated_at = ? WHERE id = ?", filename, time.Now(), setID)
+	return err
+}
+
+// checkImageOrder checks that imageIDs lists each of images once
+func checkImageOrder(images []*models.SetImage, imageIDs []string) error {
+	if len(imageIDs) != len(images) {
+		return ErrInvalidImageOrder
+	}
+
+	remaining := map[string]bool{}
+	for _, image := range images {
+		remaining[image.ID] = true
+	}
+	for _, id := range imageIDs {
+		if !remaining[id] {
+			return ErrInvalidImageOrder
+		}
+		delete(remaining, id)
+	}
+	return nil
+}
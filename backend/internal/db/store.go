@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrDuplicateSetNumber is returned when a create or update would give two
+// sets the same set number
+var ErrDuplicateSetNumber = errors.New("set number already exists")
+
+// ErrImageNotFound is returned for a set image that doesn't exist or belongs
+// to another set
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrInvalidImageOrder is returned when a new image order doesn't list each
+// of a set's images exactly once
+var ErrInvalidImageOrder = errors.New("image order must list each of the set's images once")
+
+// LegoSetStore is the storage interface used by handlers and services.
+// LegoSetRepository implements it on top of SQL and MemoryLegoSetRepository
+// keeps everything in memory for tests.
+type LegoSetStore interface {
+	// Create assigns a new ID and timestamps and inserts the set. Its
+	// ImageFilename, if any, becomes its primary image.
+	Create(set *models.LegoSet) error
+	// GetByID returns nil, nil when no set has the given ID
+	GetByID(id string) (*models.LegoSet, error)
+	// GetBySetNumber returns nil, nil when no set has the given set number
+	GetBySetNumber(setNumber string) (*models.LegoSet, error)
+	// GetAll filters on "series" (string), "owned" (bool) and "search" (a
+	// string matched like Search), and sorts on validSortFields
+	GetAll(filters map[string]interface{}, sortBy, sortOrder string) ([]*models.LegoSet, error)
+	// EachSet calls fn with the sets GetAll would return, one at a time,
+	// without holding them all in memory. It stops at the first error from
+	// fn or when ctx is done. fn must not use the store.
+	EachSet(ctx context.Context, filters map[string]interface{}, sortBy, sortOrder string, fn func(*models.LegoSet) error) error
+	Search(searchTerm string) ([]*models.LegoSet, error)
+	// Update applies column name to value updates and bumps updated_at.
+	// Setting image_filename replaces the file of the set's primary image,
+	// or adds a primary image if there is none. Clearing it removes the
+	// primary image.
+	Update(id string, updates map[string]interface{}) error
+	Delete(id string) error
+	GetStatistics() (*models.Statistics, error)
+	GetAllSeries() ([]string, error)
+
+	// GetBySetNumbers looks up many sets at once, keyed by lowercased set
+	// number. Set numbers that don't exist are left out.
+	GetBySetNumbers(setNumbers []string) (map[string]*models.LegoSet, error)
+	// CreateMany inserts sets like Create, using multi-row inserts. Either
+	// every set is inserted or none are.
+	CreateMany(sets []*models.LegoSet) error
+	// Restore writes a set with its own ID and timestamps, inserting it or
+	// replacing the set that has the same ID. Missing IDs and timestamps
+	// are filled in. ImageFilename sets the primary image like Update.
+	Restore(set *models.LegoSet) error
+	// ListImages returns a set's images in display order
+	ListImages(setID string) ([]*models.SetImage, error)
+	// ListAllImages returns every set's images, grouped by set and in
+	// display order within each set
+	ListAllImages() ([]*models.SetImage, error)
+	// GetImage returns nil, nil when the set has no image with the given ID
+	GetImage(setID, imageID string) (*models.SetImage, error)
+	// AddImage assigns a new ID and puts the image after the set's other
+	// images. It becomes the primary image if the set has none.
+	AddImage(image *models.SetImage) error
+	// UpdateImage writes an image's caption and kind
+	UpdateImage(image *models.SetImage) error
+	// ReorderImages sets the display order of a set's images. imageIDs must
+	// list each of them once.
+	ReorderImages(setID string, imageIDs []string) error
+	// SetPrimaryImage makes an image the set's primary image and its
+	// image_filename
+	SetPrimaryImage(setID, imageID string) error
+	// DeleteImage removes an image. If it was the primary image, the next
+	// image in display order becomes primary.
+	DeleteImage(setID, imageID string) error
+
+	// RunInTx runs fn against a store bound to a single transaction. The
+	// transaction commits if fn returns nil and rolls back otherwise.
+	RunInTx(fn func(store LegoSetStore) error) error
+}
+
+var (
+	_ LegoSetStore = (*LegoSetRepository)(nil)
+	_ LegoSetStore = (*MemoryLegoSetRepository)(nil)
+)
+
+// validSortFields lists the columns GetAll may sort by
+var validSortFields = map[string]bool{
+	"title":             true,
+	"set_number":        true,
+	"release_year":      true,
+	"approximate_value": true,
+	"num_parts":         true,
+	"created_at":        true,
+}
+
+// fillRestoreDefaults gives a set being restored an ID and timestamps if it
+// has none
+func fillRestoreDefaults(set *models.LegoSet) {
+	if set.ID == "" {
+		set.ID = uuid.New().String()
+	}
+	if set.CreatedAt.IsZero() {
+		set.CreatedAt = time.Now()
+	}
+	if set.UpdatedAt.IsZero() {
+		set.UpdatedAt = set.CreatedAt
+	}
+}
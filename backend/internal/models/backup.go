@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// BackupFormatVersion is the current version of the backup bundle format.
+// Version 2 holds every image of each set, not just its primary image.
+const BackupFormatVersion = 2
+
+// BackupManifest describes a backup bundle. It is stored as manifest.json
+// alongside the image files under images/.
+type BackupManifest struct {
+	FormatVersion int           `json:"formatVersion"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	Catalog       CatalogExport `json:"catalog"`
+	Images        []BackupImage `json:"images"`
+	// MissingImages lists images sets referred to that weren't on disk
+	// when the backup was made
+	MissingImages []ImageReference `json:"missingImages,omitempty"`
+}
+
+// BackupImage is an image file in a backup bundle
+type BackupImage struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// ImageReference is a set's reference to an image file
+type ImageReference struct {
+	SetID     string `json:"setId"`
+	SetNumber string `json:"setNumber"`
+	Filename  string `json:"filename"`
+}
+
+// RestoreResult reports what restoring a backup bundle did
+type RestoreResult struct {
+	Sets           *ImportResult `json:"sets"`
+	ImagesRestored int           `json:"imagesRestored"`
+	// ImagesUnchanged counts images already on disk with the same contents
+	ImagesUnchanged int `json:"imagesUnchanged"`
+	// ImagesKept counts images left alone because a different file with
+	// the same name exists and the strategy isn't overwrite
+	ImagesKept int `json:"imagesKept"`
+	// DanglingImages lists sets whose image is neither in the bundle nor on disk
+	DanglingImages []ImageReference `json:"danglingImages"`
+	// UnreferencedImages lists images in the bundle that no set uses; they
+	// aren't restored
+	UnreferencedImages []string `json:"unreferencedImages"`
+	Errors             []string `json:"errors"`
+}
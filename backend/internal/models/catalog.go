@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CatalogSchemaVersion is the current version of the JSON export format.
+// Version 2 added the sets' images.
+const CatalogSchemaVersion = 2
+
+// CatalogExport is a full-fidelity JSON export of the catalog
+type CatalogExport struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	ExportedAt    time.Time  `json:"exportedAt"`
+	Count         int        `json:"count"`
+	Sets          []*LegoSet `json:"sets"`
+	// Images are the sets' images, grouped by set in display order. The
+	// primary image of each set is also its ImageFilename.
+	Images []*SetImage `json:"images,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// ImageURLs are the URLs of a set's image and its resized variants
+type ImageURLs struct {
+	Original  string `json:"original"`
+	Thumbnail string `json:"thumbnail"`
+	Medium    string `json:"medium"`
+	Full      string `json:"full"`
+}
+
+// SetImage is one of the photos of a set. A set with images has one primary
+// image, whose filename is also the set's ImageFilename.
+type SetImage struct {
+	ID       string  `json:"id" db:"id"`
+	SetID    string  `json:"setId" db:"set_id"`
+	Filename string  `json:"filename" db:"filename"`
+	Caption  *string `json:"caption,omitempty" db:"caption"`
+	// Kind is one of SetImageKinds
+	Kind      *string    `json:"kind,omitempty" db:"kind"`
+	SortOrder int        `json:"sortOrder" db:"sort_order"`
+	IsPrimary bool       `json:"isPrimary" db:"is_primary"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	URLs      *ImageURLs `json:"urls,omitempty" db:"-"`
+}
+
+// SetImageKinds are the kinds of photo a set image can be
+var SetImageKinds = map[string]bool{
+	"box_front": true,
+	"box_back":  true,
+	"built":     true,
+	"minifig":   true,
+	"other":     true,
+}
+
+// BulkImageResult reports what a bulk image upload did
+type BulkImageResult struct {
+	DryRun  bool             `json:"dryRun"`
+	Matched []BulkImageMatch `json:"matched"`
+	// Unmatched lists files whose names don't contain a set number in the
+	// catalog
+	Unmatched []string             `json:"unmatched"`
+	Rejected  []BulkImageRejection `json:"rejected"`
+}
+
+// BulkImageMatch is a file from a bulk upload stored as one of a set's images
+type BulkImageMatch struct {
+	File          string `json:"file"`
+	SetID         string `json:"setId"`
+	SetNumber     string `json:"setNumber"`
+	ImageFilename string `json:"imageFilename"`
+	// Replaced is the primary image the set had before, if any
+	Replaced string `json:"replaced,omitempty"`
+	// Added is set for a file added to the set's images rather than made
+	// its primary image
+	Added bool `json:"added,omitempty"`
+}
+
+// BulkImageRejection is a file from a bulk upload that matched a set but
+// couldn't be used
+type BulkImageRejection struct {
+	File      string `json:"file"`
+	SetNumber string `json:"setNumber,omitempty"`
+	Reason    string `json:"reason"`
+}
@@ -0,0 +1,80 @@
+package models
+
+// ImportAction is what an import does, or would do, with a row
+type ImportAction string
+
+const (
+	ImportActionCreate ImportAction = "create"
+	ImportActionUpdate ImportAction = "update"
+	ImportActionSkip   ImportAction = "skip"
+	ImportActionError  ImportAction = "error"
+)
+
+// ImportStrategy decides what an import does with rows for sets that
+// already exist
+type ImportStrategy string
+
+const (
+	// ImportStrategySkip leaves existing sets untouched
+	ImportStrategySkip ImportStrategy = "skip"
+	// ImportStrategyOverwrite replaces every column present in the file,
+	// clearing values whose cells are empty
+	ImportStrategyOverwrite ImportStrategy = "overwrite"
+	// ImportStrategyMerge only replaces values whose cells aren't empty
+	ImportStrategyMerge ImportStrategy = "merge"
+)
+
+// Valid reports whether s is a known strategy
+func (s ImportStrategy) Valid() bool {
+	switch s {
+	case ImportStrategySkip, ImportStrategyOverwrite, ImportStrategyMerge:
+		return true
+	}
+	return false
+}
+
+// FieldWarning reports a value that couldn't be used as given
+type FieldWarning struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldChange records a value changed by an import
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// ImportRowResult reports what happened to a single imported row. Line is
+// the CSV line, or the set's position in the file for JSON imports.
+type ImportRowResult struct {
+	Line      int            `json:"line"`
+	ID        string         `json:"id,omitempty"`
+	SetNumber string         `json:"setNumber"`
+	Title     string         `json:"title,omitempty"`
+	Action    ImportAction   `json:"action"`
+	Reason    string         `json:"reason,omitempty"`
+	Warnings  []FieldWarning `json:"warnings,omitempty"`
+	Changes   []FieldChange  `json:"changes,omitempty"`
+}
+
+// ImportResult summarizes an import. In a dry run, or when an atomic import
+// is rolled back, nothing is written and the counts describe what would
+// have happened.
+type ImportResult struct {
+	DryRun     bool           `json:"dryRun"`
+	Atomic     bool           `json:"atomic"`
+	RolledBack bool           `json:"rolledBack"`
+	Strategy   ImportStrategy `json:"strategy"`
+	Processed  int            `json:"processed"`
+	Imported   int            `json:"imported"`
+	Updated    int            `json:"updated"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	Warnings   int            `json:"warnings"`
+	// UnmappedColumns lists the file's columns that weren't imported
+	UnmappedColumns []string          `json:"unmappedColumns,omitempty"`
+	Errors          []string          `json:"errors"`
+	Rows            []ImportRowResult `json:"rows"`
+}
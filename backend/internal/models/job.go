@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// JobStatus is where a background job is in its lifecycle
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Finished reports whether the job has stopped for good
+func (s JobStatus) Finished() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+// Job is a background import and its progress so far
+type Job struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	Status     JobStatus    `json:"status"`
+	Filename   string       `json:"filename,omitempty"`
+	BytesTotal int64        `json:"bytesTotal"`
+	BytesRead  int64        `json:"bytesRead"`
+	Progress   ImportResult `json:"progress"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	StartedAt  *time.Time   `json:"startedAt,omitempty"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
@@ -0,0 +1,392 @@
+package services
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"lego-catalog/internal/models"
+)
+
+const (
+	// backupManifestName is the manifest's path inside a backup bundle
+	backupManifestName = "manifest.json"
+	// backupImageDir is the directory holding images inside a backup bundle
+	backupImageDir = "images/"
+	// maxBackupManifestSize caps how much of the manifest is read (100MB)
+	maxBackupManifestSize = 100 << 20
+)
+
+// BackupService creates and restores backup bundles: a zip archive with a
+// manifest of every set plus the image files the sets refer to
+type BackupService struct {
+	imageService  *ImageService
+	importService *ImportService
+	jsonService   *JSONService
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(imageService *ImageService, importService *ImportService) *BackupService {
+	return &BackupService{
+		imageService:  imageService,
+		importService: importService,
+		jsonService:   NewJSONService(),
+	}
+}
+
+// CreateBackup writes a backup bundle of sets, their images and the image
+// files. Images that can't be found are listed in the manifest rather than
+// failing the backup.
+func (s *BackupService) CreateBackup(sets []*models.LegoSet, images []*models.SetImage, writer io.Writer) (*models.BackupManifest, error) {
+	manifest := &models.BackupManifest{
+		FormatVersion: models.BackupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Catalog:       s.jsonService.NewCatalog(sets, images),
+		Images:        []models.BackupImage{},
+	}
+
+	archive := zip.NewWriter(writer)
+	seen := map[string]bool{}
+
+	for _, ref := range catalogImageReferences(&manifest.Catalog) {
+		if seen[ref.Filename] {
+			continue
+		}
+		seen[ref.Filename] = true
+
+		image, err := s.addImage(archive, ref.Filename)
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errInvalidImageFilename) {
+			manifest.MissingImages = append(manifest.MissingImages, ref)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Images = append(manifest.Images, *image)
+	}
+
+	// The manifest goes last since it carries the checksums of the images
+	// written before it
+	entry, err := archive.Create(backupManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// addImage copies a stored image into the archive, hashing it on the way
+func (s *BackupService) addImage(archive *zip.Writer, filename string) (*models.BackupImage, error) {
+	file, err := s.imageService.OpenImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Images are already compressed, so store them as they are
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     backupImageDir + filename,
+		Method:   zip.Store,
+		Modified: file.ModTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add image %s: %w", filename, err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(entry, hash), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add image %s: %w", filename, err)
+	}
+
+	return &models.BackupImage{
+		Filename: filename,
+		Size:     size,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// RestoreBackup restores the sets and images in a backup bundle. Every image
+// is checked against the manifest before anything is written, so a damaged
+// bundle is rejected as a whole. Images are written after the sets and are
+// left alone when an atomic restore rolls back, and only for sets the restore
+// wrote or found already in the catalog. An image that isn't the image its
+// name says is left out and reported in the result's Errors.
+func (s *BackupService) RestoreBackup(reader io.ReaderAt, size int64, opts ImportOptions) (*models.RestoreResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+	// The per-row reports say which sets' images to restore
+	opts.SummaryOnly = false
+
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, &ImportFileError{fmt.Errorf("invalid backup archive: %w", err)}
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	manifest, err := s.readManifest(files[backupManifestName])
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	images, err := verifyBackupImages(manifest, files)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	result := &models.RestoreResult{
+		DanglingImages:     []models.ImageReference{},
+		UnreferencedImages: []string{},
+		Errors:             []string{},
+	}
+
+	// Restoring leaves out images that aren't named after their set, so
+	// they don't count as referenced. referenced maps the rest to their set.
+	referenced := map[string]string{}
+	for _, ref := range catalogImageReferences(&manifest.Catalog) {
+		if !imageBelongsToSet(ref.SetID, ref.Filename) || referenced[ref.Filename] != "" {
+			continue
+		}
+		referenced[ref.Filename] = ref.SetID
+		if images[ref.Filename] == nil && !s.imageService.ImageExists(ref.Filename) {
+			result.DanglingImages = append(result.DanglingImages, ref)
+		}
+	}
+	for _, image := range manifest.Images {
+		if referenced[image.Filename] == "" {
+			result.UnreferencedImages = append(result.UnreferencedImages, image.Filename)
+		}
+	}
+
+	result.Sets, err = s.importService.ImportCatalog(&manifest.Catalog, opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.Sets.RolledBack {
+		return result, nil
+	}
+
+	kept, err := s.keptSets(result.Sets)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range manifest.Images {
+		if setID := referenced[image.Filename]; setID == "" || !kept[setID] {
+			continue
+		}
+
+		sum, _, err := s.imageService.ImageChecksum(image.Filename)
+		switch {
+		case err == nil && sum == image.SHA256:
+			result.ImagesUnchanged++
+			continue
+		case err == nil && opts.Strategy != models.ImportStrategyOverwrite:
+			result.ImagesKept++
+			continue
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		if err := s.restoreImage(images[image.Filename], image.Filename, opts.DryRun); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.ImagesRestored++
+	}
+
+	return result, nil
+}
+
+// keptSets returns the IDs of the sets a restore created or updated, or
+// skipped because they are already in the catalog. The images of sets that
+// failed or were skipped as duplicates would belong to no set.
+func (s *BackupService) keptSets(result *models.ImportResult) (map[string]bool, error) {
+	kept := map[string]bool{}
+	for _, row := range result.Rows {
+		switch row.Action {
+		case models.ImportActionCreate, models.ImportActionUpdate:
+			kept[row.ID] = true
+		case models.ImportActionSkip:
+			if row.ID == "" || kept[row.ID] {
+				continue
+			}
+			set, err := s.importService.repo.GetByID(row.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look up set %s: %w", row.ID, err)
+			}
+			kept[row.ID] = set != nil
+		}
+	}
+	return kept, nil
+}
+
+// restoreImage checks an image in the archive and copies it into the image
+// storage, unless this is a dry run
+func (s *BackupService) restoreImage(file *zip.File, filename string, dryRun bool) error {
+	entry, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to restore image %s: %w", filename, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(entry, maxImageSize+1))
+	entry.Close()
+	if err != nil {
+		return fmt.Errorf("failed to restore image %s: %w", filename, err)
+	}
+
+	img, err := decodeRestoredImage(filename, data)
+	if err != nil {
+		return fmt.Errorf("failed to restore image %s: %w", filename, err)
+	}
+	if dryRun {
+		return nil
+	}
+
+	if err := s.imageService.restoreImage(filename, data, img); err != nil {
+		return fmt.Errorf("failed to restore image %s: %w", filename, err)
+	}
+	return nil
+}
+
+// readManifest decodes and checks a bundle's manifest
+func (s *BackupService) readManifest(file *zip.File) (*models.BackupManifest, error) {
+	if file == nil {
+		return nil, fmt.Errorf("invalid backup archive: %s is missing", backupManifestName)
+	}
+
+	entry, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup archive: %w", err)
+	}
+	defer entry.Close()
+
+	decoder := json.NewDecoder(io.LimitReader(entry, maxBackupManifestSize))
+	decoder.DisallowUnknownFields()
+
+	var manifest models.BackupManifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+
+	switch {
+	case manifest.FormatVersion == 0:
+		return nil, fmt.Errorf("invalid backup manifest: missing formatVersion")
+	case manifest.FormatVersion > models.BackupFormatVersion:
+		return nil, fmt.Errorf("unsupported backup format version %d (this server reads up to %d)", manifest.FormatVersion, models.BackupFormatVersion)
+	}
+
+	if err := s.jsonService.ValidateCatalog(&manifest.Catalog); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// verifyBackupImages checks every image in the manifest against its archive
+// entry, returning the entries by filename
+func verifyBackupImages(manifest *models.BackupManifest, files map[string]*zip.File) (map[string]*zip.File, error) {
+	images := map[string]*zip.File{}
+	var problems []string
+
+	for _, image := range manifest.Images {
+		if !validImageFilename(image.Filename) {
+			problems = append(problems, fmt.Sprintf("invalid image filename %q", image.Filename))
+			continue
+		}
+
+		file := files[backupImageDir+image.Filename]
+		if file == nil {
+			problems = append(problems, fmt.Sprintf("%s is missing from the archive", image.Filename))
+			continue
+		}
+
+		sum, size, err := checksumZipFile(file)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s can't be read: %v", image.Filename, err))
+		case size != image.Size:
+			problems = append(problems, fmt.Sprintf("%s is %d bytes, expected %d", image.Filename, size, image.Size))
+		case sum != image.SHA256:
+			problems = append(problems, fmt.Sprintf("%s has checksum %s, expected %s", image.Filename, sum, image.SHA256))
+		default:
+			images[image.Filename] = file
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("backup failed verification: %s", strings.Join(problems, "; "))
+	}
+	return images, nil
+}
+
+// checksumZipFile returns the SHA-256 checksum and size of an archive entry
+func checksumZipFile(file *zip.File) (string, int64, error) {
+	entry, err := file.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer entry.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, entry)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// catalogImageReferences lists the image files a catalog's sets use: each
+// set's primary image followed by the images of sets that have one.
+// Filenames may repeat.
+func catalogImageReferences(catalog *models.CatalogExport) []models.ImageReference {
+	refs := []models.ImageReference{}
+	setNumbers := map[string]string{}
+	for _, set := range catalog.Sets {
+		if set.ImageFilename == nil || *set.ImageFilename == "" {
+			continue
+		}
+		setNumbers[set.ID] = set.SetNumber
+		refs = append(refs, models.ImageReference{
+			SetID:     set.ID,
+			SetNumber: set.SetNumber,
+			Filename:  *set.ImageFilename,
+		})
+	}
+
+	// Restoring leaves out the images of sets without a primary image
+	for _, image := range catalog.Images {
+		setNumber, ok := setNumbers[image.SetID]
+		if !ok {
+			continue
+		}
+		refs = append(refs, models.ImageReference{
+			SetID:     image.SetID,
+			SetNumber: setNumber,
+			Filename:  image.Filename,
+		})
+	}
+	return refs
+}
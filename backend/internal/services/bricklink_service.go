@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"lego-catalog/internal/models"
+)
+
+// BrickLinkList selects which sets a BrickLink XML file holds
+type BrickLinkList string
+
+const (
+	// BrickLinkInventory is the owned sets, for BrickLink's inventory upload
+	BrickLinkInventory BrickLinkList = "inventory"
+	// BrickLinkWanted is the sets not owned, as a wanted list
+	BrickLinkWanted BrickLinkList = "wanted"
+)
+
+// Valid reports whether l is a known list
+func (l BrickLinkList) Valid() bool {
+	return l == BrickLinkInventory || l == BrickLinkWanted
+}
+
+// brickLinkItemTypeSet is BrickLink's item type for sets
+const brickLinkItemTypeSet = "S"
+
+// brickLinkInventory is the root of a BrickLink XML upload file
+type brickLinkInventory struct {
+	XMLName xml.Name        `xml:"INVENTORY"`
+	Items   []brickLinkItem `xml:"ITEM"`
+}
+
+// brickLinkItem is one ITEM of a BrickLink XML file. Quantities are read as
+// strings so a bad value is reported for its row rather than failing the
+// whole file.
+type brickLinkItem struct {
+	ItemType  string `xml:"ITEMTYPE"`
+	ItemID    string `xml:"ITEMID"`
+	MinQty    string `xml:"MINQTY,omitempty"`
+	Qty       string `xml:"QTY,omitempty"`
+	Condition string `xml:"CONDITION,omitempty"`
+}
+
+// BrickLinkService reads and writes BrickLink XML inventory and wanted list
+// files
+type BrickLinkService struct{}
+
+// NewBrickLinkService creates a new BrickLink service
+func NewBrickLinkService() *BrickLinkService {
+	return &BrickLinkService{}
+}
+
+// ExportToXML writes the owned sets (inventory) or the sets not owned
+// (wanted) in BrickLink's XML upload format
+func (s *BrickLinkService) ExportToXML(sets []*models.LegoSet, list BrickLinkList, writer io.Writer) error {
+	inventory := brickLinkInventory{Items: []brickLinkItem{}}
+
+	for _, set := range sets {
+		if set.Owned != (list == BrickLinkInventory) {
+			continue
+		}
+
+		item := brickLinkItem{
+			ItemType:  brickLinkItemTypeSet,
+			ItemID:    brickLinkItemID(set),
+			MinQty:    "1",
+			Condition: brickLinkCondition(set.ConditionDescription),
+		}
+		if list == BrickLinkInventory && set.QuantityOwned > 1 {
+			item.MinQty = strconv.Itoa(set.QuantityOwned)
+		}
+		// A wanted list accepts either condition unless one is asked for
+		if list == BrickLinkWanted && item.Condition == "" {
+			item.Condition = "X"
+		}
+
+		inventory.Items = append(inventory.Items, item)
+	}
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(inventory); err != nil {
+		return fmt.Errorf("failed to write XML: %w", err)
+	}
+	_, err := io.WriteString(writer, "\n")
+	return err
+}
+
+// ParseXML reads a BrickLink XML file into import rows. Items from an
+// inventory are owned, with MINQTY (or QTY) as the quantity; items from a
+// wanted list are new sets that aren't owned. BrickLink files don't name
+// their sets, so titles come from catalog, a Rebrickable sets dump, when it
+// isn't nil, and otherwise new sets are titled with their set number.
+func (s *BrickLinkService) ParseXML(reader io.Reader, list BrickLinkList, catalog *RebrickableCatalog) (*CSVHeader, []*CSVRow, error) {
+	var inventory brickLinkInventory
+	if err := xml.NewDecoder(reader).Decode(&inventory); err != nil {
+		return nil, nil, fmt.Errorf("invalid BrickLink XML: %w", err)
+	}
+
+	header := &CSVHeader{Fields: []string{"set_number", "bricklink_url", "condition_description"}}
+	if list == BrickLinkInventory {
+		header.Fields = append(header.Fields, "owned", "quantity_owned")
+	}
+	if catalog != nil {
+		header.Fields = append(header.Fields, rebrickableFields...)
+	}
+
+	var rows []*CSVRow
+	bySetNumber := map[string]*CSVRow{}
+
+	for i, item := range inventory.Items {
+		itemID := strings.TrimSpace(item.ItemID)
+		isSet := strings.EqualFold(strings.TrimSpace(item.ItemType), brickLinkItemTypeSet)
+
+		quantity := 1
+		quantityWarning := ""
+		if value := strings.TrimSpace(firstNonEmpty(item.MinQty, item.Qty)); value != "" {
+			var ok bool
+			if quantity, ok = parseCSVCount(value); !ok {
+				quantityWarning = fmt.Sprintf("unparseable quantity %q", value)
+			}
+		}
+
+		// Several lots of the same set are added up into the first one
+		key := strings.ToLower(rebrickableSetNumber(itemID))
+		if first := bySetNumber[key]; isSet && first != nil {
+			if quantityWarning == "" && first.Filled["quantity_owned"] {
+				first.Set.QuantityOwned += quantity
+			}
+			continue
+		}
+
+		// Items are numbered from 1 in place of line numbers
+		row := &CSVRow{
+			Line:   i + 1,
+			Set:    &models.CreateLegoSetRequest{},
+			Filled: map[string]bool{},
+		}
+		rows = append(rows, row)
+
+		if !isSet {
+			// Leaving the set number empty makes the row fail
+			row.Warnings = append(row.Warnings, models.FieldWarning{
+				Field:   "set_number",
+				Message: fmt.Sprintf("item %s has type %q, which isn't a set", itemID, item.ItemType),
+			})
+			continue
+		}
+
+		bySetNumber[key] = row
+		row.Set.SetNumber = rebrickableSetNumber(itemID)
+		row.Filled["set_number"] = true
+
+		link := brickLinkURL(itemID)
+		row.Set.BricklinkURL = &link
+		row.Filled["bricklink_url"] = true
+
+		if condition := brickLinkConditionDescription(item.Condition); condition != "" {
+			row.Set.ConditionDescription = &condition
+			row.Filled["condition_description"] = true
+		}
+
+		if list == BrickLinkInventory {
+			if quantityWarning != "" {
+				row.Warnings = append(row.Warnings,
+					models.FieldWarning{Field: "quantity_owned", Message: quantityWarning},
+					models.FieldWarning{Field: "owned", Message: quantityWarning})
+			} else {
+				row.Set.QuantityOwned = quantity
+				row.Set.Owned = quantity > 0
+				row.Filled["quantity_owned"] = true
+				row.Filled["owned"] = true
+			}
+		}
+
+		if catalog == nil || !catalog.fill(row, itemID) {
+			// Title a new set with its number; existing titles are left alone
+			// since the title isn't marked as filled
+			row.Set.Title = row.Set.SetNumber
+			row.Warnings = append(row.Warnings, models.FieldWarning{
+				Field:   "title",
+				Message: fmt.Sprintf("no title for set %s; a new set is titled with its number", itemID),
+			})
+		}
+	}
+
+	return header, rows, nil
+}
+
+// brickLinkItemID returns a set's BrickLink item ID, taken from its
+// BrickLink URL when it has one and otherwise the set number with the "-1"
+// of a first version added
+func brickLinkItemID(set *models.LegoSet) string {
+	if set.BricklinkURL != nil {
+		if u, err := url.Parse(*set.BricklinkURL); err == nil {
+			if id := u.Query().Get("S"); id != "" {
+				return id
+			}
+		}
+	}
+
+	if strings.Contains(set.SetNumber, "-") {
+		return set.SetNumber
+	}
+	return set.SetNumber + "-1"
+}
+
+// brickLinkURL returns a set's BrickLink catalog page
+func brickLinkURL(itemID string) string {
+	if !strings.Contains(itemID, "-") {
+		itemID += "-1"
+	}
+	return "https://www.bricklink.com/v2/catalog/catalogitem.page?S=" + url.QueryEscape(itemID)
+}
+
+// brickLinkCondition maps a free text condition to BrickLink's N (new) or U
+// (used), or "" when it can't tell
+func brickLinkCondition(description *string) string {
+	if description == nil {
+		return ""
+	}
+
+	text := strings.ToLower(*description)
+	for _, word := range []string{"used", "opened", "built", "assembled", "incomplete", "like new"} {
+		if strings.Contains(text, word) {
+			return "U"
+		}
+	}
+	for _, word := range []string{"new", "sealed", "misb", "nisb", "mint"} {
+		if strings.Contains(text, word) {
+			return "N"
+		}
+	}
+	return ""
+}
+
+// brickLinkConditionDescription maps BrickLink's condition codes to text
+func brickLinkConditionDescription(condition string) string {
+	switch strings.ToUpper(strings.TrimSpace(condition)) {
+	case "N":
+		return "New"
+	case "U":
+		return "Used"
+	default:
+		return ""
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"io"
+
+	"lego-catalog/internal/models"
+)
+
+// bricksetFields maps the Brickset collection export columns the importer
+// understands, by normalized header, to the fields they fill
+var bricksetFields = map[string]string{
+	"number":   "set_number",
+	"variant":  "set_number",
+	"name":     "title",
+	"year":     "release_year",
+	"theme":    "series",
+	"subtheme": "series",
+	"pieces":   "num_parts",
+	"minifigs": "num_minifigs",
+	"owned":    "owned",
+	"qtyowned": "quantity_owned",
+	"wanted":   "owned",
+}
+
+// BricksetService reads collection exports from Brickset
+type BricksetService struct{}
+
+// NewBricksetService creates a new Brickset service
+func NewBricksetService() *BricksetService {
+	return &BricksetService{}
+}
+
+// ParseCSV reads a Brickset collection export into import rows. Number and
+// Variant make the set number, Name the title, and Theme and Subtheme the
+// series. Owned and QtyOwned give the quantity owned. A set marked Wanted
+// without either is imported as not owned. Columns the importer doesn't use are listed in the
+// header's Unmapped.
+func (s *BricksetService) ParseCSV(reader io.Reader) (*CSVHeader, []*CSVRow, error) {
+	file, err := newNamedCSV(reader, "Brickset export", nil, "Number", "Name")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := &CSVHeader{Fields: make([]string, len(file.header))}
+	for i, name := range file.header {
+		field, ok := bricksetFields[normalizeHeader(name)]
+		if !ok {
+			header.Unmapped = append(header.Unmapped, name)
+		}
+		header.Fields[i] = field
+	}
+	// Owned and QtyOwned each fill in both whether a set is owned and how
+	// many, so list both fields if either column is there
+	if header.Has("owned") || header.Has("quantity_owned") {
+		header.Fields = append(header.Fields, "owned", "quantity_owned")
+	}
+
+	var rows []*CSVRow
+	for {
+		record, err := file.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		rows = append(rows, bricksetRow(file, record))
+	}
+
+	return header, rows, nil
+}
+
+// bricksetRow converts one record of a Brickset export
+func bricksetRow(file *namedCSV, record []string) *CSVRow {
+	row := &CSVRow{Line: file.Line(), Set: &models.CreateLegoSetRequest{}, Filled: map[string]bool{}}
+	set := row.Set
+	warn := func(field, message string) {
+		row.Warnings = append(row.Warnings, models.FieldWarning{Field: field, Message: message})
+	}
+	var ok bool
+
+	set.SetNumber = bricksetSetNumber(file.Value(record, "Number"), file.Value(record, "Variant"))
+	row.Filled["set_number"] = set.SetNumber != ""
+
+	set.Title = file.Value(record, "Name")
+	row.Filled["title"] = set.Title != ""
+
+	if value := file.Value(record, "Year"); value != "" {
+		if set.ReleaseYear, ok = parseCSVYear(value); ok {
+			row.Filled["release_year"] = true
+		} else {
+			warn("release_year", fmt.Sprintf("unparseable release year %q", value))
+		}
+	}
+
+	series := file.Value(record, "Theme")
+	if subtheme := file.Value(record, "Subtheme"); subtheme != "" && series != "" {
+		series += " / " + subtheme
+	}
+	set.Series = stringToPtr(series)
+	row.Filled["series"] = series != ""
+
+	if value := file.Value(record, "Pieces"); value != "" {
+		if set.NumParts, ok = parseCSVCount(value); ok {
+			row.Filled["num_parts"] = true
+		} else {
+			warn("num_parts", fmt.Sprintf("unparseable number of parts %q", value))
+		}
+	}
+
+	if value := file.Value(record, "Minifigs"); value != "" {
+		if set.NumMinifigs, ok = parseCSVCount(value); ok {
+			row.Filled["num_minifigs"] = true
+		} else {
+			warn("num_minifigs", fmt.Sprintf("unparseable number of minifigs %q", value))
+		}
+	}
+
+	// QtyOwned is a count; Owned may be a count or a yes/no flag
+	value := file.Value(record, "QtyOwned")
+	if value == "" {
+		value = file.Value(record, "Owned")
+	}
+	if value != "" {
+		if quantity, isCount := parseCSVCount(value); isCount {
+			set.QuantityOwned = quantity
+			set.Owned = quantity > 0
+		} else if owned, isBool := parseCSVBool(value); isBool {
+			set.Owned = owned
+			if owned {
+				set.QuantityOwned = 1
+			}
+		} else {
+			warn("quantity_owned", fmt.Sprintf("unparseable quantity owned %q", value))
+			warn("owned", fmt.Sprintf("unparseable quantity owned %q", value))
+			return row
+		}
+		row.Filled["owned"] = true
+		row.Filled["quantity_owned"] = true
+		return row
+	}
+
+	// Without either, a wanted set is one that isn't owned
+	if value := file.Value(record, "Wanted"); value != "" {
+		if wanted, isBool := parseCSVBool(value); !isBool {
+			warn("owned", fmt.Sprintf("unparseable wanted flag %q", value))
+		} else if wanted {
+			set.Owned = false
+			set.QuantityOwned = 0
+			row.Filled["owned"] = true
+			row.Filled["quantity_owned"] = true
+		}
+	}
+
+	return row
+}
+
+// bricksetSetNumber joins Brickset's Number and Variant, leaving off the
+// variant of a set's first version to match this catalog's set numbers
+func bricksetSetNumber(number, variant string) string {
+	if variant == "" {
+		return rebrickableSetNumber(number)
+	}
+	if variant == "1" {
+		return number
+	}
+	return number + "-" + variant
+}
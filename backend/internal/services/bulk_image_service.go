@@ -0,0 +1,226 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"regexp"
+	"strings"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+)
+
+// bulkImageSetNumber matches a word that looks like a set number, with an
+// optional BrickLink style variant suffix, as in 10276 or 10276-1
+var bulkImageSetNumber = regexp.MustCompile(`^(\d+)(-\d+)?$`)
+
+// BulkImageOptions controls a bulk image upload
+type BulkImageOptions struct {
+	// DryRun reports the matches without storing anything
+	DryRun bool
+	// Replace lets the first file matched to a set replace its primary
+	// image. Without it, files for a set that has one are added to its
+	// images.
+	Replace bool
+}
+
+// BulkImageService stores many set images at once from a zip archive,
+// matching files to sets by the set numbers in their names
+type BulkImageService struct {
+	repo         db.LegoSetStore
+	imageService *ImageService
+}
+
+// NewBulkImageService creates a new bulk image service
+func NewBulkImageService(repo db.LegoSetStore, imageService *ImageService) *BulkImageService {
+	return &BulkImageService{
+		repo:         repo,
+		imageService: imageService,
+	}
+}
+
+// ImportZip stores the images in a zip archive. A file matches the first
+// word of its name, split on underscores, spaces and dots, that looks like
+// a set number and is one in the catalog, with or without a variant suffix:
+// 10276.jpg, 10276-1_box.png and "shelf 10276.jpg" all match set 10276.
+// The first file matched to a set without a primary image becomes it, and
+// with opts.Replace the first file replaces an existing one. Other files
+// are added to the set's images.
+func (s *BulkImageService) ImportZip(reader io.ReaderAt, size int64, opts BulkImageOptions) (*models.BulkImageResult, error) {
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return nil, &ImportFileError{fmt.Errorf("invalid zip archive: %w", err)}
+	}
+
+	result := &models.BulkImageResult{
+		DryRun:    opts.DryRun,
+		Matched:   []models.BulkImageMatch{},
+		Unmatched: []string{},
+		Rejected:  []models.BulkImageRejection{},
+	}
+
+	// claimed holds the IDs of sets an earlier file was matched to
+	claimed := map[string]bool{}
+	for _, file := range archive.File {
+		if skipBulkImageEntry(file) {
+			continue
+		}
+
+		set, err := s.matchSet(path.Base(file.Name))
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			result.Unmatched = append(result.Unmatched, file.Name)
+			continue
+		}
+
+		reject := func(reason string) {
+			result.Rejected = append(result.Rejected, models.BulkImageRejection{
+				File:      file.Name,
+				SetNumber: set.SetNumber,
+				Reason:    reason,
+			})
+		}
+		if _, err := imageExtension(file.Name); err != nil {
+			reject(err.Error())
+			continue
+		}
+		if file.UncompressedSize64 > maxImageSize {
+			reject(fmt.Sprintf("%v: over %dMB", ErrImageTooLarge, maxImageSize>>20))
+			continue
+		}
+
+		hasPrimary := set.ImageFilename != nil && *set.ImageFilename != ""
+		match := models.BulkImageMatch{
+			File:      file.Name,
+			SetID:     set.ID,
+			SetNumber: set.SetNumber,
+			Added:     claimed[set.ID] || (hasPrimary && !opts.Replace),
+		}
+		if hasPrimary && !match.Added {
+			match.Replaced = *set.ImageFilename
+		}
+		if !opts.DryRun {
+			if match.ImageFilename, err = s.storeImage(file, set, match.Added); err != nil {
+				reject(err.Error())
+				continue
+			}
+		}
+
+		claimed[set.ID] = true
+		result.Matched = append(result.Matched, match)
+	}
+
+	return result, nil
+}
+
+// matchSet finds the set a file is named after, or nil
+func (s *BulkImageService) matchSet(name string) (*models.LegoSet, error) {
+	for _, setNumber := range bulkImageSetNumbers(name) {
+		set, err := s.repo.GetBySetNumber(setNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up set %s: %w", setNumber, err)
+		}
+		if set != nil {
+			return set, nil
+		}
+	}
+	return nil, nil
+}
+
+// storeImage saves an archive entry as a set's primary image, or as another
+// of its images if add is set, and returns the stored filename. The set's
+// previous primary image is removed once a new one is saved.
+func (s *BulkImageService) storeImage(file *zip.File, set *models.LegoSet, add bool) (string, error) {
+	entry, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	defer entry.Close()
+
+	// The size in the archive header can't be trusted, so read one byte past
+	// the limit for SaveImage to catch a file bigger than it claims
+	data, err := io.ReadAll(io.LimitReader(entry, maxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+
+	header := &multipart.FileHeader{Filename: path.Base(file.Name), Size: int64(len(data))}
+	if add {
+		filename, err := s.imageService.SaveSetImage(bulkImageFile{bytes.NewReader(data)}, header, set.ID, set.SetNumber)
+		if err != nil {
+			return "", err
+		}
+		if err := s.repo.AddImage(&models.SetImage{SetID: set.ID, Filename: filename}); err != nil {
+			s.imageService.DeleteImage(filename)
+			return "", fmt.Errorf("failed to add image: %w", err)
+		}
+		return filename, nil
+	}
+
+	filename, err := s.imageService.SaveImage(bulkImageFile{bytes.NewReader(data)}, header, set.ID, set.SetNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.Update(set.ID, map[string]interface{}{"image_filename": filename}); err != nil {
+		s.imageService.DeleteImage(filename)
+		return "", fmt.Errorf("failed to update set: %w", err)
+	}
+	if set.ImageFilename != nil && *set.ImageFilename != filename {
+		s.imageService.DeleteImage(*set.ImageFilename)
+	}
+	return filename, nil
+}
+
+// bulkImageFile is an archive entry read into memory, which SaveImage can
+// take like an uploaded file
+type bulkImageFile struct {
+	*bytes.Reader
+}
+
+func (bulkImageFile) Close() error {
+	return nil
+}
+
+// skipBulkImageEntry reports whether an archive entry is a directory or
+// hidden file, such as the __MACOSX folder macOS adds to zips
+func skipBulkImageEntry(file *zip.File) bool {
+	if file.FileInfo().IsDir() {
+		return true
+	}
+	for _, part := range strings.Split(file.Name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// bulkImageSetNumbers lists the set numbers a file name could refer to, in
+// the order they are tried. Only words that look like set numbers are, so
+// words like "box" can't match a set.
+func bulkImageSetNumbers(name string) []string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == ' ' || r == '.'
+	})
+
+	var setNumbers []string
+	for _, word := range words {
+		match := bulkImageSetNumber.FindStringSubmatch(word)
+		if match == nil {
+			continue
+		}
+		setNumbers = append(setNumbers, word)
+		if match[2] != "" {
+			setNumbers = append(setNumbers, match[1])
+		}
+	}
+	return setNumbers
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark Excel looks for to read a CSV file as UTF-8
+const utf8BOM = "\ufeff"
+
+// CSVDialect describes the conventions of a CSV file. The zero value is the
+// default export format: commas, decimal points, YYYY-MM-DD dates and no
+// byte order mark. On import, zero fields are detected from the file.
+type CSVDialect struct {
+	// Delimiter separates fields. On import 0 detects it from the header
+	// row.
+	Delimiter rune
+	// DecimalSeparator is '.' or ',' in approximate values. On import 0
+	// accepts either when a value is unambiguous, such as 549,99 or 549.99.
+	DecimalSeparator rune
+	// DateFormat is the format of Value Last Updated, written with YYYY, MM
+	// and DD, such as "DD.MM.YYYY". On import "" accepts YYYY-MM-DD and
+	// DD.MM.YYYY.
+	DateFormat string
+	// BOM starts an export with a UTF-8 byte order mark. Imports skip a byte
+	// order mark either way.
+	BOM bool
+}
+
+// CSVDialectExcelEU is what Excel reads and writes with most continental
+// European locales
+var CSVDialectExcelEU = CSVDialect{Delimiter: ';', DecimalSeparator: ',', DateFormat: "DD.MM.YYYY", BOM: true}
+
+// csvDialects are the dialects that can be chosen by name
+var csvDialects = map[string]CSVDialect{
+	"default":  {},
+	"excel-eu": CSVDialectExcelEU,
+}
+
+// CSVDialectByName returns a named dialect: "default" or "excel-eu"
+func CSVDialectByName(name string) (CSVDialect, bool) {
+	dialect, ok := csvDialects[strings.ToLower(name)]
+	return dialect, ok
+}
+
+// csvDelimiters are the delimiters import detects
+var csvDelimiters = []rune{',', ';', '\t', '|'}
+
+// Validate checks that the dialect can be read and written
+func (d CSVDialect) Validate() error {
+	switch d.Delimiter {
+	case 0:
+	case '"', '\r', '\n', utf8.RuneError:
+		return fmt.Errorf("invalid delimiter %q", d.Delimiter)
+	}
+	if d.DecimalSeparator != 0 && d.DecimalSeparator != '.' && d.DecimalSeparator != ',' {
+		return fmt.Errorf("invalid decimal separator %q, expected . or ,", d.DecimalSeparator)
+	}
+	if d.DecimalSeparator != 0 && d.DecimalSeparator == d.Delimiter {
+		return fmt.Errorf("the decimal separator and delimiter are both %q", d.Delimiter)
+	}
+	if d.DateFormat != "" {
+		if _, err := csvDateLayout(d.DateFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d CSVDialect) delimiter() rune {
+	if d.Delimiter == 0 {
+		return ','
+	}
+	return d.Delimiter
+}
+
+// formatMoney writes an amount with two decimals
+func (d CSVDialect) formatMoney(f *float64) string {
+	value := float64PtrToString(f)
+	if d.DecimalSeparator == ',' {
+		value = strings.Replace(value, ".", ",", 1)
+	}
+	return value
+}
+
+// formatDate writes a date in the dialect's date format
+func (d CSVDialect) formatDate(t *time.Time) string {
+	if t == nil || d.DateFormat == "" {
+		return timePtrToString(t)
+	}
+	layout, _ := csvDateLayout(d.DateFormat)
+	return t.Format(layout)
+}
+
+// parseMoney parses a non-negative amount, allowing a leading $; empty is nil
+func (d CSVDialect) parseMoney(s string) (*float64, bool) {
+	if s == "" {
+		return nil, true
+	}
+	s = strings.TrimPrefix(s, "$")
+
+	switch d.DecimalSeparator {
+	case ',':
+		if strings.Contains(s, ".") {
+			return nil, false
+		}
+		s = strings.Replace(s, ",", ".", 1)
+	case 0:
+		// Either separator, as long as there's one and it can't be a
+		// thousands separator
+		if strings.Contains(s, ".") && strings.Contains(s, ",") {
+			return nil, false
+		}
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			if decimals := len(s) - i - 1; decimals < 1 || decimals > 2 {
+				return nil, false
+			}
+			s = s[:i] + "." + s[i+1:]
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return nil, false
+	}
+	return &f, true
+}
+
+// parseDate parses a date in the dialect's date format and returns it as
+// YYYY-MM-DD
+func (d CSVDialect) parseDate(s string) (string, bool) {
+	layouts := []string{"2006-01-02", "02.01.2006"}
+	if d.DateFormat != "" {
+		layout, _ := csvDateLayout(d.DateFormat)
+		layouts = []string{layout}
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// dateFormatName describes the dates parseDate accepts, for warnings
+func (d CSVDialect) dateFormatName() string {
+	if d.DateFormat == "" {
+		return "YYYY-MM-DD or DD.MM.YYYY"
+	}
+	return d.DateFormat
+}
+
+// csvDateLayout converts a date format written with YYYY, MM and DD to a
+// time layout
+func csvDateLayout(format string) (string, error) {
+	var layout strings.Builder
+	seen := map[string]bool{}
+	for rest := format; rest != ""; {
+		token := ""
+		for _, t := range []string{"YYYY", "MM", "DD"} {
+			if strings.HasPrefix(strings.ToUpper(rest), t) {
+				token = t
+				break
+			}
+		}
+
+		switch {
+		case token != "":
+			if seen[token] {
+				return "", fmt.Errorf("invalid date format %q: %s appears twice", format, token)
+			}
+			seen[token] = true
+			layout.WriteString(map[string]string{"YYYY": "2006", "MM": "01", "DD": "02"}[token])
+			rest = rest[len(token):]
+		case strings.ContainsRune("-./ ", rune(rest[0])):
+			layout.WriteByte(rest[0])
+			rest = rest[1:]
+		default:
+			return "", fmt.Errorf("invalid date format %q, expected YYYY, MM and DD separated by - . / or spaces", format)
+		}
+	}
+
+	if len(seen) != 3 {
+		return "", fmt.Errorf("invalid date format %q, expected YYYY, MM and DD", format)
+	}
+	return layout.String(), nil
+}
+
+// detectCSVDelimiter picks the most common of the delimiters import detects
+// outside quotes on the header line of sample, or a comma if there are none
+func detectCSVDelimiter(sample []byte) rune {
+	sample = bytes.TrimPrefix(sample, []byte(utf8BOM))
+
+	counts := map[rune]int{}
+	quoted := false
+	for _, r := range string(sample) {
+		if r == '"' {
+			quoted = !quoted
+			continue
+		}
+		if quoted {
+			continue
+		}
+		if r == '\n' || r == '\r' {
+			break
+		}
+		counts[r]++
+	}
+
+	best := ','
+	for _, delimiter := range csvDelimiters {
+		if counts[delimiter] > counts[best] {
+			best = delimiter
+		}
+	}
+	return best
+}
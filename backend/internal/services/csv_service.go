@@ -1,15 +1,214 @@
 package services
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"lego-catalog/internal/models"
 )
 
+// csvColumn describes one CSV column. Field is the lego_sets column the
+// value belongs to, Header is what export writes and Aliases are other
+// headers accepted on import.
+type csvColumn struct {
+	Field   string
+	Header  string
+	Aliases []string
+	// ExportOnly columns are written but ignored on import
+	ExportOnly bool
+}
+
+// csvColumns lists every column in export order
+var csvColumns = []csvColumn{
+	{Field: "set_number", Header: "Set Number", Aliases: []string{"Set", "Set No", "Set #", "Set Num", "Number"}},
+	{Field: "alternate_set_number", Header: "Alternate Set Number", Aliases: []string{"Alt Set Number", "Alternate Number"}},
+	{Field: "title", Header: "Title", Aliases: []string{"Name", "Set Name"}},
+	{Field: "owned", Header: "Owned", Aliases: []string{"Is Owned"}},
+	{Field: "quantity_owned", Header: "Quantity Owned", Aliases: []string{"Quantity", "Qty", "Qty Owned"}},
+	{Field: "release_year", Header: "Release Year", Aliases: []string{"Year", "Year Released"}},
+	{Field: "description", Header: "Description"},
+	{Field: "series", Header: "Series", Aliases: []string{"Theme"}},
+	{Field: "num_parts", Header: "Number of Parts", Aliases: []string{"Parts", "Pieces", "Piece Count", "Num Parts"}},
+	{Field: "num_minifigs", Header: "Number of Minifigs", Aliases: []string{"Minifigs", "Minifigures", "Num Minifigs"}},
+	{Field: "bricklink_url", Header: "Bricklink URL", Aliases: []string{"Bricklink"}},
+	{Field: "rebrickable_url", Header: "Rebrickable URL", Aliases: []string{"Rebrickable"}},
+	{Field: "approximate_value", Header: "Approximate Value", Aliases: []string{"Value", "Price"}},
+	{Field: "value_last_updated", Header: "Value Last Updated", Aliases: []string{"Value Date", "Value Updated"}},
+	{Field: "condition_description", Header: "Condition Description", Aliases: []string{"Condition"}},
+	// Image files are managed through uploads. Importing a filename could
+	// point a set at another set's image, which deleting either set removes.
+	{Field: "image_filename", Header: "Image Filename", Aliases: []string{"Image"}, ExportOnly: true},
+	{Field: "notes", Header: "Notes", Aliases: []string{"Comments"}},
+}
+
+// csvSniffSize is how much of an imported file is read to detect its
+// delimiter
+const csvSniffSize = 64 << 10
+
+// CSVTruncatedMarker starts the last row of a CSV export that failed part
+// way through
+const CSVTruncatedMarker = "# EXPORT INCOMPLETE: "
+
+// requiredCSVFields must be present in every imported file
+var requiredCSVFields = []string{"set_number", "title"}
+
+// csvHeaderAliases maps normalized headers to fields
+var csvHeaderAliases = buildCSVHeaderAliases()
+
+func buildCSVHeaderAliases() map[string]string {
+	aliases := map[string]string{}
+	for _, column := range csvColumns {
+		aliases[normalizeHeader(column.Field)] = column.Field
+		aliases[normalizeHeader(column.Header)] = column.Field
+		for _, alias := range column.Aliases {
+			aliases[normalizeHeader(alias)] = column.Field
+		}
+	}
+	return aliases
+}
+
+// normalizeHeader lowercases a header and drops everything but letters and
+// digits, so "Set #", "set_number" and "SET NUMBER" compare sensibly
+func normalizeHeader(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// CSVFields returns the field keys that can be exported, in export order
+func CSVFields() []string {
+	fields := make([]string, len(csvColumns))
+	for i, column := range csvColumns {
+		fields[i] = column.Field
+	}
+	return fields
+}
+
+// CSVImportOptions controls how ImportFromCSVWithOptions reads a file
+type CSVImportOptions struct {
+	// ColumnMapping maps CSV headers to field keys (see CSVFields) and takes
+	// precedence over the built-in header names and aliases. Mapping a
+	// header to "" ignores that column.
+	ColumnMapping map[string]string
+	// Dialect is the file's delimiter, decimal separator and date format;
+	// whatever is left zero is detected
+	Dialect CSVDialect
+}
+
+// CSVExportOptions controls how ExportToCSVWithOptions writes a file
+type CSVExportOptions struct {
+	// Fields lists the fields to write (see CSVFields), in order. Empty
+	// writes every column.
+	Fields  []string
+	Dialect CSVDialect
+}
+
+// CSVHeader is the result of matching a CSV header row to fields
+type CSVHeader struct {
+	// Fields holds the field for each column index, or "" if ignored
+	Fields []string
+	// Unmapped lists headers that didn't match any field
+	Unmapped []string
+}
+
+// Has reports whether the file contains a column for field
+func (h *CSVHeader) Has(field string) bool {
+	for _, f := range h.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// MapCSVHeader matches each header to a field using mapping first and then
+// the built-in names and aliases, case-insensitively
+func MapCSVHeader(header []string, mapping map[string]string) (*CSVHeader, error) {
+	custom := map[string]string{}
+	for from, to := range mapping {
+		if to != "" && !isCSVField(to) {
+			return nil, fmt.Errorf("invalid column mapping for %q: unknown field %q", from, to)
+		}
+		if isExportOnlyCSVField(to) {
+			return nil, fmt.Errorf("invalid column mapping for %q: %s can't be imported", from, to)
+		}
+		custom[normalizeHeader(from)] = to
+	}
+
+	result := &CSVHeader{Fields: make([]string, len(header))}
+	seen := map[string]string{}
+
+	for i, name := range header {
+		key := normalizeHeader(name)
+		field, ok := custom[key]
+		if !ok {
+			field, ok = csvHeaderAliases[key]
+		}
+		if !ok {
+			if strings.TrimSpace(name) != "" {
+				result.Unmapped = append(result.Unmapped, name)
+			}
+			continue
+		}
+		if field == "" || isExportOnlyCSVField(field) {
+			continue
+		}
+		if previous, dup := seen[field]; dup {
+			return nil, fmt.Errorf("invalid CSV format: columns %q and %q both map to %s", previous, name, field)
+		}
+		seen[field] = name
+		result.Fields[i] = field
+	}
+
+	missing := []string{}
+	for _, field := range requiredCSVFields {
+		if _, ok := seen[field]; !ok {
+			missing = append(missing, csvHeaderFor(field))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("invalid CSV format: missing required column(s): %s", strings.Join(missing, ", "))
+	}
+
+	return result, nil
+}
+
+func isCSVField(field string) bool {
+	for _, column := range csvColumns {
+		if column.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isExportOnlyCSVField(field string) bool {
+	for _, column := range csvColumns {
+		if column.Field == field {
+			return column.ExportOnly
+		}
+	}
+	return false
+}
+
+func csvHeaderFor(field string) string {
+	for _, column := range csvColumns {
+		if column.Field == field {
+			return column.Header
+		}
+	}
+	return field
+}
+
 // CSVService handles CSV import/export operations
 type CSVService struct{}
 
@@ -20,106 +219,395 @@ func NewCSVService() *CSVService {
 
 // ExportToCSV converts Lego sets to CSV format
 func (s *CSVService) ExportToCSV(sets []*models.LegoSet, writer io.Writer) error {
+	return s.ExportToCSVWithOptions(sets, CSVExportOptions{}, writer)
+}
+
+// ExportToCSVWithOptions converts Lego sets to CSV with the chosen fields
+// and dialect
+func (s *CSVService) ExportToCSVWithOptions(sets []*models.LegoSet, opts CSVExportOptions, writer io.Writer) error {
+	exporter, err := s.NewExporter(writer, opts)
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if err := exporter.Write(set); err != nil {
+			return err
+		}
+	}
+	return exporter.Close()
+}
+
+// CSVExporter writes sets as CSV one at a time, for exports streamed from
+// the database
+type CSVExporter struct {
+	writer        io.Writer
+	csvWriter     *csv.Writer
+	fields        []string
+	dialect       CSVDialect
+	row           []string
+	headerWritten bool
+}
+
+// NewExporter creates an exporter writing to writer. Nothing is written
+// until the first set, or Close.
+func (s *CSVService) NewExporter(writer io.Writer, opts CSVExportOptions) (*CSVExporter, error) {
+	if err := opts.Dialect.Validate(); err != nil {
+		return nil, err
+	}
+
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = CSVFields()
+	}
+
 	csvWriter := csv.NewWriter(writer)
-	defer csvWriter.Flush()
+	csvWriter.Comma = opts.Dialect.delimiter()
+	return &CSVExporter{
+		writer:    writer,
+		csvWriter: csvWriter,
+		fields:    fields,
+		dialect:   opts.Dialect,
+		row:       make([]string, len(fields)),
+	}, nil
+}
+
+func (e *CSVExporter) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+
+	// Nothing has gone through the CSV writer yet, so the byte order mark
+	// can go straight to the underlying writer
+	if e.dialect.BOM {
+		if _, err := io.WriteString(e.writer, utf8BOM); err != nil {
+			return err
+		}
+	}
+
+	header := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		header[i] = csvHeaderFor(field)
+	}
+	return e.csvWriter.Write(header)
+}
 
-	// Write header
-	header := []string{
-		"Set Number", "Alternate Set Number", "Title", "Owned", "Quantity Owned",
-		"Release Year", "Description", "Series", "Number of Parts", "Number of Minifigs",
-		"Bricklink URL", "Approximate Value", "Value Last Updated", "Notes",
+// Write adds a set, after the header row if this is the first
+func (e *CSVExporter) Write(set *models.LegoSet) error {
+	if err := e.writeHeader(); err != nil {
+		return err
 	}
-	if err := csvWriter.Write(header); err != nil {
+	for i, field := range e.fields {
+		e.row[i] = csvValue(set, field, e.dialect)
+	}
+	return e.csvWriter.Write(e.row)
+}
+
+// Flush writes any buffered rows to the underlying writer
+func (e *CSVExporter) Flush() error {
+	e.csvWriter.Flush()
+	return e.csvWriter.Error()
+}
+
+// Close writes the header if no sets were written and flushes
+func (e *CSVExporter) Close() error {
+	if err := e.writeHeader(); err != nil {
 		return err
 	}
+	return e.Flush()
+}
 
-	// Write data rows
-	for _, set := range sets {
-		row := []string{
-			set.SetNumber,
-			stringOrEmpty(set.AlternateSetNumber),
-			set.Title,
-			boolToString(set.Owned),
-			strconv.Itoa(set.QuantityOwned),
-			intPtrToString(set.ReleaseYear),
-			stringOrEmpty(set.Description),
-			stringOrEmpty(set.Series),
-			strconv.Itoa(set.NumParts),
-			strconv.Itoa(set.NumMinifigs),
-			stringOrEmpty(set.BricklinkURL),
-			float64PtrToString(set.ApproximateValue),
-			timePtrToString(set.ValueLastUpdated),
-			stringOrEmpty(set.Notes),
-		}
-		if err := csvWriter.Write(row); err != nil {
-			return err
+// Abort ends an export that failed part way with a final row marking the
+// file as incomplete, so it can't be mistaken for a whole export
+func (e *CSVExporter) Abort(reason string) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	if err := e.csvWriter.Write([]string{CSVTruncatedMarker + reason}); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// ParseCSVFields reads a comma separated list of columns to export. Each
+// may be a field key or any header the importer accepts for it.
+func ParseCSVFields(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		field, ok := csvHeaderAliases[normalizeHeader(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", strings.TrimSpace(name))
 		}
+		if seen[field] {
+			return nil, fmt.Errorf("field %q is listed twice", field)
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// csvValue formats one field of a set for export
+func csvValue(set *models.LegoSet, field string, dialect CSVDialect) string {
+	switch field {
+	case "set_number":
+		return set.SetNumber
+	case "alternate_set_number":
+		return stringOrEmpty(set.AlternateSetNumber)
+	case "title":
+		return set.Title
+	case "owned":
+		return boolToString(set.Owned)
+	case "quantity_owned":
+		return strconv.Itoa(set.QuantityOwned)
+	case "release_year":
+		return intPtrToString(set.ReleaseYear)
+	case "description":
+		return stringOrEmpty(set.Description)
+	case "series":
+		return stringOrEmpty(set.Series)
+	case "num_parts":
+		return strconv.Itoa(set.NumParts)
+	case "num_minifigs":
+		return strconv.Itoa(set.NumMinifigs)
+	case "bricklink_url":
+		return stringOrEmpty(set.BricklinkURL)
+	case "rebrickable_url":
+		return stringOrEmpty(set.RebrickableURL)
+	case "approximate_value":
+		return dialect.formatMoney(set.ApproximateValue)
+	case "value_last_updated":
+		return dialect.formatDate(set.ValueLastUpdated)
+	case "condition_description":
+		return stringOrEmpty(set.ConditionDescription)
+	case "image_filename":
+		return stringOrEmpty(set.ImageFilename)
+	case "notes":
+		return stringOrEmpty(set.Notes)
+	default:
+		return ""
 	}
+}
 
-	return nil
+// CSVRow is a parsed CSV data row
+type CSVRow struct {
+	// Line is the line the row starts on, counting the header as line 1
+	Line     int
+	Set      *models.CreateLegoSetRequest
+	Warnings []models.FieldWarning
+	// Filled holds the fields whose cells had a usable value
+	Filled map[string]bool
 }
 
 // ImportFromCSV parses CSV data and returns Lego sets
 func (s *CSVService) ImportFromCSV(reader io.Reader) ([]*models.CreateLegoSetRequest, error) {
+	return s.ImportFromCSVWithOptions(reader, CSVImportOptions{})
+}
+
+// ImportFromCSVWithOptions parses CSV data, matching columns by header name,
+// and returns Lego sets. Unknown columns are ignored and optional columns
+// may be missing.
+func (s *CSVService) ImportFromCSVWithOptions(reader io.Reader, opts CSVImportOptions) ([]*models.CreateLegoSetRequest, error) {
+	_, rows, err := s.ParseCSV(reader, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]*models.CreateLegoSetRequest, len(rows))
+	for i, row := range rows {
+		sets[i] = row.Set
+	}
+	return sets, nil
+}
+
+// ParseCSV parses CSV data like ImportFromCSVWithOptions, keeping each
+// row's line number and warnings for values that couldn't be parsed
+func (s *CSVService) ParseCSV(reader io.Reader, opts CSVImportOptions) (*CSVHeader, []*CSVRow, error) {
+	rowReader, err := s.NewRowReader(reader, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := []*CSVRow{}
+	for {
+		row, err := rowReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, row)
+	}
+
+	return rowReader.Header(), rows, nil
+}
+
+// CSVRowReader reads parsed rows one at a time, for files too large to
+// hold in memory
+type CSVRowReader struct {
+	reader  *csv.Reader
+	header  *CSVHeader
+	dialect CSVDialect
+}
+
+// NewRowReader reads and maps the header row and returns a reader for the
+// data rows
+func (s *CSVService) NewRowReader(reader io.Reader, opts CSVImportOptions) (*CSVRowReader, error) {
+	dialect := opts.Dialect
+	if err := dialect.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Detect the delimiter from the header row
+	if dialect.Delimiter == 0 {
+		buffered := bufio.NewReaderSize(reader, csvSniffSize)
+		sample, _ := buffered.Peek(csvSniffSize)
+		dialect.Delimiter = detectCSVDelimiter(sample)
+		reader = buffered
+	}
+
 	csvReader := csv.NewReader(reader)
+	csvReader.Comma = dialect.Delimiter
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
 
 	// Read header
-	header, err := csvReader.Read()
+	headerRow, err := csvReader.Read()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read CSV header: %w", err)
 	}
-
-	// Validate header
-	expectedHeader := []string{
-		"Set Number", "Alternate Set Number", "Title", "Owned", "Quantity Owned",
-		"Release Year", "Description", "Series", "Number of Parts", "Number of Minifigs",
-		"Bricklink URL", "Approximate Value", "Value Last Updated", "Notes",
+	if len(headerRow) > 0 {
+		headerRow[0] = strings.TrimPrefix(headerRow[0], "\ufeff")
 	}
 
-	if len(header) != len(expectedHeader) {
-		return nil, fmt.Errorf("invalid CSV format: expected %d columns, got %d", len(expectedHeader), len(header))
+	header, err := MapCSVHeader(headerRow, opts.ColumnMapping)
+	if err != nil {
+		return nil, err
 	}
 
-	sets := []*models.CreateLegoSetRequest{}
-	lineNum := 1
+	return &CSVRowReader{reader: csvReader, header: header, dialect: dialect}, nil
+}
+
+// Dialect returns the dialect the file is read with, including the detected
+// delimiter
+func (r *CSVRowReader) Dialect() CSVDialect {
+	return r.dialect
+}
+
+// Header returns how the file's columns map to fields
+func (r *CSVRowReader) Header() *CSVHeader {
+	return r.header
+}
 
+// Read returns the next non-blank row, or io.EOF at the end of the file
+func (r *CSVRowReader) Read() (*CSVRow, error) {
 	for {
-		record, err := csvReader.Read()
+		record, err := r.reader.Read()
 		if err == io.EOF {
-			break
+			return nil, io.EOF
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading CSV line %d: %w", lineNum+1, err)
+			return nil, fmt.Errorf("error reading CSV: %w", err)
 		}
 
-		lineNum++
+		line, _ := r.reader.FieldPos(0)
+		row := &CSVRow{Line: line, Set: &models.CreateLegoSetRequest{}, Filled: map[string]bool{}}
+		for i, value := range record {
+			if i >= len(r.header.Fields) || r.header.Fields[i] == "" {
+				continue
+			}
+			field := r.header.Fields[i]
+			value = strings.TrimSpace(value)
+			if message := applyCSVField(row.Set, field, value, r.dialect); message != "" {
+				row.Warnings = append(row.Warnings, models.FieldWarning{Field: field, Message: message})
+			} else if value != "" {
+				row.Filled[field] = true
+			}
+		}
 
 		// Skip empty rows
-		if len(record) == 0 || record[0] == "" {
+		if row.Set.SetNumber == "" && isBlankRecord(record) {
 			continue
 		}
 
-		set := &models.CreateLegoSetRequest{
-			SetNumber:          record[0],
-			AlternateSetNumber: stringToPtr(record[1]),
-			Title:              record[2],
-			Owned:              stringToBool(record[3]),
-			QuantityOwned:      stringToInt(record[4]),
-			ReleaseYear:        stringToIntPtr(record[5]),
-			Description:        stringToPtr(record[6]),
-			Series:             stringToPtr(record[7]),
-			NumParts:           stringToInt(record[8]),
-			NumMinifigs:        stringToInt(record[9]),
-			BricklinkURL:       stringToPtr(record[10]),
-			ApproximateValue:   stringToFloat64Ptr(record[11]),
-			ValueLastUpdated:   stringToPtr(record[12]),
-			Notes:              stringToPtr(record[13]),
-		}
+		return row, nil
+	}
+}
 
-		sets = append(sets, set)
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
 	}
+	return true
+}
 
-	return sets, nil
+// applyCSVField stores a single cell value on the request. It returns a
+// warning when the value can't be parsed, in which case the field is left
+// at its zero value.
+func applyCSVField(set *models.CreateLegoSetRequest, field, value string, dialect CSVDialect) string {
+	var ok bool
+	switch field {
+	case "set_number":
+		set.SetNumber = value
+	case "alternate_set_number":
+		set.AlternateSetNumber = stringToPtr(value)
+	case "title":
+		set.Title = value
+	case "owned":
+		if set.Owned, ok = parseCSVBool(value); !ok {
+			return fmt.Sprintf("unrecognized owned value %q, expected true or false", value)
+		}
+	case "quantity_owned":
+		if set.QuantityOwned, ok = parseCSVCount(value); !ok {
+			return fmt.Sprintf("unparseable quantity owned %q", value)
+		}
+	case "release_year":
+		if set.ReleaseYear, ok = parseCSVYear(value); !ok {
+			return fmt.Sprintf("unparseable release year %q", value)
+		}
+	case "description":
+		set.Description = stringToPtr(value)
+	case "series":
+		set.Series = stringToPtr(value)
+	case "num_parts":
+		if set.NumParts, ok = parseCSVCount(value); !ok {
+			return fmt.Sprintf("unparseable number of parts %q", value)
+		}
+	case "num_minifigs":
+		if set.NumMinifigs, ok = parseCSVCount(value); !ok {
+			return fmt.Sprintf("unparseable number of minifigs %q", value)
+		}
+	case "bricklink_url":
+		set.BricklinkURL = stringToPtr(value)
+	case "rebrickable_url":
+		set.RebrickableURL = stringToPtr(value)
+	case "approximate_value":
+		if set.ApproximateValue, ok = dialect.parseMoney(value); !ok {
+			return fmt.Sprintf("unparseable approximate value %q", value)
+		}
+	case "value_last_updated":
+		if value != "" {
+			date, ok := dialect.parseDate(value)
+			if !ok {
+				return fmt.Sprintf("unparseable value last updated date %q, expected %s", value, dialect.dateFormatName())
+			}
+			value = date
+		}
+		set.ValueLastUpdated = stringToPtr(value)
+	case "condition_description":
+		set.ConditionDescription = stringToPtr(value)
+	case "notes":
+		set.Notes = stringToPtr(value)
+	}
+	return ""
 }
 
 // Helper functions for type conversions
@@ -165,36 +653,112 @@ func stringToPtr(s string) *string {
 	return &s
 }
 
-func stringToIntPtr(s string) *int {
+// parseCSVBool accepts true/false, yes/no and 1/0 in any case; empty is false
+func parseCSVBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "1":
+		return true, true
+	case "false", "no", "n", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// parseCSVCount parses a non-negative whole number; empty is 0
+func parseCSVCount(s string) (int, bool) {
 	if s == "" {
-		return nil
+		return 0, true
 	}
 	i, err := strconv.Atoi(s)
-	if err != nil {
-		return nil
+	if err != nil || i < 0 {
+		return 0, false
 	}
-	return &i
+	return i, true
 }
 
-func stringToFloat64Ptr(s string) *float64 {
+// parseCSVYear parses a four digit year; empty is nil
+func parseCSVYear(s string) (*int, bool) {
 	if s == "" {
-		return nil
+		return nil, true
+	}
+	year, err := strconv.Atoi(s)
+	if err != nil || year < 1000 || year > 9999 {
+		return nil, false
 	}
-	f, err := strconv.ParseFloat(s, 64)
+	return &year, true
+}
+
+// namedCSV reads a CSV file from another application, finding columns by
+// their normalized header so "set_num" and "Set_Num" both work
+type namedCSV struct {
+	reader  *csv.Reader
+	header  []string
+	columns map[string]int
+}
+
+// newNamedCSV reads the header of a CSV file. aliases maps other headers a
+// column goes by to the name it is looked up with, and may be nil.
+func newNamedCSV(reader io.Reader, name string, aliases map[string]string, required ...string) (*namedCSV, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("failed to read %s header: %w", name, err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	renamed := map[string]string{}
+	for alias, column := range aliases {
+		renamed[normalizeHeader(alias)] = normalizeHeader(column)
+	}
+
+	columns := map[string]int{}
+	for i, h := range header {
+		key := normalizeHeader(h)
+		if column, ok := renamed[key]; ok {
+			key = column
+		}
+		if _, ok := columns[key]; !ok {
+			columns[key] = i
+		}
+	}
+
+	for _, column := range required {
+		if _, ok := columns[normalizeHeader(column)]; !ok {
+			return nil, fmt.Errorf("%s is missing the %s column", name, column)
+		}
 	}
-	return &f
+
+	return &namedCSV{reader: csvReader, header: header, columns: columns}, nil
 }
 
-func stringToInt(s string) int {
-	i, err := strconv.Atoi(s)
+// Read returns the next record, or io.EOF at the end of the file
+func (f *namedCSV) Read() ([]string, error) {
+	record, err := f.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
 	if err != nil {
-		return 0
+		return nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	return record, nil
+}
+
+// Value returns a record's trimmed value for a column, or "" if the file has
+// no such column
+func (f *namedCSV) Value(record []string, column string) string {
+	i, ok := f.columns[normalizeHeader(column)]
+	if !ok || i >= len(record) {
+		return ""
 	}
-	return i
+	return strings.TrimSpace(record[i])
 }
 
-func stringToBool(s string) bool {
-	return s == "true" || s == "True" || s == "TRUE" || s == "1"
+// Line returns the line the last record read starts on
+func (f *namedCSV) Line() int {
+	line, _ := f.reader.FieldPos(0)
+	return line
 }
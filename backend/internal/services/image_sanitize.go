@@ -0,0 +1,420 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Errors returned for uploads that can't be stored as images
+var (
+	// ErrUnsupportedImage is returned for files that aren't JPEG, PNG, GIF
+	// or WebP images, whatever their name says
+	ErrUnsupportedImage = errors.New("unsupported image type")
+	// ErrImageTooLarge is returned for images over maxImageSize bytes or
+	// maxImagePixels pixels
+	ErrImageTooLarge = errors.New("image is too large")
+	// ErrInvalidImage is returned for images that can't be decoded
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+const (
+	// maxImageSize caps uploaded images (10MB)
+	maxImageSize = 10 << 20
+	// maxImagePixels caps the dimensions of uploaded images, since a small
+	// file can decode to a huge bitmap (40 megapixels)
+	maxImagePixels = 40_000_000
+)
+
+// imageFormats maps the formats sniffImageFormat detects to the extension
+// they are stored with
+var imageFormats = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"webp": ".webp",
+}
+
+// sniffImageFormat identifies an image from its first bytes
+func sniffImageFormat(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "jpeg", true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png", true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif", true
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp", true
+	}
+	return "", false
+}
+
+// decodeImage checks that data is a supported image of an acceptable size
+// and decodes it, turned the right way up if it has an EXIF orientation
+func decodeImage(data []byte) (image.Image, string, error) {
+	format, ok := sniffImageFormat(data)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: not a JPEG, PNG, GIF or WebP image", ErrUnsupportedImage)
+	}
+
+	// Check the dimensions before decoding allocates the bitmap
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", fmt.Errorf("%w: image has no pixels", ErrInvalidImage)
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, "", fmt.Errorf("%w: %dx%d is over %d megapixels", ErrImageTooLarge, config.Width, config.Height, maxImagePixels/1_000_000)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	return orientImage(img, imageOrientation(data, format)), format, nil
+}
+
+// sanitizeImage validates an uploaded image and returns it without
+// metadata such as EXIF location, along with the decoded image and its
+// format. Images with an EXIF orientation are rotated and re-encoded, WebP
+// ones as PNG since there is no WebP encoder; other images keep their pixel
+// data and only lose their metadata.
+func sanitizeImage(data []byte) ([]byte, image.Image, string, error) {
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var clean []byte
+	if orientation := imageOrientation(data, format); orientation > 1 && orientation <= 8 {
+		var buf bytes.Buffer
+		if format == "jpeg" {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 92})
+		} else {
+			format = "png"
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), img, format, nil
+	}
+
+	switch format {
+	case "jpeg":
+		clean, err = stripJPEGMetadata(data)
+	case "png":
+		clean, err = stripPNGMetadata(data)
+	case "gif":
+		clean, err = reencodeGIF(data)
+	case "webp":
+		clean, err = stripWebPMetadata(data)
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return clean, img, format, nil
+}
+
+// imageOrientation returns the EXIF orientation of an image, from 1
+// (upright) to 8, or 0 if it has none. GIFs can't have one.
+func imageOrientation(data []byte, format string) int {
+	switch format {
+	case "jpeg":
+		return jpegOrientation(data)
+	case "png":
+		return pngOrientation(data)
+	case "webp":
+		return webpOrientation(data)
+	}
+	return 0
+}
+
+// jpegSegments calls fn with each marker segment before the image data of
+// a JPEG, and returns the offset where the image data starts
+func jpegSegments(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xff {
+			return 0, errors.New("malformed JPEG")
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			// Fill byte
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, errors.New("malformed JPEG segment")
+		}
+		fn(marker, data[pos:end])
+		pos = end
+		if marker == 0xda {
+			// Start of scan; the compressed image data follows
+			return pos, nil
+		}
+	}
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, from 1 (upright)
+// to 8, or 0 if it has none
+func jpegOrientation(data []byte) int {
+	orientation := 0
+	jpegSegments(data, func(marker byte, segment []byte) {
+		if marker == 0xe1 && orientation == 0 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			orientation = exifOrientation(segment[10:])
+		}
+	})
+	return orientation
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF
+// TIFF data
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// Orientation is tag 0x0112, a SHORT stored in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orientImage turns an image the right way up for an EXIF orientation
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5 to 8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise to display
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// stripJPEGMetadata removes metadata segments from a JPEG: EXIF and XMP
+// (APP1), IPTC (APP13), comments and the other application segments. JFIF
+// (APP0), the colour profile (APP2) and Adobe colour transform (APP14)
+// segments are kept. The image data is copied unchanged.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(data[:2])
+	start, err := jpegSegments(data, func(marker byte, segment []byte) {
+		isApp := marker >= 0xe0 && marker <= 0xef
+		keep := marker == 0xe0 || marker == 0xe2 || marker == 0xee
+		if (isApp && !keep) || marker == 0xfe {
+			return
+		}
+		out.Write(segment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Write(data[start:])
+	return out.Bytes(), nil
+}
+
+// pngMetadataChunks are the PNG chunks stripPNGMetadata removes
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// pngChunks calls fn with each chunk of a PNG up to IEND, including its
+// length, type and checksum
+func pngChunks(data []byte, fn func(chunkType string, chunk []byte)) error {
+	for pos := 8; pos < len(data); {
+		if pos+12 > len(data) {
+			return errors.New("malformed PNG chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return errors.New("malformed PNG chunk")
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		fn(chunkType, data[pos:end])
+		pos = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return nil
+}
+
+// pngOrientation returns the orientation in a PNG's eXIf chunk, or 0
+func pngOrientation(data []byte) int {
+	orientation := 0
+	pngChunks(data, func(chunkType string, chunk []byte) {
+		if chunkType == "eXIf" && orientation == 0 {
+			orientation = exifOrientation(chunk[8 : len(chunk)-4])
+		}
+	})
+	return orientation
+}
+
+// stripPNGMetadata removes text, EXIF and timestamp chunks from a PNG
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(data[:8])
+	err := pngChunks(data, func(chunkType string, chunk []byte) {
+		if !pngMetadataChunks[chunkType] {
+			out.Write(chunk)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// reencodeGIF rewrites a GIF from its decoded frames, which drops comment
+// and application extensions other than the loop count
+func reencodeGIF(data []byte) ([]byte, error) {
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, decoded); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// webpChunks calls fn with each chunk of a WebP file, including its header
+// and padding
+func webpChunks(data []byte, fn func(fourCC string, chunk []byte)) error {
+	// Anything after the RIFF container isn't part of the image
+	riffEnd := min(len(data), 8+int(binary.LittleEndian.Uint32(data[4:])))
+
+	for pos := 12; pos < riffEnd; {
+		if pos+8 > riffEnd {
+			return errors.New("malformed WebP chunk")
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > riffEnd {
+			return errors.New("malformed WebP chunk")
+		}
+		fn(fourCC, data[pos:end])
+		pos = end
+	}
+	return nil
+}
+
+// webpOrientation returns the orientation in a WebP file's EXIF chunk, or 0
+func webpOrientation(data []byte) int {
+	orientation := 0
+	webpChunks(data, func(fourCC string, chunk []byte) {
+		if fourCC != "EXIF" || orientation != 0 {
+			return
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[4:]))
+		// Some writers keep the JPEG APP1 prefix
+		tiff := bytes.TrimPrefix(chunk[8:8+size], []byte("Exif\x00\x00"))
+		orientation = exifOrientation(tiff)
+	})
+	return orientation
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks from a WebP file and
+// clears their flags in the extended header
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	err := webpChunks(data, func(fourCC string, chunk []byte) {
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk = append([]byte(nil), chunk...)
+			if len(chunk) > 8 {
+				// Bit 3 flags EXIF metadata and bit 2 XMP
+				chunk[8] &^= 0x08 | 0x04
+			}
+			body.Write(chunk)
+		default:
+			body.Write(chunk)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(body.Len()))
+	return append(out, body.Bytes()...), nil
+}
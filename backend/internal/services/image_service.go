@@ -1,91 +1,230 @@
 package services
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
 	"io"
 	"mime/multipart"
-	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
 // ImageService handles image storage operations
 type ImageService struct {
-	uploadDir string
+	storage ImageStorage
 }
 
-// NewImageService creates a new image service
+// NewImageService creates a new image service storing images in uploadDir
 func NewImageService(uploadDir string) *ImageService {
+	return NewImageServiceWithStorage(NewFileImageStorage(uploadDir))
+}
+
+// NewImageServiceWithStorage creates a new image service storing images in
+// storage
+func NewImageServiceWithStorage(storage ImageStorage) *ImageService {
 	return &ImageService{
-		uploadDir: uploadDir,
+		storage: storage,
 	}
 }
 
-// SaveImage saves an uploaded image file
+// SaveImage saves an uploaded image file and generates its variants. The
+// upload is checked by decoding it, whatever its name says, and saved
+// without metadata such as EXIF location. Errors for uploads that can't be
+// used wrap ErrUnsupportedImage, ErrImageTooLarge or ErrInvalidImage.
 func (s *ImageService) SaveImage(file multipart.File, header *multipart.FileHeader, id, setNumber string) (string, error) {
-	// Ensure upload directory exists
-	if err := os.MkdirAll(s.uploadDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create upload directory: %w", err)
-	}
+	// Create filename: GUID_SetNumber.ext
+	return s.saveImage(file, header, fmt.Sprintf("%s_%s", id, sanitizeFilename(setNumber)))
+}
 
-	// Get file extension
-	ext := filepath.Ext(header.Filename)
-	if ext == "" {
-		ext = ".jpg" // default extension
-	}
+// SaveSetImage saves an uploaded image like SaveImage under a name of its
+// own, so a set can have many: GUID_SetNumber_xxxxxxxx.ext
+func (s *ImageService) SaveSetImage(file multipart.File, header *multipart.FileHeader, id, setNumber string) (string, error) {
+	suffix := strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+	return s.saveImage(file, header, fmt.Sprintf("%s_%s_%s", id, sanitizeFilename(setNumber), suffix))
+}
 
-	// Validate file extension
-	validExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
+// saveImage stores an upload as name plus the extension of its format
+func (s *ImageService) saveImage(file multipart.File, header *multipart.FileHeader, name string) (string, error) {
+	if _, err := imageExtension(header.Filename); err != nil {
+		return "", err
 	}
 
-	if !validExtensions[strings.ToLower(ext)] {
-		return "", fmt.Errorf("invalid file type: %s (allowed: jpg, jpeg, png, gif, webp)", ext)
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxImageSize {
+		return "", fmt.Errorf("%w: over %dMB", ErrImageTooLarge, maxImageSize>>20)
 	}
 
-	// Create filename: GUID_SetNumber.ext
-	filename := fmt.Sprintf("%s_%s%s", id, sanitizeFilename(setNumber), ext)
-	filepath := filepath.Join(s.uploadDir, filename)
-
-	// Create the file
-	dst, err := os.Create(filepath)
+	clean, img, format, err := sanitizeImage(data)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return "", err
+	}
+
+	// Use the extension of the format the file really is
+	filename := name + imageFormats[format]
+	if err := s.storage.Put(filename, bytes.NewReader(clean)); err != nil {
+		return "", err
 	}
-	defer dst.Close()
 
-	// Copy the uploaded file to the destination
-	if _, err := io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("failed to save file: %w", err)
+	if err := s.writeVariants(filename, img); err != nil {
+		s.DeleteImage(filename)
+		return "", err
 	}
 
 	return filename, nil
 }
 
-// DeleteImage removes an image file
+// imageExtensions are the file extensions accepted for uploaded images
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// imageExtension returns the extension of an uploaded image's filename,
+// defaulting to .jpg, or an error if it isn't an image type
+func imageExtension(filename string) (string, error) {
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		ext = ".jpg"
+	}
+	if !imageExtensions[strings.ToLower(ext)] {
+		return "", fmt.Errorf("%w: %s (allowed: jpg, jpeg, png, gif, webp)", ErrUnsupportedImage, ext)
+	}
+	return ext, nil
+}
+
+// DeleteImage removes an image file and its variants
 func (s *ImageService) DeleteImage(filename string) error {
 	if filename == "" {
 		return nil
 	}
+	if !validImageFilename(filename) {
+		return fmt.Errorf("%w: %q", errInvalidImageFilename, filename)
+	}
+	if err := s.deleteVariants(filename); err != nil {
+		return err
+	}
+	return s.storage.Delete(filename)
+}
 
-	filepath := filepath.Join(s.uploadDir, filename)
-	if err := os.Remove(filepath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete image: %w", err)
+// errInvalidImageFilename is returned for filenames that would escape the
+// image storage
+var errInvalidImageFilename = errors.New("invalid image filename")
+
+// OpenImage opens a stored image file for reading. The error wraps
+// os.ErrNotExist when there is no such image.
+func (s *ImageService) OpenImage(filename string) (*StoredImage, error) {
+	if !validImageFilename(filename) {
+		return nil, fmt.Errorf("%w: %q", errInvalidImageFilename, filename)
+	}
+	return s.storage.Open(filename)
+}
+
+// ImageChecksum returns the SHA-256 checksum and size of a stored image. The
+// error wraps os.ErrNotExist when there is no such image.
+func (s *ImageService) ImageChecksum(filename string) (string, int64, error) {
+	file, err := s.OpenImage(filename)
+	if err != nil {
+		return "", 0, err
 	}
+	defer file.Close()
 
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// ImageExists reports whether an image file is stored
+func (s *ImageService) ImageExists(filename string) bool {
+	if !validImageFilename(filename) {
+		return false
+	}
+	exists, err := s.storage.Exists(filename)
+	return err == nil && exists
+}
+
+// RestoreImage stores an image under an exact filename, replacing any
+// existing file, and regenerates its variants. The image is checked like an
+// upload and must be the format its extension says, but is stored as it is
+// so it keeps its checksum.
+func (s *ImageService) RestoreImage(filename string, reader io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(reader, maxImageSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+	img, err := decodeRestoredImage(filename, data)
+	if err != nil {
+		return err
+	}
+	return s.restoreImage(filename, data, img)
+}
+
+// restoreImage stores image data checked by decodeRestoredImage
+func (s *ImageService) restoreImage(filename string, data []byte, img image.Image) error {
+	if err := s.storage.Put(filename, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	// Variants of an image this replaced would be stale
+	if err := s.writeVariants(filename, img); err != nil {
+		s.deleteVariants(filename)
+		return err
+	}
 	return nil
 }
 
-// GetImagePath returns the full path to an image file
-func (s *ImageService) GetImagePath(filename string) string {
-	if filename == "" {
-		return ""
+// decodeRestoredImage checks an image being restored under filename: it
+// must be a supported image within the upload limits, of the format its
+// extension names
+func decodeRestoredImage(filename string, data []byte) (image.Image, error) {
+	if !validImageFilename(filename) {
+		return nil, fmt.Errorf("%w: %q", errInvalidImageFilename, filename)
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("%w: over %dMB", ErrImageTooLarge, maxImageSize>>20)
+	}
+
+	img, format, err := decodeImage(data)
+	if err != nil {
+		return nil, err
 	}
-	return filepath.Join(s.uploadDir, filename)
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+	if ext != imageFormats[format] {
+		return nil, fmt.Errorf("%w: %s holds a %s image", ErrUnsupportedImage, filename, strings.ToUpper(format))
+	}
+	return img, nil
+}
+
+// validImageFilename reports whether filename names a file at the top of
+// the image storage
+func validImageFilename(filename string) bool {
+	return filename != "" && filename != "." && filename != ".." &&
+		!strings.ContainsAny(filename, "/\\\x00")
+}
+
+// imageBelongsToSet reports whether filename is one the image service could
+// have given one of a set's images, which are named after the set's ID
+func imageBelongsToSet(setID, filename string) bool {
+	return setID != "" && validImageFilename(filename) && strings.HasPrefix(filename, setID+"_")
 }
 
 // sanitizeFilename removes or replaces invalid characters from filename
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImageStorage stores image files by key. Keys are slash separated paths
+// relative to the storage root, like "abc_10276.png" or
+// "variants/abc_10276.png/thumbnail.jpg".
+type ImageStorage interface {
+	// Put stores a file under key, replacing any existing one. Readers see
+	// the old file or the new one, never part of one.
+	Put(key string, reader io.Reader) error
+	// Open opens a stored file. The error wraps fs.ErrNotExist when there
+	// is no such file.
+	Open(key string) (*StoredImage, error)
+	// Exists reports whether a file is stored under key
+	Exists(key string) (bool, error)
+	// Delete removes a stored file. Deleting a missing file isn't an error.
+	Delete(key string) error
+	// ServeHTTP serves the stored file named by the request path, which has
+	// had the /images/ prefix stripped
+	ServeHTTP(w http.ResponseWriter, r *http.Request)
+}
+
+// StoredImage is a stored file opened for reading
+type StoredImage struct {
+	io.ReadCloser
+	// ModTime is when the file was last written
+	ModTime time.Time
+}
+
+// validImageKey reports whether key is a clean relative path that stays
+// inside the storage root
+func validImageKey(key string) bool {
+	return fs.ValidPath(key) && key != "." && !strings.ContainsAny(key, "\\\x00")
+}
+
+// FileImageStorage stores images in a local directory
+type FileImageStorage struct {
+	dir string
+}
+
+// NewFileImageStorage creates a storage for the images in dir
+func NewFileImageStorage(dir string) *FileImageStorage {
+	return &FileImageStorage{dir: dir}
+}
+
+// path returns the local path of a key
+func (s *FileImageStorage) path(key string) (string, error) {
+	if !validImageKey(key) {
+		return "", fmt.Errorf("%w: %q", errInvalidImageFilename, key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file to a temporary name first so a failed copy never
+// leaves a truncated image behind
+func (s *FileImageStorage) Put(key string, reader io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+// Open opens a stored file
+func (s *FileImageStorage) Open(key string) (*StoredImage, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read image %s: %w", key, err)
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("failed to read image %s: %w", key, fs.ErrNotExist)
+	}
+
+	return &StoredImage{ReadCloser: file, ModTime: info.ModTime()}, nil
+}
+
+// Exists reports whether a regular file is stored under key
+func (s *FileImageStorage) Exists(key string) (bool, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// Delete removes a stored file along with any directories it leaves empty,
+// such as an image's variants directory
+func (s *FileImageStorage) Delete(key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+
+	// Removing a directory that isn't empty fails, which ends the walk
+	for dir := path.Dir(key); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(filepath.Join(s.dir, filepath.FromSlash(dir))) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the upload directory
+func (s *FileImageStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.FileServer(http.Dir(s.dir)).ServeHTTP(w, r)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"path"
+
+	// Decoders for the image formats SaveImage accepts
+	_ "image/gif"
+	_ "image/png"
+
+	"lego-catalog/internal/models"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageVariant is a resized JPEG copy generated for every stored image
+type ImageVariant struct {
+	Name string
+	// Size is the most pixels on the longest side. Smaller images aren't
+	// enlarged.
+	Size    int
+	Quality int
+}
+
+// ImageVariants are the copies generated for every image, smallest first
+var ImageVariants = []ImageVariant{
+	{Name: "thumbnail", Size: 200, Quality: 80},
+	{Name: "medium", Size: 800, Quality: 85},
+	{Name: "full", Size: 1600, Quality: 85},
+}
+
+// imageVariantsDir holds the variants of each image, in a directory named
+// after the image
+const imageVariantsDir = "variants"
+
+// ImageVariantPath returns where a variant of an image is stored, relative
+// to the image storage and to the /images/ URL:
+// variants/<filename>/<variant>.jpg
+func ImageVariantPath(filename, variant string) string {
+	return path.Join(imageVariantsDir, filename, variant+".jpg")
+}
+
+// GenerateVariants decodes a stored image and writes each of its variants,
+// replacing any that were there. Images stored before uploads were
+// sanitized are turned the right way up for their EXIF orientation.
+func (s *ImageService) GenerateVariants(filename string) error {
+	file, err := s.OpenImage(filename)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read image %s: %w", filename, err)
+	}
+
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode image %s: %w", filename, err)
+	}
+	return s.writeVariants(filename, img)
+}
+
+// writeVariants writes each variant of a decoded image
+func (s *ImageService) writeVariants(filename string, img image.Image) error {
+	// Variants are written smallest first, so once the last one exists they
+	// all do
+	for _, variant := range ImageVariants {
+		if err := s.writeVariant(filename, variant, img); err != nil {
+			return fmt.Errorf("failed to write %s variant of %s: %w", variant.Name, filename, err)
+		}
+	}
+	return nil
+}
+
+// writeVariant scales img for a variant and stores it
+func (s *ImageService) writeVariant(filename string, variant ImageVariant, img image.Image) error {
+	var buf bytes.Buffer
+	scaled := scaleToFit(img, variant.Size, draw.CatmullRom)
+	if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: variant.Quality}); err != nil {
+		return err
+	}
+	return s.storage.Put(ImageVariantPath(filename, variant.Name), &buf)
+}
+
+// HasVariants reports whether an image's variants have been generated
+func (s *ImageService) HasVariants(filename string) bool {
+	if !validImageFilename(filename) {
+		return false
+	}
+	last := ImageVariants[len(ImageVariants)-1]
+	exists, err := s.storage.Exists(ImageVariantPath(filename, last.Name))
+	return err == nil && exists
+}
+
+// deleteVariants removes the variants of an image
+func (s *ImageService) deleteVariants(filename string) error {
+	if !validImageFilename(filename) {
+		return nil
+	}
+	// Largest first, so HasVariants is false once any of them is gone
+	for i := len(ImageVariants) - 1; i >= 0; i-- {
+		if err := s.storage.Delete(ImageVariantPath(filename, ImageVariants[i].Name)); err != nil {
+			return fmt.Errorf("failed to delete image variants: %w", err)
+		}
+	}
+	return nil
+}
+
+// ImageURLs returns the URLs of an image and its variants. Variants that
+// haven't been generated yet fall back to the original.
+func (s *ImageService) ImageURLs(filename string) *models.ImageURLs {
+	if filename == "" {
+		return nil
+	}
+
+	original := "/images/" + filename
+	urls := &models.ImageURLs{Original: original, Thumbnail: original, Medium: original, Full: original}
+	if s.HasVariants(filename) {
+		urls.Thumbnail = "/images/" + ImageVariantPath(filename, "thumbnail")
+		urls.Medium = "/images/" + ImageVariantPath(filename, "medium")
+		urls.Full = "/images/" + ImageVariantPath(filename, "full")
+	}
+	return urls
+}
+
+// AttachImageURLs fills in the image URLs of sets that have an image
+func (s *ImageService) AttachImageURLs(sets ...*models.LegoSet) {
+	for _, set := range sets {
+		if set != nil && set.ImageFilename != nil {
+			set.ImageURLs = s.ImageURLs(*set.ImageFilename)
+		}
+	}
+}
+
+// scaleToFit shrinks img to at most size pixels on its longest side, on a
+// white background since JPEG has no transparency
+func scaleToFit(img image.Image, size int, scaler draw.Scaler) image.Image {
+	bounds := img.Bounds()
+	scale := math.Min(1, float64(size)/float64(max(bounds.Dx(), bounds.Dy())))
+	width := max(1, int(math.Round(float64(bounds.Dx())*scale)))
+	height := max(1, int(math.Round(float64(bounds.Dy())*scale)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	scaler.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
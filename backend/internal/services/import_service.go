@@ -0,0 +1,943 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ImportOptions controls how ImportService applies a file
+type ImportOptions struct {
+	CSV CSVImportOptions
+	// Strategy decides what happens to sets that already exist (default skip)
+	Strategy models.ImportStrategy
+	// DryRun validates every row and reports what would happen without
+	// writing anything
+	DryRun bool
+	// Atomic applies the whole file in one transaction, rolling it back if
+	// any row fails
+	Atomic bool
+	// SummaryOnly leaves the per-row reports out of the result and caps the
+	// error list, for imports too large to report on row by row
+	SummaryOnly bool
+	// Progress, if set, is called with the running totals after each batch
+	Progress func(progress models.ImportResult)
+}
+
+// ImportFileError is returned when a file can't be imported at all, as
+// opposed to problems with individual rows
+type ImportFileError struct {
+	Err error
+}
+
+func (e *ImportFileError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImportFileError) Unwrap() error {
+	return e.Err
+}
+
+// errImportRolledBack makes RunInTx roll back an atomic import with failed rows
+var errImportRolledBack = errors.New("import rolled back")
+
+const (
+	// importBatchSize is how many rows are looked up and inserted at a time
+	importBatchSize = 100
+	// maxSummaryErrors caps the error list of a SummaryOnly import
+	maxSummaryErrors = 1000
+)
+
+// ImportService applies parsed import files to the catalog
+type ImportService struct {
+	repo               db.LegoSetStore
+	csvService         *CSVService
+	jsonService        *JSONService
+	rebrickableService *RebrickableService
+	brickLinkService   *BrickLinkService
+	bricksetService    *BricksetService
+}
+
+// NewImportService creates a new import service
+func NewImportService(repo db.LegoSetStore, csvService *CSVService) *ImportService {
+	return &ImportService{
+		repo:               repo,
+		csvService:         csvService,
+		jsonService:        NewJSONService(),
+		rebrickableService: NewRebrickableService(),
+		brickLinkService:   NewBrickLinkService(),
+		bricksetService:    NewBricksetService(),
+	}
+}
+
+// ImportCSV parses a CSV file and applies it to the catalog. The whole file
+// is parsed before anything is written. Problems with individual rows are
+// reported in the result; an *ImportFileError is returned when the file
+// itself can't be used.
+func (s *ImportService) ImportCSV(reader io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	header, rows, err := s.csvService.ParseCSV(reader, opts.CSV)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	return s.importRows(header, rows, opts)
+}
+
+// importRows applies rows that have already been parsed
+func (s *ImportService) importRows(header *CSVHeader, rows []*CSVRow, opts ImportOptions) (*models.ImportResult, error) {
+	next := 0
+	return s.execute(opts, func(run *importRun) error {
+		run.header = header
+		return run.process(context.Background(), func() (*CSVRow, error) {
+			if next == len(rows) {
+				return nil, io.EOF
+			}
+			next++
+			return rows[next-1], nil
+		})
+	})
+}
+
+// ImportCSVStream imports a CSV file while reading it, a batch of rows at a
+// time, so the file is never held in memory. Rows already applied stay
+// applied if the file turns out to be malformed further down, unless the
+// import is atomic. Cancelling ctx stops the import between batches and
+// returns ctx's error with the partial result.
+func (s *ImportService) ImportCSVStream(ctx context.Context, reader io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	rowReader, err := s.csvService.NewRowReader(reader, opts.CSV)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	return s.execute(opts, func(run *importRun) error {
+		run.header = rowReader.Header()
+		return run.process(ctx, rowReader.Read)
+	})
+}
+
+// ImportBrickset imports a Brickset collection export. Strategies work as
+// they do for CSV, with the columns Brickset has.
+func (s *ImportService) ImportBrickset(reader io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	header, rows, err := s.bricksetService.ParseCSV(reader)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	return s.importRows(header, rows, opts)
+}
+
+// ImportRebrickable imports a Rebrickable set list. Titles, years, series
+// and part counts come from catalog, a sets.csv dump, when it isn't nil;
+// without one only sets that already exist can be updated. Every value
+// Rebrickable supplies is applied, so overwrite behaves like merge and
+// leaves fields Rebrickable doesn't know about alone.
+func (s *ImportService) ImportRebrickable(setList io.Reader, catalog *RebrickableCatalog, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	header, rows, err := s.rebrickableService.ParseSetList(setList, catalog)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	strategy := opts.Strategy
+	if strategy == models.ImportStrategyOverwrite {
+		strategy = models.ImportStrategyMerge
+	}
+	return s.importRowsAs(header, rows, opts, strategy)
+}
+
+// ImportBrickLink imports a BrickLink XML inventory or wanted list, with
+// titles and other metadata from catalog when it isn't nil. Like
+// ImportRebrickable, overwrite behaves like merge. Importing a wanted list
+// never changes whether an existing set is owned.
+func (s *ImportService) ImportBrickLink(reader io.Reader, list BrickLinkList, catalog *RebrickableCatalog, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	header, rows, err := s.brickLinkService.ParseXML(reader, list, catalog)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	strategy := opts.Strategy
+	if strategy == models.ImportStrategyOverwrite {
+		strategy = models.ImportStrategyMerge
+	}
+	return s.importRowsAs(header, rows, opts, strategy)
+}
+
+// EnrichFromRebrickable fills in titles, years, series, part counts and
+// Rebrickable links for every set in the catalog from a sets.csv dump. By
+// default only empty fields are filled; the overwrite and merge strategies
+// replace them with Rebrickable's values.
+func (s *ImportService) EnrichFromRebrickable(catalog *RebrickableCatalog, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	sets, err := s.repo.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sets: %w", err)
+	}
+
+	header, rows := s.rebrickableService.EnrichmentRows(sets, catalog, opts.Strategy != models.ImportStrategySkip)
+	return s.importRowsAs(header, rows, opts, models.ImportStrategyMerge)
+}
+
+// importRowsAs applies rows using strategy while reporting the requested
+// one, for imports whose rows only hold the fields they mean to write
+func (s *ImportService) importRowsAs(header *CSVHeader, rows []*CSVRow, opts ImportOptions, strategy models.ImportStrategy) (*models.ImportResult, error) {
+	requested := opts.Strategy
+	opts.Strategy = strategy
+
+	result, err := s.importRows(header, rows, opts)
+	if result != nil {
+		result.Strategy = requested
+	}
+	return result, err
+}
+
+// ImportJSON restores a catalog exported as JSON, keeping each set's ID and
+// timestamps. Sets are matched by ID; a set whose set number belongs to a
+// different ID fails. The merge strategy isn't supported since every field
+// in the file is meaningful.
+func (s *ImportService) ImportJSON(reader io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	catalog, err := s.jsonService.ImportFromJSON(reader)
+	if err != nil {
+		return nil, &ImportFileError{err}
+	}
+
+	return s.ImportCatalog(catalog, opts)
+}
+
+// ImportCatalog restores an already decoded catalog like ImportJSON
+func (s *ImportService) ImportCatalog(catalog *models.CatalogExport, opts ImportOptions) (*models.ImportResult, error) {
+	if err := validateImportOptions(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Strategy == models.ImportStrategyMerge {
+		return nil, &ImportFileError{errors.New("the merge strategy isn't supported when restoring a catalog")}
+	}
+
+	return s.execute(opts, func(run *importRun) error {
+		return run.restore(catalog.Sets, catalog.Images)
+	})
+}
+
+func validateImportOptions(opts *ImportOptions) error {
+	if opts.Strategy == "" {
+		opts.Strategy = models.ImportStrategySkip
+	}
+	if !opts.Strategy.Valid() {
+		return &ImportFileError{fmt.Errorf("unknown import strategy %q (expected skip, overwrite or merge)", opts.Strategy)}
+	}
+	return nil
+}
+
+// execute creates an import run and passes it to fn, inside a transaction
+// when the import is atomic
+func (s *ImportService) execute(opts ImportOptions, fn func(run *importRun) error) (*models.ImportResult, error) {
+	if !opts.Atomic || opts.DryRun {
+		run := newImportRun(s.repo, opts)
+		err := fn(run)
+		return run.result, err
+	}
+
+	var run *importRun
+	err := s.repo.RunInTx(func(store db.LegoSetStore) error {
+		run = newImportRun(store, opts)
+		if err := fn(run); err != nil {
+			return err
+		}
+		if run.result.Failed > 0 {
+			return errImportRolledBack
+		}
+		return nil
+	})
+	if run == nil {
+		return nil, err
+	}
+	if err != nil {
+		run.result.RolledBack = true
+	}
+	if errors.Is(err, errImportRolledBack) {
+		return run.result, nil
+	}
+	return run.result, err
+}
+
+// importPlan is what an import will do with a single row
+type importPlan struct {
+	existing *models.LegoSet
+	set      *models.LegoSet
+	updates  map[string]interface{}
+}
+
+// importRun holds the state of one import as batches of rows go through it
+type importRun struct {
+	store db.LegoSetStore
+	// header maps CSV columns to fields; it is nil for JSON imports
+	header *CSVHeader
+	opts   ImportOptions
+	result *models.ImportResult
+	// seen holds set numbers from earlier in the file, by line
+	seen map[string]int
+	// failed is set after a write fails in an atomic import, which stops
+	// further writes since the transaction will be rolled back
+	failed bool
+}
+
+func newImportRun(store db.LegoSetStore, opts ImportOptions) *importRun {
+	return &importRun{
+		store: store,
+		opts:  opts,
+		result: &models.ImportResult{
+			DryRun:   opts.DryRun,
+			Atomic:   opts.Atomic,
+			Strategy: opts.Strategy,
+			Errors:   []string{},
+			Rows:     []models.ImportRowResult{},
+		},
+		seen: map[string]int{},
+	}
+}
+
+// process reads rows from next until io.EOF, applying them a batch at a time
+func (run *importRun) process(ctx context.Context, next func() (*CSVRow, error)) error {
+	if run.header != nil {
+		run.result.UnmappedColumns = run.header.Unmapped
+	}
+
+	batch := make([]*CSVRow, 0, importBatchSize)
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &ImportFileError{err}
+		}
+
+		batch = append(batch, row)
+		if len(batch) == importBatchSize {
+			if err := run.processBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return run.processBatch(ctx, batch)
+}
+
+// processBatch plans a batch of rows and, unless this is a dry run, writes it.
+// Once a write has failed in an atomic import the rest of the file isn't
+// looked at: the transaction will be rolled back, and some databases reject
+// every further query in it.
+func (run *importRun) processBatch(ctx context.Context, rows []*CSVRow) error {
+	if len(rows) == 0 || run.failed {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Look up every existing set in the batch at once
+	setNumbers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Set.SetNumber != "" {
+			setNumbers = append(setNumbers, row.Set.SetNumber)
+		}
+	}
+	existing, err := run.store.GetBySetNumbers(setNumbers)
+	if err != nil {
+		return fmt.Errorf("failed to look up existing sets: %w", err)
+	}
+
+	reports := make([]models.ImportRowResult, len(rows))
+	plans := make([]*importPlan, len(rows))
+	for i, row := range rows {
+		reports[i] = models.ImportRowResult{
+			Line:      row.Line,
+			SetNumber: row.Set.SetNumber,
+			Title:     row.Set.Title,
+			Warnings:  row.Warnings,
+		}
+		plans[i] = planRow(run.header, row, run.opts.Strategy, existing, run.seen, &reports[i])
+	}
+
+	if !run.opts.DryRun {
+		run.write(reports, plans)
+	}
+
+	run.tally(reports)
+	if run.opts.Progress != nil {
+		progress := *run.result
+		progress.Rows = nil
+		progress.Errors = append([]string(nil), run.result.Errors...)
+		run.opts.Progress(progress)
+	}
+	return nil
+}
+
+// write applies a batch of planned rows, inserting new sets with a single
+// CreateMany call. Outside of an atomic import a failed CreateMany is
+// retried row by row so only the offending rows fail.
+func (run *importRun) write(reports []models.ImportRowResult, plans []*importPlan) {
+	pending := []int{}
+	sets := []*models.LegoSet{}
+
+	for i, plan := range plans {
+		if plan == nil || run.failed {
+			continue
+		}
+		switch reports[i].Action {
+		case models.ImportActionCreate:
+			pending = append(pending, i)
+			sets = append(sets, plan.set)
+		case models.ImportActionUpdate:
+			if err := run.store.Update(plan.existing.ID, plan.updates); err != nil {
+				run.fail(&reports[i], err)
+			}
+		}
+	}
+
+	if len(sets) == 0 || run.failed {
+		return
+	}
+
+	if err := run.store.CreateMany(sets); err != nil {
+		for n, i := range pending {
+			if run.opts.Atomic {
+				run.fail(&reports[i], err)
+			} else if err := run.store.Create(sets[n]); err != nil {
+				run.fail(&reports[i], err)
+			}
+		}
+	}
+}
+
+func (run *importRun) fail(report *models.ImportRowResult, err error) {
+	report.Action = models.ImportActionError
+	report.Reason = err.Error()
+	report.Changes = nil
+	if run.opts.Atomic {
+		run.failed = true
+	}
+}
+
+// tally adds a batch's reports to the result
+func (run *importRun) tally(reports []models.ImportRowResult) {
+	result := run.result
+	for _, report := range reports {
+		result.Processed++
+		result.Warnings += len(report.Warnings)
+
+		switch report.Action {
+		case models.ImportActionCreate:
+			result.Imported++
+		case models.ImportActionUpdate:
+			result.Updated++
+		case models.ImportActionSkip:
+			result.Skipped++
+		case models.ImportActionError:
+			result.Failed++
+			if !run.opts.SummaryOnly || len(result.Errors) < maxSummaryErrors {
+				result.Errors = append(result.Errors, fmt.Sprintf("Line %d (set %s): %s", report.Line, report.SetNumber, report.Reason))
+			}
+		}
+	}
+
+	if !run.opts.SummaryOnly {
+		result.Rows = append(result.Rows, reports...)
+	}
+}
+
+// restore writes sets from a JSON catalog with their original IDs, along
+// with their images
+func (run *importRun) restore(sets []*models.LegoSet, images []*models.SetImage) error {
+	reports := make([]models.ImportRowResult, len(sets))
+	seenIDs := map[string]int{}
+
+	imagesBySet := map[string][]*models.SetImage{}
+	for _, image := range images {
+		imagesBySet[image.SetID] = append(imagesBySet[image.SetID], image)
+	}
+
+	for i, set := range sets {
+		// As in processBatch, nothing more is looked up after a failed write
+		if run.failed {
+			reports = reports[:i]
+			break
+		}
+		report := &reports[i]
+		*report = models.ImportRowResult{
+			Line:      i + 1,
+			ID:        set.ID,
+			SetNumber: set.SetNumber,
+			Title:     set.Title,
+		}
+
+		// Sharing another set's image would delete it along with either set,
+		// and a name that isn't the image service's own could be a path
+		if set.ImageFilename != nil && *set.ImageFilename != "" && !imageBelongsToSet(set.ID, *set.ImageFilename) {
+			report.Warnings = append(report.Warnings, models.FieldWarning{
+				Field:   "image_filename",
+				Message: fmt.Sprintf("image %q isn't named after this set and was left out", *set.ImageFilename),
+			})
+			withoutImage := *set
+			withoutImage.ImageFilename = nil
+			set = &withoutImage
+		}
+
+		var setImages []*models.SetImage
+		if set.ID != "" {
+			setImages = checkRestoredImages(set, imagesBySet[set.ID], report)
+		}
+
+		existing, err := run.planRestore(set, setImages, seenIDs, report)
+		if err != nil {
+			return err
+		}
+
+		if run.opts.DryRun {
+			continue
+		}
+		switch report.Action {
+		case models.ImportActionCreate, models.ImportActionUpdate:
+			restored := *set
+			if err := run.store.Restore(&restored); err != nil {
+				run.fail(report, err)
+				continue
+			}
+			if existing == nil {
+				report.ID = restored.ID
+			}
+			if err := run.restoreImages(restored.ID, setImages); err != nil {
+				run.fail(report, err)
+			}
+		}
+	}
+
+	run.tally(reports)
+	return nil
+}
+
+// planRestore validates a set from a JSON catalog and decides what to do
+// with it. It returns the existing set with the same ID, if any.
+func (run *importRun) planRestore(set *models.LegoSet, images []*models.SetImage, seenIDs map[string]int, report *models.ImportRowResult) (*models.LegoSet, error) {
+	// Validate required fields
+	if set.SetNumber == "" || set.Title == "" {
+		report.Action = models.ImportActionError
+		report.Reason = "set number and title are required"
+		return nil, nil
+	}
+	if set.ID != "" {
+		if _, err := uuid.Parse(set.ID); err != nil {
+			report.Action = models.ImportActionError
+			report.Reason = fmt.Sprintf("invalid id %q", set.ID)
+			return nil, nil
+		}
+	}
+
+	key := strings.ToLower(set.SetNumber)
+	if line, ok := run.seen[key]; ok {
+		report.Action = models.ImportActionSkip
+		report.Reason = fmt.Sprintf("duplicate of set %d", line)
+		return nil, nil
+	}
+	if line, ok := seenIDs[set.ID]; ok && set.ID != "" {
+		report.Action = models.ImportActionSkip
+		report.Reason = fmt.Sprintf("duplicate of set %d", line)
+		return nil, nil
+	}
+	run.seen[key] = report.Line
+	seenIDs[set.ID] = report.Line
+
+	var existing *models.LegoSet
+	if set.ID != "" {
+		var err error
+		if existing, err = run.store.GetByID(set.ID); err != nil {
+			return nil, fmt.Errorf("failed to look up set %s: %w", set.ID, err)
+		}
+	}
+
+	owner, err := run.store.GetBySetNumber(set.SetNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up set %s: %w", set.SetNumber, err)
+	}
+	if owner != nil && (existing == nil || owner.ID != existing.ID) {
+		report.Action = models.ImportActionError
+		report.Reason = fmt.Sprintf("set number already belongs to set %s", owner.ID)
+		return nil, nil
+	}
+
+	if existing == nil {
+		report.Action = models.ImportActionCreate
+		return nil, nil
+	}
+
+	if run.opts.Strategy == models.ImportStrategySkip {
+		report.Action = models.ImportActionSkip
+		report.Reason = "set already exists"
+		return existing, nil
+	}
+
+	changes := []models.FieldChange{}
+	for _, field := range CSVFields() {
+		from := legoSetValue(existing, field)
+		to := legoSetValue(set, field)
+		if from != to {
+			changes = append(changes, models.FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	if len(images) > 0 {
+		local, err := run.store.ListImages(existing.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up images of set %s: %w", existing.ID, err)
+		}
+		if imagesChanged(local, images) {
+			changes = append(changes, models.FieldChange{Field: "images", From: describeImages(local), To: describeImages(images)})
+		}
+	}
+	if len(changes) == 0 && sameSecond(existing.CreatedAt, set.CreatedAt) && sameSecond(existing.UpdatedAt, set.UpdatedAt) {
+		report.Action = models.ImportActionSkip
+		report.Reason = "no changes"
+		return existing, nil
+	}
+
+	report.Action = models.ImportActionUpdate
+	report.Changes = changes
+	return existing, nil
+}
+
+// checkRestoredImages returns the images from a catalog that can be
+// restored for a set, with a warning for each one left out
+func checkRestoredImages(set *models.LegoSet, images []*models.SetImage, report *models.ImportRowResult) []*models.SetImage {
+	if len(images) == 0 {
+		return nil
+	}
+	// Images are restored alongside the primary image that set's
+	// ImageFilename restores
+	if set.ImageFilename == nil || *set.ImageFilename == "" {
+		report.Warnings = append(report.Warnings, models.FieldWarning{
+			Field:   "images",
+			Message: "the set has no primary image, so its other images were left out",
+		})
+		return nil
+	}
+
+	checked := []*models.SetImage{}
+	seen := map[string]bool{}
+	for _, image := range images {
+		switch {
+		case !imageBelongsToSet(set.ID, image.Filename):
+			report.Warnings = append(report.Warnings, models.FieldWarning{
+				Field:   "images",
+				Message: fmt.Sprintf("image %q isn't named after this set and was left out", image.Filename),
+			})
+			continue
+		case seen[image.Filename]:
+			continue
+		}
+		seen[image.Filename] = true
+
+		restored := *image
+		if restored.Kind != nil && !models.SetImageKinds[*restored.Kind] {
+			report.Warnings = append(report.Warnings, models.FieldWarning{
+				Field:   "images",
+				Message: fmt.Sprintf("image %q has unknown kind %q, which was cleared", image.Filename, *image.Kind),
+			})
+			restored.Kind = nil
+		}
+		checked = append(checked, &restored)
+	}
+
+	sort.SliceStable(checked, func(i, j int) bool {
+		return checked[i].SortOrder < checked[j].SortOrder
+	})
+	return checked
+}
+
+// imagesChanged reports whether restoring images would change a set's
+// local images: one is missing, has another caption or kind, or is out of
+// order. Local images that aren't in the catalog are kept, so they don't
+// count.
+func imagesChanged(local, images []*models.SetImage) bool {
+	positions := map[string]int{}
+	for i := len(local) - 1; i >= 0; i-- {
+		positions[local[i].Filename] = i
+	}
+
+	last := -1
+	for _, image := range images {
+		i, ok := positions[image.Filename]
+		if !ok || i < last || !sameImageLabels(local[i], image) {
+			return true
+		}
+		last = i
+	}
+	return false
+}
+
+// sameImageLabels reports whether two images have the same caption and kind
+func sameImageLabels(a, b *models.SetImage) bool {
+	return stringPtrValue(a.Caption) == stringPtrValue(b.Caption) && stringPtrValue(a.Kind) == stringPtrValue(b.Kind)
+}
+
+// describeImages lists image filenames for an import report
+func describeImages(images []*models.SetImage) string {
+	names := make([]string, len(images))
+	for i, image := range images {
+		names[i] = image.Filename
+	}
+	return strings.Join(names, ", ")
+}
+
+// restoreImages gives a restored set the images from a catalog. Images it
+// doesn't have are added and the captions and kinds of those it has are
+// updated, then they are put in the catalog's order, followed by any local
+// images the catalog doesn't list. The primary image is already restored
+// from the set's ImageFilename.
+func (run *importRun) restoreImages(setID string, images []*models.SetImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	local, err := run.store.ListImages(setID)
+	if err != nil {
+		return fmt.Errorf("failed to look up images of set %s: %w", setID, err)
+	}
+	byFilename := map[string]*models.SetImage{}
+	for i := len(local) - 1; i >= 0; i-- {
+		byFilename[local[i].Filename] = local[i]
+	}
+
+	current := []string{}
+	for _, image := range local {
+		current = append(current, image.ID)
+	}
+
+	order := []string{}
+	listed := map[string]bool{}
+	for _, image := range images {
+		existing := byFilename[image.Filename]
+		switch {
+		case existing == nil:
+			existing = &models.SetImage{SetID: setID, Filename: image.Filename, Caption: image.Caption, Kind: image.Kind}
+			if err := run.store.AddImage(existing); err != nil {
+				return fmt.Errorf("failed to restore image %s: %w", image.Filename, err)
+			}
+			current = append(current, existing.ID)
+		case !sameImageLabels(existing, image):
+			existing.Caption = image.Caption
+			existing.Kind = image.Kind
+			if err := run.store.UpdateImage(existing); err != nil {
+				return fmt.Errorf("failed to restore image %s: %w", image.Filename, err)
+			}
+		}
+		order = append(order, existing.ID)
+		listed[existing.ID] = true
+	}
+	for _, image := range local {
+		if !listed[image.ID] {
+			order = append(order, image.ID)
+		}
+	}
+
+	if strings.Join(order, ",") == strings.Join(current, ",") {
+		return nil
+	}
+	if err := run.store.ReorderImages(setID, order); err != nil {
+		return fmt.Errorf("failed to restore the order of images of set %s: %w", setID, err)
+	}
+	return nil
+}
+
+// planRow validates a row and decides what to do with it
+func planRow(header *CSVHeader, row *CSVRow, strategy models.ImportStrategy, existingSets map[string]*models.LegoSet, seen map[string]int, report *models.ImportRowResult) *importPlan {
+	set := row.Set
+
+	// Validate required fields
+	if set.SetNumber == "" {
+		report.Action = models.ImportActionError
+		report.Reason = "set number is required"
+		return nil
+	}
+
+	key := strings.ToLower(set.SetNumber)
+	if line, ok := seen[key]; ok {
+		report.Action = models.ImportActionSkip
+		report.Reason = fmt.Sprintf("duplicate of line %d", line)
+		return nil
+	}
+	seen[key] = row.Line
+
+	existing := existingSets[key]
+	if existing == nil {
+		if set.Title == "" {
+			report.Action = models.ImportActionError
+			report.Reason = "title is required"
+			return nil
+		}
+		report.Action = models.ImportActionCreate
+		return &importPlan{set: set.ToLegoSet()}
+	}
+
+	if strategy == models.ImportStrategySkip {
+		report.Action = models.ImportActionSkip
+		report.Reason = "set already exists"
+		return nil
+	}
+
+	if strategy == models.ImportStrategyOverwrite && set.Title == "" {
+		report.Action = models.ImportActionError
+		report.Reason = "title is required"
+		return nil
+	}
+
+	changes, updates := diffImportRow(header, row, existing, strategy)
+	if len(changes) == 0 {
+		report.Action = models.ImportActionSkip
+		report.Reason = "no changes"
+		return nil
+	}
+
+	report.Action = models.ImportActionUpdate
+	report.Changes = changes
+	return &importPlan{existing: existing, updates: updates}
+}
+
+// diffImportRow compares the row against the existing set. Overwrite takes
+// every column in the file and merge only the cells that had a value. Cells
+// that couldn't be parsed are never applied.
+func diffImportRow(header *CSVHeader, row *CSVRow, existing *models.LegoSet, strategy models.ImportStrategy) ([]models.FieldChange, map[string]interface{}) {
+	warned := map[string]bool{}
+	for _, warning := range row.Warnings {
+		warned[warning.Field] = true
+	}
+
+	incoming := row.Set.ToLegoSet()
+	changes := []models.FieldChange{}
+	updates := map[string]interface{}{}
+
+	for _, field := range CSVFields() {
+		// The set number identifies the set and is never updated
+		if field == "set_number" || !header.Has(field) || warned[field] {
+			continue
+		}
+		if strategy == models.ImportStrategyMerge && !row.Filled[field] {
+			continue
+		}
+
+		from := legoSetValue(existing, field)
+		to := legoSetValue(incoming, field)
+		if from == to {
+			continue
+		}
+
+		changes = append(changes, models.FieldChange{Field: field, From: from, To: to})
+		updates[field] = updateValue(field, to)
+	}
+
+	return changes, updates
+}
+
+// legoSetValue returns a field's value as a comparable nil, string, bool,
+// int or float64, with dates as YYYY-MM-DD strings
+func legoSetValue(set *models.LegoSet, field string) interface{} {
+	switch field {
+	case "set_number":
+		return set.SetNumber
+	case "alternate_set_number":
+		return stringPtrValue(set.AlternateSetNumber)
+	case "title":
+		return set.Title
+	case "owned":
+		return set.Owned
+	case "quantity_owned":
+		return set.QuantityOwned
+	case "release_year":
+		if set.ReleaseYear == nil {
+			return nil
+		}
+		return *set.ReleaseYear
+	case "description":
+		return stringPtrValue(set.Description)
+	case "series":
+		return stringPtrValue(set.Series)
+	case "num_parts":
+		return set.NumParts
+	case "num_minifigs":
+		return set.NumMinifigs
+	case "bricklink_url":
+		return stringPtrValue(set.BricklinkURL)
+	case "rebrickable_url":
+		return stringPtrValue(set.RebrickableURL)
+	case "approximate_value":
+		if set.ApproximateValue == nil {
+			return nil
+		}
+		return *set.ApproximateValue
+	case "value_last_updated":
+		if set.ValueLastUpdated == nil {
+			return nil
+		}
+		return set.ValueLastUpdated.Format("2006-01-02")
+	case "condition_description":
+		return stringPtrValue(set.ConditionDescription)
+	case "image_filename":
+		return stringPtrValue(set.ImageFilename)
+	case "notes":
+		return stringPtrValue(set.Notes)
+	}
+	return nil
+}
+
+// updateValue converts a legoSetValue back into a value for LegoSetStore.Update
+func updateValue(field string, value interface{}) interface{} {
+	if date, ok := value.(string); ok && field == "value_last_updated" {
+		t, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return nil
+		}
+		return t
+	}
+	return value
+}
+
+// sameSecond compares timestamps at the precision every database keeps
+func sameSecond(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func stringPtrValue(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrJobNotFound is returned for unknown job IDs
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that already stopped
+	ErrJobFinished = errors.New("job already finished")
+	// ErrJobQueueFull is returned when too many jobs are waiting to run
+	ErrJobQueueFull = errors.New("too many queued jobs")
+	// ErrUploadTooLarge is returned when a staged upload exceeds its limit
+	ErrUploadTooLarge = errors.New("upload too large")
+)
+
+const (
+	// jobQueueSize is how many jobs may wait for a worker
+	jobQueueSize = 100
+	// jobRetention is how long finished jobs stay listed
+	jobRetention = 24 * time.Hour
+)
+
+// JobManager runs imports in the background and tracks their progress.
+// Jobs are kept in memory and don't survive a restart.
+type JobManager struct {
+	importService *ImportService
+	queue         chan *jobRun
+
+	mu   sync.RWMutex
+	jobs map[string]*jobRun
+}
+
+// jobRun is a job plus what its worker needs. job is guarded by
+// JobManager.mu.
+type jobRun struct {
+	job       models.Job
+	path      string
+	opts      ImportOptions
+	ctx       context.Context
+	cancel    context.CancelFunc
+	bytesRead atomic.Int64
+	done      chan struct{}
+}
+
+// NewJobManager creates a job manager with the given number of workers
+func NewJobManager(importService *ImportService, workers int) *JobManager {
+	m := &JobManager{
+		importService: importService,
+		queue:         make(chan *jobRun, jobQueueSize),
+		jobs:          map[string]*jobRun{},
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+
+	return m
+}
+
+// StageUpload copies an upload to a temporary file for a job, returning the
+// file's path and size. The caller must remove the file if it isn't passed
+// to SubmitImport.
+func (m *JobManager) StageUpload(r io.Reader, maxBytes int64) (string, int64, error) {
+	file, err := os.CreateTemp("", "lego-import-*.csv")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, io.LimitReader(r, maxBytes+1))
+	if err == nil && size > maxBytes {
+		err = ErrUploadTooLarge
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", 0, err
+	}
+
+	return file.Name(), size, nil
+}
+
+// SubmitImport queues an import of a staged upload. The job owns the file
+// from here on and removes it when it finishes.
+func (m *JobManager) SubmitImport(path, filename string, size int64, opts ImportOptions) (*models.Job, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &jobRun{
+		job: models.Job{
+			ID:         uuid.New().String(),
+			Type:       "import",
+			Status:     models.JobStatusQueued,
+			Filename:   filename,
+			BytesTotal: size,
+			CreatedAt:  time.Now(),
+		},
+		path:   path,
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+
+	select {
+	case m.queue <- run:
+	default:
+		cancel()
+		return nil, ErrJobQueueFull
+	}
+
+	m.jobs[run.job.ID] = run
+	job := run.job
+	return &job, nil
+}
+
+// Get returns a snapshot of a job
+func (m *JobManager) Get(id string) (*models.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return m.snapshot(run), nil
+}
+
+// List returns snapshots of all jobs, newest first
+func (m *JobManager) List() []*models.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+
+	jobs := make([]*models.Job, 0, len(m.jobs))
+	for _, run := range m.jobs {
+		jobs = append(jobs, m.snapshot(run))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel stops a job. A queued job is cancelled straight away; a running
+// job stops after its current batch of rows.
+func (m *JobManager) Cancel(id string) (*models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	run, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if run.job.Status.Finished() {
+		return nil, ErrJobFinished
+	}
+
+	run.cancel()
+	if run.job.Status == models.JobStatusQueued {
+		m.finish(run, models.JobStatusCancelled, "")
+	}
+	return m.snapshot(run), nil
+}
+
+// Wait blocks until a job finishes or ctx is done and returns its snapshot
+func (m *JobManager) Wait(ctx context.Context, id string) (*models.Job, error) {
+	m.mu.RLock()
+	run, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	select {
+	case <-run.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return m.Get(id)
+}
+
+func (m *JobManager) worker() {
+	for run := range m.queue {
+		m.runImport(run)
+	}
+}
+
+func (m *JobManager) runImport(run *jobRun) {
+	defer os.Remove(run.path)
+
+	m.mu.Lock()
+	if run.job.Status.Finished() {
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	run.job.Status = models.JobStatusRunning
+	run.job.StartedAt = &now
+	m.mu.Unlock()
+
+	file, err := os.Open(run.path)
+	if err != nil {
+		m.mu.Lock()
+		m.finish(run, models.JobStatusFailed, fmt.Sprintf("failed to open upload: %v", err))
+		m.mu.Unlock()
+		return
+	}
+	defer file.Close()
+
+	opts := run.opts
+	opts.SummaryOnly = true
+	opts.Progress = func(progress models.ImportResult) {
+		m.mu.Lock()
+		run.job.Progress = progress
+		m.mu.Unlock()
+	}
+
+	reader := &countingReader{reader: file, count: &run.bytesRead}
+	result, err := m.importService.ImportCSVStream(run.ctx, bufio.NewReader(reader), opts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if result != nil {
+		run.job.Progress = *result
+		run.job.Progress.Rows = nil
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		m.finish(run, models.JobStatusCancelled, "")
+	case err != nil:
+		log.Printf("Import job %s failed: %v", run.job.ID, err)
+		m.finish(run, models.JobStatusFailed, err.Error())
+	default:
+		m.finish(run, models.JobStatusCompleted, "")
+	}
+}
+
+// finish records that a job stopped. m.mu must be held.
+func (m *JobManager) finish(run *jobRun, status models.JobStatus, message string) {
+	now := time.Now()
+	run.job.Status = status
+	run.job.Error = message
+	run.job.FinishedAt = &now
+	run.cancel()
+	close(run.done)
+}
+
+// snapshot copies a job for callers. m.mu must be held.
+func (m *JobManager) snapshot(run *jobRun) *models.Job {
+	job := run.job
+	job.BytesRead = run.bytesRead.Load()
+	job.Progress.Errors = append([]string{}, run.job.Progress.Errors...)
+	return &job
+}
+
+// prune forgets jobs that finished more than jobRetention ago. m.mu must be
+// held.
+func (m *JobManager) prune() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, run := range m.jobs {
+		if run.job.FinishedAt != nil && run.job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"lego-catalog/internal/models"
+)
+
+// JSONService handles JSON import/export operations
+type JSONService struct{}
+
+// NewJSONService creates a new JSON service
+func NewJSONService() *JSONService {
+	return &JSONService{}
+}
+
+// NewCatalog wraps sets, with IDs and timestamps, in a versioned catalog
+// document along with their images. Images of other sets are left out.
+func (s *JSONService) NewCatalog(sets []*models.LegoSet, images []*models.SetImage) models.CatalogExport {
+	if sets == nil {
+		sets = []*models.LegoSet{}
+	}
+
+	exported := map[string]bool{}
+	for _, set := range sets {
+		exported[set.ID] = true
+	}
+	var setImages []*models.SetImage
+	for _, image := range images {
+		if exported[image.SetID] {
+			setImages = append(setImages, image)
+		}
+	}
+
+	return models.CatalogExport{
+		SchemaVersion: models.CatalogSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Count:         len(sets),
+		Sets:          sets,
+		Images:        setImages,
+	}
+}
+
+// ExportToJSON writes every set and its images as a catalog document
+func (s *JSONService) ExportToJSON(sets []*models.LegoSet, images []*models.SetImage, writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s.NewCatalog(sets, images))
+}
+
+// ImportFromJSON reads a catalog document written by ExportToJSON
+func (s *JSONService) ImportFromJSON(reader io.Reader) (*models.CatalogExport, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	var catalog models.CatalogExport
+	if err := decoder.Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("invalid JSON catalog: %w", err)
+	}
+
+	if err := s.ValidateCatalog(&catalog); err != nil {
+		return nil, err
+	}
+
+	return &catalog, nil
+}
+
+// ValidateCatalog checks a decoded catalog's schema version and sets
+func (s *JSONService) ValidateCatalog(catalog *models.CatalogExport) error {
+	switch {
+	case catalog.SchemaVersion == 0:
+		return fmt.Errorf("invalid JSON catalog: missing schemaVersion")
+	case catalog.SchemaVersion > models.CatalogSchemaVersion:
+		return fmt.Errorf("unsupported JSON catalog schema version %d (this server reads up to %d)", catalog.SchemaVersion, models.CatalogSchemaVersion)
+	}
+
+	for i, set := range catalog.Sets {
+		if set == nil {
+			return fmt.Errorf("invalid JSON catalog: set %d is null", i+1)
+		}
+	}
+	for i, image := range catalog.Images {
+		if image == nil {
+			return fmt.Errorf("invalid JSON catalog: image %d is null", i+1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lego-catalog/internal/models"
+)
+
+// rebrickableFields are the fields filled from a Rebrickable sets dump
+var rebrickableFields = []string{"title", "release_year", "series", "num_parts", "rebrickable_url"}
+
+// rebrickableColumns maps the headers of Rebrickable's own exports to the
+// column names in its dumps, which say set_num where exports say "Set Number"
+var rebrickableColumns = map[string]string{
+	"Set Number": "set_num",
+}
+
+// RebrickableService reads files downloaded from Rebrickable: a user's set
+// list export and the public sets.csv and themes.csv database dumps
+type RebrickableService struct{}
+
+// NewRebrickableService creates a new Rebrickable service
+func NewRebrickableService() *RebrickableService {
+	return &RebrickableService{}
+}
+
+// RebrickableSet is a row of the sets.csv dump
+type RebrickableSet struct {
+	SetNum   string
+	Name     string
+	Year     int
+	ThemeID  int
+	NumParts int
+}
+
+// rebrickableTheme is a row of the themes.csv dump
+type rebrickableTheme struct {
+	name     string
+	parentID int
+}
+
+// RebrickableCatalog indexes a sets.csv dump, and themes.csv if supplied
+type RebrickableCatalog struct {
+	sets   map[string]*RebrickableSet
+	themes map[int]rebrickableTheme
+}
+
+// Len returns the number of sets in the catalog
+func (c *RebrickableCatalog) Len() int {
+	return len(c.sets)
+}
+
+// Lookup finds a set by Rebrickable set number ("10276-1") or by the plain
+// set number used in this catalog ("10276"), which is taken to be the first
+// version
+func (c *RebrickableCatalog) Lookup(setNumber string) *RebrickableSet {
+	key := strings.ToLower(strings.TrimSpace(setNumber))
+	if set := c.sets[key]; set != nil {
+		return set
+	}
+	return c.sets[key+"-1"]
+}
+
+// Theme returns the name of a theme's top-level theme, so a set in Star
+// Wars > Ultimate Collector Series gets "Star Wars". It returns "" if the
+// theme is unknown.
+func (c *RebrickableCatalog) Theme(id int) string {
+	theme, ok := c.themes[id]
+	// Bound the walk in case the dump has a cycle
+	for i := 0; ok && theme.parentID != 0 && i < 10; i++ {
+		parent, found := c.themes[theme.parentID]
+		if !found {
+			break
+		}
+		theme = parent
+	}
+	return theme.name
+}
+
+// fill copies the catalog's metadata for setNum into row. It returns false
+// if the set isn't in the catalog.
+func (c *RebrickableCatalog) fill(row *CSVRow, setNum string) bool {
+	set := c.Lookup(setNum)
+	if set == nil {
+		return false
+	}
+
+	row.Set.Title = set.Name
+	row.Filled["title"] = true
+
+	if set.Year > 0 {
+		year := set.Year
+		row.Set.ReleaseYear = &year
+		row.Filled["release_year"] = true
+	}
+	if theme := c.Theme(set.ThemeID); theme != "" {
+		row.Set.Series = &theme
+		row.Filled["series"] = true
+	}
+	if set.NumParts > 0 {
+		row.Set.NumParts = set.NumParts
+		row.Filled["num_parts"] = true
+	}
+
+	url := rebrickableURL(set.SetNum)
+	row.Set.RebrickableURL = &url
+	row.Filled["rebrickable_url"] = true
+
+	return true
+}
+
+// LoadCatalog reads a sets.csv dump and, when themes isn't nil, a themes.csv
+// dump used to fill in series names
+func (s *RebrickableService) LoadCatalog(sets io.Reader, themes io.Reader) (*RebrickableCatalog, error) {
+	catalog := &RebrickableCatalog{
+		sets:   map[string]*RebrickableSet{},
+		themes: map[int]rebrickableTheme{},
+	}
+
+	if themes != nil {
+		file, err := newNamedCSV(themes, "themes.csv", rebrickableColumns, "id", "name")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			record, err := file.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			id, err := strconv.Atoi(file.Value(record, "id"))
+			if err != nil {
+				continue
+			}
+			parentID, _ := strconv.Atoi(file.Value(record, "parent_id"))
+			catalog.themes[id] = rebrickableTheme{name: file.Value(record, "name"), parentID: parentID}
+		}
+	}
+
+	file, err := newNamedCSV(sets, "sets.csv", rebrickableColumns, "set_num", "name")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		record, err := file.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		set := &RebrickableSet{
+			SetNum: file.Value(record, "set_num"),
+			Name:   file.Value(record, "name"),
+		}
+		if set.SetNum == "" {
+			continue
+		}
+		// The dump is machine generated; a bad number just leaves it unset
+		set.Year, _ = strconv.Atoi(file.Value(record, "year"))
+		set.ThemeID, _ = strconv.Atoi(file.Value(record, "theme_id"))
+		set.NumParts, _ = strconv.Atoi(file.Value(record, "num_parts"))
+
+		catalog.sets[strings.ToLower(set.SetNum)] = set
+	}
+
+	return catalog, nil
+}
+
+// ParseSetList reads a Rebrickable set list export (set_num and quantity
+// columns) into import rows, with metadata from catalog when it isn't nil.
+// A set listed more than once has its quantities added up.
+func (s *RebrickableService) ParseSetList(reader io.Reader, catalog *RebrickableCatalog) (*CSVHeader, []*CSVRow, error) {
+	file, err := newNamedCSV(reader, "set list", rebrickableColumns, "set_num")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := &CSVHeader{Fields: []string{"set_number", "quantity_owned", "owned", "rebrickable_url"}}
+	if catalog != nil {
+		header.Fields = append(header.Fields, "title", "release_year", "series", "num_parts")
+	}
+
+	var rows []*CSVRow
+	bySetNumber := map[string]*CSVRow{}
+
+	for {
+		record, err := file.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		setNum := file.Value(record, "set_num")
+		if setNum == "" {
+			continue
+		}
+
+		quantity := 1
+		var warning string
+		if value := file.Value(record, "quantity"); value != "" {
+			var ok bool
+			if quantity, ok = parseCSVCount(value); !ok {
+				warning = fmt.Sprintf("unparseable quantity %q", value)
+			}
+		}
+
+		key := strings.ToLower(rebrickableSetNumber(setNum))
+		if row := bySetNumber[key]; row != nil {
+			if warning != "" {
+				row.Warnings = append(row.Warnings, models.FieldWarning{Field: "quantity_owned", Message: warning})
+			} else if row.Filled["quantity_owned"] {
+				row.Set.QuantityOwned += quantity
+				row.Set.Owned = row.Set.QuantityOwned > 0
+			}
+			continue
+		}
+
+		line := file.Line()
+		url := rebrickableURL(setNum)
+		row := &CSVRow{
+			Line: line,
+			Set: &models.CreateLegoSetRequest{
+				SetNumber:      rebrickableSetNumber(setNum),
+				RebrickableURL: &url,
+			},
+			Filled: map[string]bool{"set_number": true, "rebrickable_url": true},
+		}
+
+		if warning != "" {
+			row.Warnings = append(row.Warnings,
+				models.FieldWarning{Field: "quantity_owned", Message: warning},
+				models.FieldWarning{Field: "owned", Message: warning})
+		} else {
+			row.Set.QuantityOwned = quantity
+			row.Set.Owned = quantity > 0
+			row.Filled["quantity_owned"] = true
+			row.Filled["owned"] = true
+		}
+
+		if catalog != nil && !catalog.fill(row, setNum) {
+			row.Warnings = append(row.Warnings, models.FieldWarning{
+				Field:   "title",
+				Message: fmt.Sprintf("set %s isn't in the Rebrickable sets dump", setNum),
+			})
+		}
+
+		bySetNumber[key] = row
+		rows = append(rows, row)
+	}
+
+	return header, rows, nil
+}
+
+// EnrichmentRows builds import rows that fill in metadata for existing sets
+// from catalog. Unless overwrite is set, only fields that are empty are
+// filled.
+func (s *RebrickableService) EnrichmentRows(sets []*models.LegoSet, catalog *RebrickableCatalog, overwrite bool) (*CSVHeader, []*CSVRow) {
+	header := &CSVHeader{Fields: append([]string{"set_number"}, rebrickableFields...)}
+	rows := make([]*CSVRow, 0, len(sets))
+
+	for i, set := range sets {
+		row := &CSVRow{
+			Line:   i + 1,
+			Set:    &models.CreateLegoSetRequest{SetNumber: set.SetNumber},
+			Filled: map[string]bool{"set_number": true},
+		}
+
+		if !catalog.fill(row, set.SetNumber) {
+			row.Warnings = append(row.Warnings, models.FieldWarning{
+				Field:   "set_number",
+				Message: fmt.Sprintf("set %s isn't in the Rebrickable sets dump", set.SetNumber),
+			})
+		} else if !overwrite {
+			for _, field := range rebrickableFields {
+				if value := legoSetValue(set, field); value != nil && value != "" && value != 0 {
+					delete(row.Filled, field)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return header, rows
+}
+
+// rebrickableSetNumber converts a Rebrickable set number to this catalog's
+// form, dropping the "-1" of a set's first version
+func rebrickableSetNumber(setNum string) string {
+	return strings.TrimSuffix(strings.TrimSpace(setNum), "-1")
+}
+
+// rebrickableURL returns the Rebrickable page for a set
+func rebrickableURL(setNum string) string {
+	setNum = strings.TrimSpace(setNum)
+	if !strings.Contains(setNum, "-") {
+		setNum += "-1"
+	}
+	return "https://rebrickable.com/sets/" + setNum + "/"
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/draw"
+)
+
+const (
+	reportTitle = "LEGO Collection Insurance Report"
+
+	// Page layout, in millimetres on A4 paper
+	reportMargin       = 15.0
+	reportFooterHeight = 15.0
+	reportRowHeight    = 7.0
+	reportImageRow     = 20.0
+	reportThumbnail    = 18.0
+
+	// reportThumbnailPixels is the longest side of thumbnails embedded in the
+	// report, enough for print without bloating the file
+	reportThumbnailPixels = 240
+)
+
+// reportColumns are the headers and widths of the set listing, which add up
+// to the printable width of the page
+var reportColumns = []struct {
+	header string
+	width  float64
+	align  string
+}{
+	{"Image", 22, "C"},
+	{"Set Number", 20, "L"},
+	{"Title", 56, "L"},
+	{"Condition", 34, "L"},
+	{"Qty", 10, "R"},
+	{"Value", 19, "R"},
+	{"Total", 19, "R"},
+}
+
+// ReportOptions selects what an insurance report covers
+type ReportOptions struct {
+	// OwnedOnly leaves out sets that aren't owned
+	OwnedOnly bool
+	// GroupBySeries lists sets under a heading per series with subtotals
+	GroupBySeries bool
+	// PreparedBy is printed under the signature line; blank leaves a line to
+	// write a name on
+	PreparedBy string
+	// Date is the date the report is made for; zero means today
+	Date time.Time
+}
+
+// ReportService generates printable PDF reports of the collection
+type ReportService struct {
+	imageService *ImageService
+}
+
+// NewReportService creates a new report service
+func NewReportService(imageService *ImageService) *ReportService {
+	return &ReportService{imageService: imageService}
+}
+
+// reportGroup is a heading in the set listing and the sets under it
+type reportGroup struct {
+	name string
+	sets []*models.LegoSet
+}
+
+// reportTotals adds up the quantity and value of a list of sets
+type reportTotals struct {
+	sets     int
+	quantity int
+	value    float64
+	unvalued int
+}
+
+func (t *reportTotals) add(set *models.LegoSet) {
+	t.sets++
+	t.quantity += reportQuantity(set)
+	if set.ApproximateValue != nil {
+		t.value += *set.ApproximateValue * float64(reportQuantity(set))
+	} else {
+		t.unvalued++
+	}
+}
+
+// GenerateReport writes a PDF report for insurance: a signed and dated
+// summary page with the collection statistics, followed by every set with
+// its thumbnail, set number, condition, quantity and approximate value, and
+// totals
+func (s *ReportService) GenerateReport(sets []*models.LegoSet, stats *models.Statistics, opts ReportOptions, writer io.Writer) error {
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var listed []*models.LegoSet
+	var totals reportTotals
+	for _, set := range sets {
+		if opts.OwnedOnly && !set.Owned {
+			continue
+		}
+		listed = append(listed, set)
+		totals.add(set)
+	}
+
+	report := &reportWriter{
+		pdf:          fpdf.New("P", "mm", "A4", ""),
+		imageService: s.imageService,
+	}
+	pdf := report.pdf
+	report.tr = pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetMargins(reportMargin, reportMargin, reportMargin)
+	pdf.SetAutoPageBreak(false, reportFooterHeight)
+	pdf.AliasNbPages("")
+	pdf.SetTitle(reportTitle, true)
+	pdf.SetCreator("LEGO Catalog", true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-reportFooterHeight + 3)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.CellFormat(0, 5, report.tr(fmt.Sprintf("%s, %s - page %d of {nb}", reportTitle, formatReportDate(date), pdf.PageNo())), "", 0, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	})
+
+	report.summaryPage(stats, &totals, opts, date)
+
+	groups := []reportGroup{{sets: listed}}
+	if opts.GroupBySeries {
+		groups = groupBySeries(listed)
+	}
+	report.listing(groups, &totals, opts.GroupBySeries)
+
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("failed to generate report: %w", err)
+	}
+	return pdf.Output(writer)
+}
+
+// reportWriter lays out a report on one PDF document
+type reportWriter struct {
+	pdf          *fpdf.Fpdf
+	tr           func(string) string
+	imageService *ImageService
+}
+
+// summaryPage writes the first page, with totals for the listed sets, the
+// statistics for the whole collection, and a declaration to sign and date
+func (r *reportWriter) summaryPage(stats *models.Statistics, totals *reportTotals, opts ReportOptions, date time.Time) {
+	pdf := r.pdf
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, r.tr(reportTitle), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	scope := "All sets in the catalog"
+	if opts.OwnedOnly {
+		scope = "Owned sets"
+	}
+	pdf.CellFormat(0, 6, r.tr(fmt.Sprintf("%s, as of %s", scope, formatReportDate(date))), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	r.section("This report")
+	r.summaryLine("Sets listed", strconv.Itoa(totals.sets))
+	r.summaryLine("Items (counting quantities)", strconv.Itoa(totals.quantity))
+	r.summaryLine("Total approximate value", formatDollars(totals.value))
+	if totals.unvalued > 0 {
+		r.summaryLine("Sets without a value", strconv.Itoa(totals.unvalued))
+	}
+	pdf.Ln(4)
+
+	r.section("Whole collection")
+	r.summaryLine("Sets in the catalog", strconv.Itoa(stats.TotalSets))
+	r.summaryLine("Owned sets", strconv.Itoa(stats.OwnedSets))
+	r.summaryLine("Pieces owned", strconv.Itoa(stats.TotalPieces))
+	r.summaryLine("Minifigs owned", strconv.Itoa(stats.TotalMinifigs))
+	r.summaryLine("Value of owned sets", formatDollars(stats.TotalValue))
+	r.summaryLine("Average value per owned set", formatDollars(stats.AverageValue))
+	r.summaryLine("Most expensive set", reportSetLabel(stats.MostExpensiveSet))
+	r.summaryLine("Largest set", reportSetLabel(stats.LargestSet))
+	r.summaryLine("Oldest set", reportSetLabel(stats.OldestSet))
+	r.summaryLine("Newest set", reportSetLabel(stats.NewestSet))
+	pdf.Ln(10)
+
+	r.section("Declaration")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.MultiCell(0, 5, r.tr(fmt.Sprintf(
+		"I declare that the sets listed in this report are in my possession and that, to the best of my knowledge, "+
+			"their details and approximate values are accurate as of %s.", formatReportDate(date))), "", "L", false)
+	pdf.Ln(16)
+
+	name := opts.PreparedBy
+	if name == "" {
+		name = strings.Repeat("_", 40)
+	}
+	r.summaryLine("Signature", strings.Repeat("_", 40))
+	pdf.Ln(6)
+	r.summaryLine("Name", name)
+	pdf.Ln(6)
+	r.summaryLine("Date", formatReportDate(date))
+}
+
+func (r *reportWriter) section(title string) {
+	r.pdf.SetFont("Helvetica", "B", 13)
+	r.pdf.CellFormat(0, 8, r.tr(title), "B", 1, "L", false, 0, "")
+	r.pdf.Ln(2)
+}
+
+func (r *reportWriter) summaryLine(label, value string) {
+	r.pdf.SetFont("Helvetica", "", 10)
+	r.pdf.CellFormat(70, 6, r.tr(label), "", 0, "L", false, 0, "")
+	r.pdf.SetFont("Helvetica", "B", 10)
+	r.pdf.CellFormat(0, 6, r.fit(value, 180-70), "", 1, "L", false, 0, "")
+}
+
+// listing writes the set table, starting on a new page
+func (r *reportWriter) listing(groups []reportGroup, totals *reportTotals, subtotals bool) {
+	pdf := r.pdf
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 8, r.tr("Sets"), "", 1, "L", false, 0, "")
+	r.tableHeader()
+
+	for _, group := range groups {
+		var groupTotals reportTotals
+		if subtotals {
+			r.ensureSpace(reportRowHeight + reportImageRow)
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.SetFillColor(235, 235, 235)
+			pdf.CellFormat(0, reportRowHeight, r.fit(group.name, 180), "1", 1, "L", true, 0, "")
+		}
+
+		for _, set := range group.sets {
+			r.setRow(set)
+			groupTotals.add(set)
+		}
+
+		if subtotals {
+			r.totalRow(fmt.Sprintf("Subtotal for %s", group.name), &groupTotals)
+		}
+	}
+
+	r.totalRow("Total", totals)
+}
+
+func (r *reportWriter) tableHeader() {
+	pdf := r.pdf
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(221, 235, 247)
+	for _, column := range reportColumns {
+		pdf.CellFormat(column.width, reportRowHeight, column.header, "1", 0, column.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// ensureSpace starts a new page, repeating the table header, when fewer
+// than height millimetres are left on this one
+func (r *reportWriter) ensureSpace(height float64) {
+	_, pageHeight := r.pdf.GetPageSize()
+	if r.pdf.GetY()+height <= pageHeight-reportFooterHeight {
+		return
+	}
+	r.pdf.AddPage()
+	r.tableHeader()
+}
+
+func (r *reportWriter) setRow(set *models.LegoSet) {
+	pdf := r.pdf
+
+	thumbnail, width, height := r.thumbnail(set)
+	rowHeight := reportRowHeight
+	if thumbnail != "" {
+		rowHeight = reportImageRow
+	}
+	r.ensureSpace(rowHeight)
+
+	x, y := pdf.GetXY()
+	value := "-"
+	total := "-"
+	if set.ApproximateValue != nil {
+		value = formatDollars(*set.ApproximateValue)
+		total = formatDollars(*set.ApproximateValue * float64(reportQuantity(set)))
+	}
+	cells := []string{"", set.SetNumber, set.Title, stringOrEmpty(set.ConditionDescription), strconv.Itoa(reportQuantity(set)), value, total}
+
+	pdf.SetFont("Helvetica", "", 9)
+	for i, column := range reportColumns {
+		pdf.CellFormat(column.width, rowHeight, r.fit(cells[i], column.width-2), "1", 0, column.align, false, 0, "")
+	}
+	pdf.Ln(-1)
+
+	if thumbnail != "" {
+		// Centre the thumbnail in the image cell
+		imageX := x + (reportColumns[0].width-width)/2
+		imageY := y + (rowHeight-height)/2
+		pdf.ImageOptions(thumbnail, imageX, imageY, width, height, false, fpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+	}
+}
+
+func (r *reportWriter) totalRow(label string, totals *reportTotals) {
+	pdf := r.pdf
+	r.ensureSpace(reportRowHeight)
+
+	labelWidth := 0.0
+	for _, column := range reportColumns[:4] {
+		labelWidth += column.width
+	}
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(labelWidth, reportRowHeight, r.fit(label, labelWidth-2), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(reportColumns[4].width, reportRowHeight, strconv.Itoa(totals.quantity), "1", 0, "R", false, 0, "")
+	pdf.CellFormat(reportColumns[5].width+reportColumns[6].width, reportRowHeight, formatDollars(totals.value), "1", 1, "R", false, 0, "")
+}
+
+// thumbnail registers a scaled down copy of a set's image with the document
+// and returns its name and size on the page. Sets without an image, or
+// whose image can't be read, get no thumbnail.
+func (r *reportWriter) thumbnail(set *models.LegoSet) (string, float64, float64) {
+	if set.ImageFilename == nil || r.imageService == nil {
+		return "", 0, 0
+	}
+	name := *set.ImageFilename
+
+	if info := r.pdf.GetImageInfo(name); info != nil {
+		width, height := fitThumbnail(info.Width(), info.Height())
+		return name, width, height
+	}
+
+	file, err := r.imageService.OpenImage(name)
+	if err != nil {
+		return "", 0, 0
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", 0, 0
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleThumbnail(img), &jpeg.Options{Quality: 85}); err != nil {
+		return "", 0, 0
+	}
+	info := r.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "JPG"}, &buf)
+	if info == nil {
+		return "", 0, 0
+	}
+
+	width, height := fitThumbnail(info.Width(), info.Height())
+	return name, width, height
+}
+
+// scaleThumbnail shrinks img to at most reportThumbnailPixels on its longest
+// side
+func scaleThumbnail(img image.Image) image.Image {
+	return scaleToFit(img, reportThumbnailPixels, draw.ApproxBiLinear)
+}
+
+// fitThumbnail returns the size of an image scaled to fit the thumbnail box
+func fitThumbnail(width, height float64) (float64, float64) {
+	if width <= 0 || height <= 0 {
+		return reportThumbnail, reportThumbnail
+	}
+	if width >= height {
+		return reportThumbnail, reportThumbnail * height / width
+	}
+	return reportThumbnail * width / height, reportThumbnail
+}
+
+// fit translates text for the PDF's core fonts and shortens it with an
+// ellipsis to fit width millimetres in the current font
+func (r *reportWriter) fit(text string, width float64) string {
+	text = r.tr(text)
+	if r.pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && r.pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return strings.TrimSpace(text) + "..."
+}
+
+// groupBySeries splits sets by series, sorted by name with sets without a
+// series last
+func groupBySeries(sets []*models.LegoSet) []reportGroup {
+	index := map[string]int{}
+	var groups []reportGroup
+	for _, set := range sets {
+		name := stringOrEmpty(set.Series)
+		if name == "" {
+			name = noSeriesLabel
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, reportGroup{name: name})
+		}
+		groups[i].sets = append(groups[i].sets, set)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i].name, groups[j].name
+		if (a == noSeriesLabel) != (b == noSeriesLabel) {
+			return b == noSeriesLabel
+		}
+		return a < b
+	})
+	return groups
+}
+
+// reportQuantity is how many of a set are counted. As in the statistics,
+// sets that aren't owned count for nothing.
+func reportQuantity(set *models.LegoSet) int {
+	if !set.Owned {
+		return 0
+	}
+	return set.QuantityOwned
+}
+
+func reportSetLabel(set *models.LegoSet) string {
+	if set == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s %s", set.SetNumber, set.Title)
+}
+
+func formatReportDate(date time.Time) string {
+	return date.Format("January 2, 2006")
+}
+
+// formatDollars formats an amount as dollars with thousands separators
+func formatDollars(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	whole, cents := math.Modf(amount)
+	digits := strconv.FormatFloat(whole, 'f', 0, 64)
+	hundredths := int(math.Round(cents * 100))
+	if hundredths == 100 {
+		digits = strconv.FormatFloat(whole+1, 'f', 0, 64)
+		hundredths = 0
+	}
+
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s$%s.%02d", sign, grouped.String(), hundredths)
+}
@@ -0,0 +1,546 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultS3Region is used when no region is configured. MinIO accepts
+	// it whatever its own region setting.
+	defaultS3Region = "us-east-1"
+	// defaultPresignExpiry is how long redirect URLs are valid by default
+	defaultPresignExpiry = 15 * time.Minute
+	// maxPresignExpiry is the longest a SigV4 presigned URL can be valid
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// defaultS3CacheTTL is how long Exists results are cached by default
+	defaultS3CacheTTL = time.Minute
+	// defaultS3CacheSize is how many Exists results are cached by default
+	defaultS3CacheSize = 10000
+
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3DateFormat    = "20060102"
+	s3TimeFormat    = "20060102T150405Z"
+	s3UnsignedBody  = "UNSIGNED-PAYLOAD"
+	s3ErrorBodySize = 64 << 10
+)
+
+// S3Config configures an S3ImageStorage
+type S3Config struct {
+	// Endpoint is the base URL of the S3 API, like http://localhost:9000 for
+	// MinIO. It defaults to AWS S3 in Region.
+	Endpoint string
+	// Region signs requests (default us-east-1)
+	Region string
+	Bucket string
+	// Prefix is prepended to every key, so the bucket can hold other files
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle puts the bucket in the URL path rather than the host name,
+	// as MinIO and most other S3-compatible servers expect
+	PathStyle bool
+	// Proxy makes /images/ stream files from the bucket instead of
+	// redirecting to presigned URLs, for buckets browsers can't reach
+	Proxy bool
+	// PresignExpiry is how long presigned URLs are valid (default 15 minutes)
+	PresignExpiry time.Duration
+	// CacheTTL is how long Exists results are cached (default 1 minute). A
+	// negative TTL turns the cache off.
+	CacheTTL time.Duration
+	// CacheSize is how many Exists results are cached (default 10000)
+	CacheSize int
+	// Client sends the requests (default one with a 30 second timeout)
+	Client *http.Client
+	// Now is the clock requests are signed with (default time.Now)
+	Now func() time.Time
+}
+
+// S3ImageStorage stores images in a bucket of an S3-compatible service such
+// as AWS S3, MinIO or Google Cloud Storage. Requests are signed with AWS
+// Signature Version 4.
+type S3ImageStorage struct {
+	config   S3Config
+	endpoint *url.URL
+	prefix   string
+	// exists caches Exists results, since building an image's URLs checks
+	// whether its variants exist. Changes made by another server show up
+	// once the entry expires.
+	exists *s3ExistsCache
+}
+
+// NewS3ImageStorage creates a storage for the images in an S3 bucket
+func NewS3ImageStorage(config S3Config) (*S3ImageStorage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+	if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("S3 access key ID and secret access key are required")
+	}
+	if config.Region == "" {
+		config.Region = defaultS3Region
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	switch {
+	case config.PresignExpiry == 0:
+		config.PresignExpiry = defaultPresignExpiry
+	case config.PresignExpiry < time.Second || config.PresignExpiry > maxPresignExpiry:
+		return nil, fmt.Errorf("invalid S3 presign expiry %s (expected 1s to %s)", config.PresignExpiry, maxPresignExpiry)
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = defaultS3CacheTTL
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = defaultS3CacheSize
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3ImageStorage{
+		config:   config,
+		endpoint: endpoint,
+		prefix:   prefix,
+		exists:   newS3ExistsCache(config.CacheTTL, config.CacheSize, config.Now),
+	}, nil
+}
+
+// Put uploads a file. The whole file is read first since S3 needs its
+// length and checksum up front.
+func (s *S3ImageStorage) Put(key string, reader io.Reader) error {
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	resp, err := s.send(context.Background(), http.MethodPut, key, body, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	resp.Body.Close()
+
+	s.exists.set(key, true)
+	return nil
+}
+
+// Open downloads a file
+func (s *S3ImageStorage) Open(key string) (*StoredImage, error) {
+	resp, err := s.send(context.Background(), http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image %s: %w", key, err)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &StoredImage{ReadCloser: resp.Body, ModTime: modTime}, nil
+}
+
+// Exists checks for a file with a HEAD request, unless the answer is
+// cached
+func (s *S3ImageStorage) Exists(key string) (bool, error) {
+	if exists, ok := s.exists.get(key); ok {
+		return exists, nil
+	}
+
+	resp, err := s.send(context.Background(), http.MethodHead, key, nil, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.exists.set(key, false)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	s.exists.set(key, true)
+	return true, nil
+}
+
+// Delete removes a file from the bucket
+func (s *S3ImageStorage) Delete(key string) error {
+	s.exists.remove(key)
+
+	resp, err := s.send(context.Background(), http.MethodDelete, key, nil, nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete image: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3ExistsCache remembers whether keys exist for a while. The least
+// recently used entries are dropped once it is full.
+type s3ExistsCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// s3ExistsEntry is a cached Exists result
+type s3ExistsEntry struct {
+	key     string
+	exists  bool
+	expires time.Time
+}
+
+func newS3ExistsCache(ttl time.Duration, size int, now func() time.Time) *s3ExistsCache {
+	return &s3ExistsCache{ttl: ttl, size: size, now: now, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get returns a key's cached result, if it hasn't expired
+func (c *s3ExistsCache) get(key string) (exists, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	entry := elem.Value.(*s3ExistsEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return false, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.exists, true
+}
+
+// set caches a key's result
+func (c *s3ExistsCache) set(key string, exists bool) {
+	if c.ttl < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &s3ExistsEntry{key: key, exists: exists, expires: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*s3ExistsEntry).key)
+	}
+}
+
+// remove forgets a key
+func (c *s3ExistsCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// ServeHTTP redirects to a presigned URL for the file, or streams it from
+// the bucket when Proxy is set
+func (s *S3ImageStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if !validImageKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.config.Proxy {
+		s.proxy(w, r, key)
+		return
+	}
+	location, err := s.PresignURL(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// s3ProxyRequestHeaders are passed on to the bucket so range and
+// conditional requests work through the proxy
+var s3ProxyRequestHeaders = []string{
+	"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+}
+
+// s3ProxyResponseHeaders are passed back from the bucket
+var s3ProxyResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", "Cache-Control",
+}
+
+// proxy streams a file from the bucket
+func (s *S3ImageStorage) proxy(w http.ResponseWriter, r *http.Request, key string) {
+	header := http.Header{}
+	for _, name := range s3ProxyRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+
+	resp, err := s.send(r.Context(), r.Method, key, nil, header)
+	var status *s3StatusError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+		return
+	case errors.As(err, &status) && (status.StatusCode == http.StatusNotModified ||
+		status.StatusCode == http.StatusPreconditionFailed ||
+		status.StatusCode == http.StatusRequestedRangeNotSatisfiable):
+		w.WriteHeader(status.StatusCode)
+		return
+	case err != nil:
+		log.Printf("Failed to load image %s from S3: %v", key, err)
+		http.Error(w, "Failed to load image", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, name := range s3ProxyResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// PresignURL returns a URL that downloads a file without credentials until
+// PresignExpiry has passed
+func (s *S3ImageStorage) PresignURL(key string) (string, error) {
+	if !validImageKey(key) {
+		return "", fmt.Errorf("%w: %q", errInvalidImageFilename, key)
+	}
+
+	now := s.config.Now().UTC()
+	u := s.objectURL(key)
+	query := canonicalS3Query(url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.config.AccessKeyID + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(s3TimeFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(s.config.PresignExpiry / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	})
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, u.EscapedPath(), query, "host:" + u.Host + "\n", "host", s3UnsignedBody,
+	}, "\n")
+	u.RawQuery = query + "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+// s3StatusError is a response from S3 other than success
+type s3StatusError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *s3StatusError) Error() string {
+	msg := fmt.Sprintf("S3 responded %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap makes a missing key match fs.ErrNotExist. A missing bucket doesn't.
+func (e *s3StatusError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket" {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// send makes a signed request for a key. Responses other than 2xx are
+// closed and returned as an *s3StatusError.
+func (s *S3ImageStorage) send(ctx context.Context, method, key string, body []byte, header http.Header) (*http.Response, error) {
+	if !validImageKey(key) {
+		return nil, fmt.Errorf("%w: %q", errInvalidImageFilename, key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, body)
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// HEAD responses and some servers' errors have no error document
+	statusErr := &s3StatusError{StatusCode: resp.StatusCode}
+	var doc struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.NewDecoder(io.LimitReader(resp.Body, s3ErrorBodySize)).Decode(&doc) == nil {
+		statusErr.Code, statusErr.Message = doc.Code, doc.Message
+	}
+	return nil, statusErr
+}
+
+// objectURL returns the URL of a key in the bucket
+func (s *S3ImageStorage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	objectPath := "/" + s.prefix + key
+	if s.config.PathStyle {
+		objectPath = "/" + s.config.Bucket + objectPath
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+
+	u.Path = strings.TrimSuffix(s.endpoint.Path, "/") + objectPath
+	u.RawPath = escapeS3(u.Path, false)
+	u.RawQuery = ""
+	return &u
+}
+
+// sign adds the Authorization header of AWS Signature Version 4, signing
+// the host, date and body checksum
+func (s *S3ImageStorage) sign(req *http.Request, body []byte) {
+	now := s.config.Now().UTC()
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + now.Format(s3TimeFormat) + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), canonicalS3Query(req.URL.Query()), canonicalHeaders, signedHeaders, payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.config.AccessKeyID, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+// scope is the credential scope of requests signed at now
+func (s *S3ImageStorage) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived from the secret
+func (s *S3ImageStorage) signature(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm, now.Format(s3TimeFormat), s.scope(now), sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalS3Query encodes query parameters sorted by name, as SigV4 signs
+// them
+func canonicalS3Query(values url.Values) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, name := range names {
+		vals := append([]string(nil), values[name]...)
+		sort.Strings(vals)
+		for _, value := range vals {
+			pairs = append(pairs, escapeS3(name, true)+"="+escapeS3(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// escapeS3 percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set
+func escapeS3(s string, encodeSlash bool) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"lego-catalog/internal/models"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	xlsxSetsSheet       = "Sets"
+	xlsxStatisticsSheet = "Statistics"
+	xlsxSeriesSheet     = "Series"
+
+	// xlsxCurrencyFormat matches the dollar values used elsewhere
+	xlsxCurrencyFormat = `"$"#,##0.00`
+	xlsxDateFormat     = "yyyy-mm-dd"
+
+	// noSeriesLabel stands in for the series of sets without one in summaries
+	noSeriesLabel = "(No series)"
+)
+
+// xlsxColumnWidths sets the width of the wider Sets sheet columns by field
+var xlsxColumnWidths = map[string]float64{
+	"set_number":            14,
+	"alternate_set_number":  14,
+	"title":                 36,
+	"description":           40,
+	"series":                20,
+	"bricklink_url":         40,
+	"rebrickable_url":       40,
+	"approximate_value":     14,
+	"value_last_updated":    14,
+	"condition_description": 24,
+	"image_filename":        24,
+	"notes":                 40,
+}
+
+// XLSXService handles Excel workbook exports
+type XLSXService struct{}
+
+// NewXLSXService creates a new XLSX service
+func NewXLSXService() *XLSXService {
+	return &XLSXService{}
+}
+
+// xlsxStyles holds the style IDs used across the workbook
+type xlsxStyles struct {
+	header   int
+	currency int
+	date     int
+	link     int
+	total    int
+}
+
+// ExportToXLSX writes a workbook with a Sets sheet holding every set with
+// typed cells, a Statistics sheet, and a per-series summary
+func (s *XLSXService) ExportToXLSX(sets []*models.LegoSet, stats *models.Statistics, writer io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	styles, err := newXLSXStyles(f)
+	if err != nil {
+		return fmt.Errorf("failed to create styles: %w", err)
+	}
+
+	if err := f.SetSheetName("Sheet1", xlsxSetsSheet); err != nil {
+		return err
+	}
+	if err := writeXLSXSets(f, styles, sets); err != nil {
+		return fmt.Errorf("failed to write sets sheet: %w", err)
+	}
+
+	if _, err := f.NewSheet(xlsxStatisticsSheet); err != nil {
+		return err
+	}
+	if err := writeXLSXStatistics(f, styles, stats); err != nil {
+		return fmt.Errorf("failed to write statistics sheet: %w", err)
+	}
+
+	if _, err := f.NewSheet(xlsxSeriesSheet); err != nil {
+		return err
+	}
+	if err := writeXLSXSeries(f, styles, sets); err != nil {
+		return fmt.Errorf("failed to write series sheet: %w", err)
+	}
+
+	return f.Write(writer)
+}
+
+func newXLSXStyles(f *excelize.File) (*xlsxStyles, error) {
+	currencyFormat := xlsxCurrencyFormat
+	dateFormat := xlsxDateFormat
+
+	var styles xlsxStyles
+	var err error
+	if styles.header, err = f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}},
+	}); err != nil {
+		return nil, err
+	}
+	if styles.currency, err = f.NewStyle(&excelize.Style{CustomNumFmt: &currencyFormat}); err != nil {
+		return nil, err
+	}
+	if styles.date, err = f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat}); err != nil {
+		return nil, err
+	}
+	if styles.link, err = f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "0563C1", Underline: "single"},
+	}); err != nil {
+		return nil, err
+	}
+	if styles.total, err = f.NewStyle(&excelize.Style{
+		Font:         &excelize.Font{Bold: true},
+		CustomNumFmt: &currencyFormat,
+	}); err != nil {
+		return nil, err
+	}
+	return &styles, nil
+}
+
+// writeXLSXSets writes one row per set with the same columns as the CSV
+// export. Set numbers are stored as text so leading zeros survive.
+func writeXLSXSets(f *excelize.File, styles *xlsxStyles, sets []*models.LegoSet) error {
+	header := make([]interface{}, len(csvColumns))
+	for i, column := range csvColumns {
+		header[i] = column.Header
+	}
+	if err := writeXLSXHeader(f, styles, xlsxSetsSheet, header); err != nil {
+		return err
+	}
+
+	for i, column := range csvColumns {
+		name, _ := excelize.ColumnNumberToName(i + 1)
+		width := 12.0
+		if w, ok := xlsxColumnWidths[column.Field]; ok {
+			width = w
+		}
+		if err := f.SetColWidth(xlsxSetsSheet, name, name, width); err != nil {
+			return err
+		}
+	}
+
+	for i, set := range sets {
+		row := i + 2
+		values := []interface{}{
+			set.SetNumber,
+			stringOrEmpty(set.AlternateSetNumber),
+			set.Title,
+			set.Owned,
+			set.QuantityOwned,
+			xlsxInt(set.ReleaseYear),
+			stringOrEmpty(set.Description),
+			stringOrEmpty(set.Series),
+			set.NumParts,
+			set.NumMinifigs,
+			stringOrEmpty(set.BricklinkURL),
+			stringOrEmpty(set.RebrickableURL),
+			xlsxFloat(set.ApproximateValue),
+			xlsxDate(set.ValueLastUpdated),
+			stringOrEmpty(set.ConditionDescription),
+			stringOrEmpty(set.ImageFilename),
+			stringOrEmpty(set.Notes),
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err := f.SetSheetRow(xlsxSetsSheet, cell, &values); err != nil {
+			return err
+		}
+
+		for col, column := range csvColumns {
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			switch column.Field {
+			case "approximate_value":
+				if err := f.SetCellStyle(xlsxSetsSheet, cell, cell, styles.currency); err != nil {
+					return err
+				}
+			case "value_last_updated":
+				if err := f.SetCellStyle(xlsxSetsSheet, cell, cell, styles.date); err != nil {
+					return err
+				}
+			case "bricklink_url", "rebrickable_url":
+				url, _ := values[col].(string)
+				if url == "" {
+					continue
+				}
+				if err := f.SetCellHyperLink(xlsxSetsSheet, cell, url, "External"); err != nil {
+					return err
+				}
+				if err := f.SetCellStyle(xlsxSetsSheet, cell, cell, styles.link); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	lastColumn, _ := excelize.ColumnNumberToName(len(csvColumns))
+	if err := f.AutoFilter(xlsxSetsSheet, fmt.Sprintf("A1:%s%d", lastColumn, len(sets)+1), nil); err != nil {
+		return err
+	}
+	return freezeXLSXHeader(f, xlsxSetsSheet)
+}
+
+// writeXLSXStatistics writes the collection statistics as label and value
+// rows
+func writeXLSXStatistics(f *excelize.File, styles *xlsxStyles, stats *models.Statistics) error {
+	if err := writeXLSXHeader(f, styles, xlsxStatisticsSheet, []interface{}{"Statistic", "Value"}); err != nil {
+		return err
+	}
+
+	rows := []struct {
+		label    string
+		value    interface{}
+		currency bool
+	}{
+		{label: "Total sets", value: stats.TotalSets},
+		{label: "Owned sets", value: stats.OwnedSets},
+		{label: "Total pieces (owned)", value: stats.TotalPieces},
+		{label: "Total minifigs (owned)", value: stats.TotalMinifigs},
+		{label: "Total value (owned)", value: stats.TotalValue, currency: true},
+		{label: "Average value (owned)", value: stats.AverageValue, currency: true},
+		{label: "Most expensive set", value: xlsxSetLabel(stats.MostExpensiveSet)},
+		{label: "Largest set", value: xlsxSetLabel(stats.LargestSet)},
+		{label: "Oldest set", value: xlsxSetLabel(stats.OldestSet)},
+		{label: "Newest set", value: xlsxSetLabel(stats.NewestSet)},
+	}
+
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(xlsxStatisticsSheet, cell, &[]interface{}{row.label, row.value}); err != nil {
+			return err
+		}
+		if row.currency {
+			valueCell, _ := excelize.CoordinatesToCellName(2, i+2)
+			if err := f.SetCellStyle(xlsxStatisticsSheet, valueCell, valueCell, styles.currency); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := f.SetColWidth(xlsxStatisticsSheet, "A", "A", 24); err != nil {
+		return err
+	}
+	return f.SetColWidth(xlsxStatisticsSheet, "B", "B", 40)
+}
+
+// xlsxSeriesSummary totals the sets in one series. Pieces, minifigs and
+// value count owned sets only, times the quantity, as the statistics do.
+type xlsxSeriesSummary struct {
+	series        string
+	sets          int
+	ownedSets     int
+	quantityOwned int
+	pieces        int
+	minifigs      int
+	value         float64
+}
+
+// writeXLSXSeries writes a summary row per series with a totals row
+func writeXLSXSeries(f *excelize.File, styles *xlsxStyles, sets []*models.LegoSet) error {
+	header := []interface{}{"Series", "Sets", "Owned Sets", "Quantity Owned", "Pieces Owned", "Minifigs Owned", "Value Owned"}
+	if err := writeXLSXHeader(f, styles, xlsxSeriesSheet, header); err != nil {
+		return err
+	}
+
+	summaries := summarizeSeries(sets)
+	for i, summary := range summaries {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		values := []interface{}{summary.series, summary.sets, summary.ownedSets, summary.quantityOwned, summary.pieces, summary.minifigs, summary.value}
+		if err := f.SetSheetRow(xlsxSeriesSheet, cell, &values); err != nil {
+			return err
+		}
+	}
+
+	last := len(summaries) + 1
+	totalRow := last + 1
+	if err := f.SetCellValue(xlsxSeriesSheet, fmt.Sprintf("A%d", totalRow), "Total"); err != nil {
+		return err
+	}
+	for col := 2; col <= len(header); col++ {
+		name, _ := excelize.ColumnNumberToName(col)
+		cell := fmt.Sprintf("%s%d", name, totalRow)
+		if err := f.SetCellFormula(xlsxSeriesSheet, cell, fmt.Sprintf("SUM(%s2:%s%d)", name, name, last)); err != nil {
+			return err
+		}
+	}
+
+	if err := f.SetCellStyle(xlsxSeriesSheet, "G2", fmt.Sprintf("G%d", totalRow), styles.currency); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(xlsxSeriesSheet, fmt.Sprintf("A%d", totalRow), fmt.Sprintf("G%d", totalRow), styles.total); err != nil {
+		return err
+	}
+
+	if err := f.SetColWidth(xlsxSeriesSheet, "A", "A", 28); err != nil {
+		return err
+	}
+	if err := f.SetColWidth(xlsxSeriesSheet, "B", "G", 15); err != nil {
+		return err
+	}
+	return freezeXLSXHeader(f, xlsxSeriesSheet)
+}
+
+// summarizeSeries totals sets by series, sorted by name with sets without
+// a series last
+func summarizeSeries(sets []*models.LegoSet) []*xlsxSeriesSummary {
+	bySeries := map[string]*xlsxSeriesSummary{}
+	for _, set := range sets {
+		name := stringOrEmpty(set.Series)
+		if name == "" {
+			name = noSeriesLabel
+		}
+
+		summary := bySeries[name]
+		if summary == nil {
+			summary = &xlsxSeriesSummary{series: name}
+			bySeries[name] = summary
+		}
+
+		summary.sets++
+		if !set.Owned {
+			continue
+		}
+		summary.ownedSets++
+		summary.quantityOwned += set.QuantityOwned
+		summary.pieces += set.NumParts * set.QuantityOwned
+		summary.minifigs += set.NumMinifigs * set.QuantityOwned
+		if set.ApproximateValue != nil {
+			summary.value += *set.ApproximateValue * float64(set.QuantityOwned)
+		}
+	}
+
+	summaries := make([]*xlsxSeriesSummary, 0, len(bySeries))
+	for _, summary := range bySeries {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i].series, summaries[j].series
+		if (a == noSeriesLabel) != (b == noSeriesLabel) {
+			return b == noSeriesLabel
+		}
+		return a < b
+	})
+	return summaries
+}
+
+func writeXLSXHeader(f *excelize.File, styles *xlsxStyles, sheet string, header []interface{}) error {
+	if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+		return err
+	}
+	last, _ := excelize.CoordinatesToCellName(len(header), 1)
+	return f.SetCellStyle(sheet, "A1", last, styles.header)
+}
+
+func freezeXLSXHeader(f *excelize.File, sheet string) error {
+	return f.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	})
+}
+
+// xlsxInt returns nil for a missing number so the cell stays empty
+func xlsxInt(i *int) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func xlsxFloat(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// xlsxDate returns the date part of t, which Excel stores as a serial date
+func xlsxDate(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// xlsxSetLabel describes a highlighted set on the Statistics sheet
+func xlsxSetLabel(set *models.LegoSet) string {
+	if set == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s", set.SetNumber, set.Title)
+}
@@ -0,0 +1,95 @@
+// Package web serves the compiled React frontend from the server binary.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// dist holds the frontend build output. It is populated by copying
+// frontend/dist into internal/web/dist before building the server.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// DistFS returns the embedded frontend build
+func DistFS() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// HasIndex reports whether fsys contains a built frontend
+func HasIndex(fsys fs.FS) bool {
+	info, err := fs.Stat(fsys, "index.html")
+	return err == nil && !info.IsDir()
+}
+
+// SPAHandler serves static files from fsys and falls back to index.html for
+// any other path so client-side routes survive a page reload
+type SPAHandler struct {
+	fsys       fs.FS
+	fileServer http.Handler
+}
+
+// NewSPAHandler creates a handler for the frontend build in fsys
+func NewSPAHandler(fsys fs.FS) *SPAHandler {
+	return &SPAHandler{
+		fsys:       fsys,
+		fileServer: http.FileServer(http.FS(fsys)),
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (h *SPAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Unknown API and image paths should 404 rather than return the app
+	if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/images/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	if name != "" && name != "index.html" {
+		if info, err := fs.Stat(h.fsys, name); err == nil && !info.IsDir() {
+			// Vite fingerprints everything under assets/
+			if strings.HasPrefix(name, "assets/") {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+			h.fileServer.ServeHTTP(w, r)
+			return
+		}
+
+		// Missing files with an extension are real 404s, not app routes
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	h.serveIndex(w, r)
+}
+
+func (h *SPAHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	index, err := fs.ReadFile(h.fsys, "index.html")
+	if err != nil {
+		http.Error(w, "Frontend not built", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(index)
+	}
+}
@@ -1,5 +0,0 @@
--- Add condition_description and rebrickable_url fields to lego_sets table
--- Note: This migration was already applied manually.
--- Columns condition_description and rebrickable_url already exist in the database.
-
-SELECT 1;
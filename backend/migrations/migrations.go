@@ -0,0 +1,24 @@
+// Package migrations embeds the SQL migration files so the server binary
+// does not depend on its working directory. Each supported database dialect
+// has its own directory with the same migration versions.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// FS contains one directory of NNN_name.up.sql and NNN_name.down.sql
+// migration files per dialect
+//
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var FS embed.FS
+
+// ForDialect returns the migrations for the named dialect
+func ForDialect(name string) (fs.FS, error) {
+	if _, err := fs.Stat(FS, name); err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q", name)
+	}
+	return fs.Sub(FS, name)
+}
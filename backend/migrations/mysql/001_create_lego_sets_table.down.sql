@@ -0,0 +1,2 @@
+-- Drop lego_sets table
+DROP TABLE IF EXISTS lego_sets;
@@ -0,0 +1,4 @@
+-- Remove condition_description and rebrickable_url fields from lego_sets table
+ALTER TABLE lego_sets
+    DROP COLUMN condition_description,
+    DROP COLUMN rebrickable_url;
@@ -0,0 +1,6 @@
+-- Add condition_description and rebrickable_url fields to lego_sets table
+-- Databases created before versioned migrations already have these columns;
+-- the migrator records this version as applied for them without running it.
+ALTER TABLE lego_sets
+    ADD COLUMN rebrickable_url VARCHAR(500) AFTER bricklink_url,
+    ADD COLUMN condition_description TEXT AFTER value_last_updated;
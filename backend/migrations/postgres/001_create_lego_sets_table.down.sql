@@ -0,0 +1,3 @@
+-- Drop lego_sets table
+DROP TABLE IF EXISTS lego_sets;
+DROP FUNCTION IF EXISTS lego_sets_set_updated_at();
@@ -0,0 +1,43 @@
+-- Create lego_sets table
+-- CITEXT columns match MySQL's case-insensitive utf8mb4_unicode_ci collation
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE IF NOT EXISTS lego_sets (
+    id CHAR(36) PRIMARY KEY,
+    set_number CITEXT NOT NULL UNIQUE CHECK (char_length(set_number) <= 50),
+    alternate_set_number VARCHAR(50),
+    title CITEXT NOT NULL CHECK (char_length(title) <= 255),
+    owned BOOLEAN DEFAULT FALSE,
+    quantity_owned INTEGER DEFAULT 0,
+    release_year INTEGER,
+    description TEXT,
+    series CITEXT CHECK (char_length(series) <= 255),
+    num_parts INTEGER DEFAULT 0,
+    num_minifigs INTEGER DEFAULT 0,
+    bricklink_url VARCHAR(500),
+    approximate_value NUMERIC(10, 2),
+    value_last_updated DATE,
+    image_filename VARCHAR(255),
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_series ON lego_sets (series);
+CREATE INDEX IF NOT EXISTS idx_owned ON lego_sets (owned);
+CREATE INDEX IF NOT EXISTS idx_release_year ON lego_sets (release_year);
+
+-- Equivalent of MySQL's ON UPDATE CURRENT_TIMESTAMP: bump updated_at unless
+-- the UPDATE sets it explicitly
+CREATE OR REPLACE FUNCTION lego_sets_set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.updated_at IS NOT DISTINCT FROM OLD.updated_at THEN
+        NEW.updated_at = CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER lego_sets_updated_at
+    BEFORE UPDATE ON lego_sets
+    FOR EACH ROW EXECUTE FUNCTION lego_sets_set_updated_at();
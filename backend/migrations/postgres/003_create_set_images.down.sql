@@ -0,0 +1,2 @@
+-- Drop set_images table. Primary images stay in lego_sets.image_filename.
+DROP TABLE IF EXISTS set_images;
@@ -0,0 +1,20 @@
+-- Create set_images table for the photos of each set
+-- lego_sets.image_filename keeps the filename of the primary image
+CREATE TABLE IF NOT EXISTS set_images (
+    id CHAR(36) PRIMARY KEY,
+    set_id CHAR(36) NOT NULL REFERENCES lego_sets (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    caption VARCHAR(500),
+    kind VARCHAR(50),
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_set_images_set_id ON set_images (set_id, sort_order);
+
+-- Every existing set image becomes its set's primary image
+INSERT INTO set_images (id, set_id, filename, sort_order, is_primary)
+SELECT gen_random_uuid()::text, id, image_filename, 0, TRUE
+FROM lego_sets
+WHERE image_filename IS NOT NULL AND image_filename != '';
@@ -0,0 +1,27 @@
+-- Create lego_sets table
+-- NOCASE collations match MySQL's case-insensitive utf8mb4_unicode_ci and
+-- timestamps default to millisecond precision so created_at ordering is stable
+CREATE TABLE IF NOT EXISTS lego_sets (
+    id CHAR(36) PRIMARY KEY,
+    set_number VARCHAR(50) NOT NULL COLLATE NOCASE UNIQUE,
+    alternate_set_number VARCHAR(50),
+    title VARCHAR(255) NOT NULL COLLATE NOCASE,
+    owned BOOLEAN DEFAULT FALSE,
+    quantity_owned INTEGER DEFAULT 0,
+    release_year INTEGER,
+    description TEXT,
+    series VARCHAR(255) COLLATE NOCASE,
+    num_parts INTEGER DEFAULT 0,
+    num_minifigs INTEGER DEFAULT 0,
+    bricklink_url VARCHAR(500),
+    approximate_value DECIMAL(10, 2),
+    value_last_updated DATE,
+    image_filename VARCHAR(255),
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    updated_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_series ON lego_sets (series);
+CREATE INDEX IF NOT EXISTS idx_owned ON lego_sets (owned);
+CREATE INDEX IF NOT EXISTS idx_release_year ON lego_sets (release_year);
@@ -0,0 +1,3 @@
+-- Add condition_description and rebrickable_url fields to lego_sets table
+ALTER TABLE lego_sets ADD COLUMN rebrickable_url VARCHAR(500);
+ALTER TABLE lego_sets ADD COLUMN condition_description TEXT;
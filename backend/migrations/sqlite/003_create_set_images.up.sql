@@ -0,0 +1,25 @@
+-- Create set_images table for the photos of each set
+-- lego_sets.image_filename keeps the filename of the primary image
+CREATE TABLE IF NOT EXISTS set_images (
+    id CHAR(36) PRIMARY KEY,
+    set_id CHAR(36) NOT NULL REFERENCES lego_sets (id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    caption VARCHAR(500),
+    kind VARCHAR(50),
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_set_images_set_id ON set_images (set_id, sort_order);
+
+-- Every existing set image becomes its set's primary image. SQLite has no
+-- UUID function, so build a version 4 UUID from random bytes.
+INSERT INTO set_images (id, set_id, filename, sort_order, is_primary)
+SELECT lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' ||
+       substr(lower(hex(randomblob(2))), 2) || '-' ||
+       substr('89ab', 1 + (abs(random()) % 4), 1) || substr(lower(hex(randomblob(2))), 2) || '-' ||
+       lower(hex(randomblob(6))),
+       id, image_filename, 0, TRUE
+FROM lego_sets
+WHERE image_filename IS NOT NULL AND image_filename != '';
@@ -0,0 +1,451 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+// seedBackupSets creates sets with stored images, plus one set whose image
+// file is missing. It returns the image data by filename and the image
+// filenames by set number.
+func seedBackupSets(t *testing.T, store db.LegoSetStore, uploadDir string) (map[string][]byte, map[string]string) {
+	t.Helper()
+
+	sets := []*models.LegoSet{
+		newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019),
+		newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017),
+		newTestLegoSet("21330", "Home Alone", "Ideas", true, 2, 3955, 6, 249.99, 2021),
+	}
+	data := [][]byte{testJPEG(t, 40, 30), testPNG(t, 40, 30), nil}
+	exts := []string{".jpg", ".png", ".jpg"}
+
+	images := map[string][]byte{}
+	names := map[string]string{}
+	for i, set := range sets {
+		if err := store.Create(set); err != nil {
+			t.Fatalf("Failed to seed set %s: %v", set.SetNumber, err)
+		}
+
+		name := set.ID + "_" + set.SetNumber + exts[i]
+		if data[i] != nil {
+			if err := os.WriteFile(filepath.Join(uploadDir, name), data[i], 0644); err != nil {
+				t.Fatalf("Failed to write image: %v", err)
+			}
+			images[name] = data[i]
+		}
+		if err := store.Update(set.ID, map[string]interface{}{"image_filename": name}); err != nil {
+			t.Fatalf("Failed to set image for %s: %v", set.SetNumber, err)
+		}
+		names[set.SetNumber] = name
+	}
+
+	return images, names
+}
+
+// createTestBackup writes a backup of every set in store
+func createTestBackup(t *testing.T, store db.LegoSetStore, uploadDir string) (*models.BackupManifest, []byte) {
+	t.Helper()
+
+	sets, err := store.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		t.Fatalf("Failed to get sets: %v", err)
+	}
+
+	images, err := store.ListAllImages()
+	if err != nil {
+		t.Fatalf("Failed to get images: %v", err)
+	}
+
+	backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+
+	var buf bytes.Buffer
+	manifest, err := backupService.CreateBackup(sets, images, &buf)
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	return manifest, buf.Bytes()
+}
+
+func TestBackupService_RoundTrip(t *testing.T) {
+	source := db.NewMemoryLegoSetRepository()
+	sourceDir := t.TempDir()
+	images, names := seedBackupSets(t, source, sourceDir)
+
+	manifest, backup := createTestBackup(t, source, sourceDir)
+	if len(manifest.Images) != 2 {
+		t.Errorf("Expected 2 images in the manifest, got %+v", manifest.Images)
+	}
+	if len(manifest.MissingImages) != 1 || manifest.MissingImages[0].SetNumber != "21330" {
+		t.Errorf("Expected the 21330 image to be missing, got %+v", manifest.MissingImages)
+	}
+
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		uploadDir := t.TempDir()
+		backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+
+		result, err := backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Imported != 3 || result.ImagesRestored != 2 {
+			t.Fatalf("Expected 3 sets and 2 images restored, got %+v, %+v", result, result.Sets)
+		}
+		if len(result.DanglingImages) != 1 || result.DanglingImages[0].Filename != names["21330"] {
+			t.Errorf("Expected %s to dangle, got %+v", names["21330"], result.DanglingImages)
+		}
+
+		for name, want := range images {
+			got, err := os.ReadFile(filepath.Join(uploadDir, name))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("Expected %s to be restored, got %q, %v", name, got, err)
+			}
+		}
+
+		set, err := store.GetBySetNumber("75192")
+		if err != nil || set == nil || stringValue(set.ImageFilename) != names["75192"] {
+			t.Fatalf("Expected 75192 restored with its image, got %+v, %v", set, err)
+		}
+
+		// Restoring again changes nothing
+		result, err = backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Skipped != 3 || result.ImagesUnchanged != 2 || result.ImagesRestored != 0 {
+			t.Errorf("Expected everything unchanged, got %+v, %+v", result, result.Sets)
+		}
+	})
+}
+
+func TestBackupService_RoundTrip_SetImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, source db.LegoSetStore) {
+		sourceDir := t.TempDir()
+		set := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+		if err := source.Create(set); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		front := set.ID + "_75192.png"
+		back := set.ID + "_75192_0a1b2c3d.jpg"
+		writeTestPNG(t, sourceDir, front)
+		if err := os.WriteFile(filepath.Join(sourceDir, back), testJPEG(t, 40, 30), 0644); err != nil {
+			t.Fatalf("Failed to write image: %v", err)
+		}
+		if err := source.Update(set.ID, map[string]interface{}{"image_filename": front}); err != nil {
+			t.Fatalf("Failed to set image: %v", err)
+		}
+		backImage := &models.SetImage{SetID: set.ID, Filename: back, Caption: stringPtr("Box back"), Kind: stringPtr("box_back")}
+		if err := source.AddImage(backImage); err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
+		images := checkImages(t, source, set.ID, front+"*,"+back, front)
+		if err := source.ReorderImages(set.ID, []string{backImage.ID, images[0].ID}); err != nil {
+			t.Fatalf("Failed to reorder images: %v", err)
+		}
+
+		manifest, backup := createTestBackup(t, source, sourceDir)
+		if len(manifest.Images) != 2 || len(manifest.Catalog.Images) != 2 {
+			t.Fatalf("Expected both images in the backup, got %+v and %+v", manifest.Images, manifest.Catalog.Images)
+		}
+
+		store := db.NewMemoryLegoSetRepository()
+		backupService := services.NewBackupService(services.NewImageService(t.TempDir()), services.NewImportService(store, services.NewCSVService()))
+
+		result, err := backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Imported != 1 || result.ImagesRestored != 2 {
+			t.Fatalf("Expected 1 set and 2 images restored, got %+v, %+v", result, result.Sets)
+		}
+		restored := checkImages(t, store, set.ID, back+","+front+"*", front)
+		if stringValue(restored[0].Caption) != "Box back" || stringValue(restored[0].Kind) != "box_back" {
+			t.Errorf("Expected the caption and kind to be restored, got %+v", restored[0])
+		}
+
+		// Restoring again changes nothing
+		result, err = backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Skipped != 1 || result.ImagesUnchanged != 2 {
+			t.Errorf("Expected everything unchanged, got %+v, %+v", result, result.Sets)
+		}
+
+		// A lost image comes back with an overwrite
+		if err := store.DeleteImage(set.ID, restored[0].ID); err != nil {
+			t.Fatalf("Failed to delete image: %v", err)
+		}
+		result, err = backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Updated != 1 || result.Sets.Rows[0].Changes[0].Field != "images" {
+			t.Errorf("Expected the set's images to be updated, got %+v", result.Sets.Rows)
+		}
+		checkImages(t, store, set.ID, back+","+front+"*", front)
+	})
+}
+
+func TestBackupService_RestoreBackup_KeepsDifferentImages(t *testing.T) {
+	source := db.NewMemoryLegoSetRepository()
+	sourceDir := t.TempDir()
+	images, names := seedBackupSets(t, source, sourceDir)
+	_, backup := createTestBackup(t, source, sourceDir)
+
+	uploadDir := t.TempDir()
+	local := []byte("a newer photo")
+	if err := os.WriteFile(filepath.Join(uploadDir, names["10273"]), local, 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	store := db.NewMemoryLegoSetRepository()
+	backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+
+	result, err := backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if result.ImagesKept != 1 || result.ImagesRestored != 1 {
+		t.Errorf("Expected 1 image kept and 1 restored, got %+v", result)
+	}
+	if got, _ := os.ReadFile(filepath.Join(uploadDir, names["10273"])); !bytes.Equal(got, local) {
+		t.Errorf("Expected the local image to be kept, got %q", got)
+	}
+
+	result, err = backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+	if err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	if result.ImagesRestored != 1 || result.ImagesUnchanged != 1 {
+		t.Errorf("Expected 1 image restored and 1 unchanged, got %+v", result)
+	}
+	if got, _ := os.ReadFile(filepath.Join(uploadDir, names["10273"])); !bytes.Equal(got, images[names["10273"]]) {
+		t.Errorf("Expected the backed up image to replace the local one, got %q", got)
+	}
+}
+
+// newTestBackup builds a backup bundle of sets and image files by hand,
+// with a manifest that matches the files
+func newTestBackup(t *testing.T, sets []*models.LegoSet, images map[string][]byte) []byte {
+	t.Helper()
+
+	manifest := &models.BackupManifest{
+		FormatVersion: models.BackupFormatVersion,
+		Catalog:       services.NewJSONService().NewCatalog(sets, nil),
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, data := range images {
+		sum := sha256.Sum256(data)
+		manifest.Images = append(manifest.Images, models.BackupImage{Filename: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+		w, err := archive.Create("images/" + name)
+		if err != nil {
+			t.Fatalf("Failed to write backup: %v", err)
+		}
+		w.Write(data)
+	}
+	w, err := archive.Create("manifest.json")
+	if err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+	json.NewEncoder(w).Encode(manifest)
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to write backup: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupService_RestoreBackup_RejectsBadImages(t *testing.T) {
+	house := newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019)
+	house.ID = "6f1c1b5e-8d4a-4f0e-9a57-3c9b6f7d2e10"
+	falcon := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+	falcon.ID = "0b7d2c43-2f1e-4a55-9d3c-6a8e1f4b7c21"
+	alone := newTestLegoSet("21330", "Home Alone", "Ideas", true, 2, 3955, 6, 249.99, 2021)
+	alone.ID = "c3a9e8f2-5b6d-4e71-8f0a-2d4c6b8e9a13"
+
+	houseImage := house.ID + "_10273.jpg"
+	falconImage := falcon.ID + "_75192.png"
+	aloneImage := alone.ID + "_21330.png"
+	house.ImageFilename = &houseImage
+	falcon.ImageFilename = &falconImage
+	alone.ImageFilename = &aloneImage
+
+	// A set can't take over another set's image either
+	bootleg := newTestLegoSet("10276", "Colosseum", "Icons", false, 0, 9036, 0, 549.99, 2020)
+	bootleg.ID = "9e2f4a6c-8b1d-4c3e-a5f7-0d2b4e6a8c95"
+	bootleg.ImageFilename = &houseImage
+
+	backup := newTestBackup(t, []*models.LegoSet{house, falcon, alone, bootleg}, map[string][]byte{
+		houseImage:  testPNG(t, 40, 30),
+		falconImage: []byte("not an image"),
+		aloneImage:  testPNG(t, 40, 30),
+	})
+
+	for _, dryRun := range []bool{true, false} {
+		store := db.NewMemoryLegoSetRepository()
+		uploadDir := t.TempDir()
+		backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+
+		result, err := backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.ImagesRestored != 1 || len(result.Errors) != 2 {
+			t.Fatalf("Expected 1 image restored and 2 errors (dry run %v), got %+v", dryRun, result)
+		}
+		errs := strings.Join(result.Errors, "\n")
+		if !strings.Contains(errs, houseImage) || !strings.Contains(errs, falconImage) {
+			t.Errorf("Expected errors for %s and %s, got %v", houseImage, falconImage, result.Errors)
+		}
+		if result.Sets.Imported != 4 || result.Sets.Warnings != 1 {
+			t.Errorf("Expected 4 sets imported with a warning for the shared image, got %+v", result.Sets)
+		}
+
+		if !dryRun {
+			if got, _ := store.GetByID(bootleg.ID); got == nil || got.ImageFilename != nil {
+				t.Errorf("Expected 10276 restored without an image, got %+v", got)
+			}
+		}
+		for name, want := range map[string]bool{houseImage: false, falconImage: false, aloneImage: !dryRun} {
+			if _, err := os.Stat(filepath.Join(uploadDir, name)); (err == nil) != want {
+				t.Errorf("Expected %s written to be %v (dry run %v), got %v", name, want, dryRun, err)
+			}
+		}
+	}
+}
+
+func TestBackupService_RestoreBackup_Invalid(t *testing.T) {
+	set := newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019)
+	set.ID = "6f1c1b5e-8d4a-4f0e-9a57-3c9b6f7d2e10"
+	image := "haunted.jpg"
+	set.ImageFilename = &image
+
+	manifest := func(images ...models.BackupImage) *models.BackupManifest {
+		return &models.BackupManifest{
+			FormatVersion: models.BackupFormatVersion,
+			Catalog:       services.NewJSONService().NewCatalog([]*models.LegoSet{set}, nil),
+			Images:        images,
+		}
+	}
+
+	tests := map[string]struct {
+		manifest *models.BackupManifest
+		files    map[string]string
+	}{
+		"missing manifest": {
+			files: map[string]string{"images/haunted.jpg": "image"},
+		},
+		"checksum mismatch": {
+			manifest: manifest(models.BackupImage{Filename: "haunted.jpg", Size: 5, SHA256: "0000"}),
+			files:    map[string]string{"images/haunted.jpg": "image"},
+		},
+		"missing image": {
+			manifest: manifest(models.BackupImage{Filename: "haunted.jpg", Size: 5, SHA256: "0000"}),
+		},
+		"path traversal": {
+			manifest: manifest(models.BackupImage{Filename: "../haunted.jpg", Size: 5, SHA256: "0000"}),
+			files:    map[string]string{"images/../haunted.jpg": "image"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			archive := zip.NewWriter(&buf)
+			for name, data := range tc.files {
+				w, _ := archive.Create(name)
+				w.Write([]byte(data))
+			}
+			if tc.manifest != nil {
+				w, _ := archive.Create("manifest.json")
+				json.NewEncoder(w).Encode(tc.manifest)
+			}
+			archive.Close()
+
+			store := db.NewMemoryLegoSetRepository()
+			uploadDir := t.TempDir()
+			backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+
+			_, err := backupService.RestoreBackup(bytes.NewReader(buf.Bytes()), int64(buf.Len()), services.ImportOptions{})
+			var fileErr *services.ImportFileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("Expected ImportFileError, got %v", err)
+			}
+
+			if got, _ := store.GetBySetNumber("10273"); got != nil {
+				t.Error("Expected no sets to be restored")
+			}
+			if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+				t.Errorf("Expected no images to be written, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestBackupService_RestoreBackup_SkipsImagesOfFailedSets(t *testing.T) {
+	house := newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019)
+	house.ID = "6f1c1b5e-8d4a-4f0e-9a57-3c9b6f7d2e10"
+	falcon := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+	falcon.ID = "0b7d2c43-2f1e-4a55-9d3c-6a8e1f4b7c21"
+	copycat := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+	copycat.ID = "9e2f4a6c-8b1d-4c3e-a5f7-0d2b4e6a8c95"
+	alone := newTestLegoSet("21330", "Home Alone", "Ideas", true, 2, 3955, 6, 249.99, 2021)
+	alone.ID = "c3a9e8f2-5b6d-4e71-8f0a-2d4c6b8e9a13"
+
+	files := map[string][]byte{}
+	for _, set := range []*models.LegoSet{house, falcon, copycat, alone} {
+		name := set.ID + "_" + set.SetNumber + ".png"
+		set.ImageFilename = &name
+		files[name] = testPNG(t, 40, 30)
+	}
+	backup := newTestBackup(t, []*models.LegoSet{house, falcon, copycat, alone}, files)
+
+	for _, dryRun := range []bool{true, false} {
+		store := db.NewMemoryLegoSetRepository()
+		uploadDir := t.TempDir()
+
+		// 10273 belongs to another set here, so its row fails, while 21330
+		// is already in the catalog and is skipped
+		if err := store.Create(newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019)); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+		existing := *alone
+		existing.ImageFilename = nil
+		if err := store.Restore(&existing); err != nil {
+			t.Fatalf("Failed to restore set: %v", err)
+		}
+
+		backupService := services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService()))
+		result, err := backupService.RestoreBackup(bytes.NewReader(backup), int64(len(backup)), services.ImportOptions{DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("Failed to restore backup: %v", err)
+		}
+		if result.Sets.Imported != 1 || result.Sets.Skipped != 2 || result.Sets.Failed != 1 {
+			t.Errorf("Expected 1 set imported, 2 skipped and 1 failed (dry run %v), got %+v", dryRun, result.Sets)
+		}
+		if result.ImagesRestored != 2 {
+			t.Errorf("Expected 2 images restored (dry run %v), got %+v", dryRun, result)
+		}
+
+		for _, set := range []*models.LegoSet{house, falcon, copycat, alone} {
+			want := !dryRun && (set == falcon || set == alone)
+			if _, err := os.Stat(filepath.Join(uploadDir, *set.ImageFilename)); (err == nil) != want {
+				t.Errorf("Expected %s written to be %v (dry run %v), got %v", *set.ImageFilename, want, dryRun, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+func TestBrickLinkService_ExportToXML(t *testing.T) {
+	sealed := "New, sealed"
+	built := "Built once, complete"
+	variant := "https://www.bricklink.com/v2/catalog/catalogitem.page?S=6020-2"
+
+	colosseum := newTestLegoSet("10276", "Colosseum", "Icons", true, 2, 9036, 0, 549.99, 2020)
+	colosseum.ConditionDescription = &sealed
+	falcon := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+	falcon.ConditionDescription = &built
+	flyer := newTestLegoSet("6020", "Magic Flyer", "Castle", false, 0, 67, 1, 40, 1996)
+	flyer.BricklinkURL = &variant
+	sets := []*models.LegoSet{colosseum, falcon, flyer}
+
+	brickLinkService := services.NewBrickLinkService()
+
+	var buf bytes.Buffer
+	if err := brickLinkService.ExportToXML(sets, services.BrickLinkInventory, &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	inventory := buf.String()
+
+	for _, want := range []string{
+		"<ITEMTYPE>S</ITEMTYPE>",
+		"<ITEMID>10276-1</ITEMID>",
+		"<MINQTY>2</MINQTY>",
+		"<CONDITION>N</CONDITION>",
+		"<ITEMID>75192-1</ITEMID>",
+		"<CONDITION>U</CONDITION>",
+	} {
+		if !strings.Contains(inventory, want) {
+			t.Errorf("Expected inventory to contain %s, got:\n%s", want, inventory)
+		}
+	}
+	if strings.Contains(inventory, "6020") {
+		t.Error("Expected sets not owned to be left out of the inventory")
+	}
+
+	buf.Reset()
+	if err := brickLinkService.ExportToXML(sets, services.BrickLinkWanted, &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	wanted := buf.String()
+	if !strings.Contains(wanted, "<ITEMID>6020-2</ITEMID>") || !strings.Contains(wanted, "<CONDITION>X</CONDITION>") {
+		t.Errorf("Expected 6020-2 with any condition on the wanted list, got:\n%s", wanted)
+	}
+	if strings.Contains(wanted, "10276") {
+		t.Error("Expected owned sets to be left out of the wanted list")
+	}
+}
+
+func TestImportService_ImportBrickLink(t *testing.T) {
+	inventory := `<?xml version="1.0" encoding="UTF-8"?>
+<INVENTORY>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>10276-1</ITEMID><MINQTY>1</MINQTY><CONDITION>N</CONDITION></ITEM>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>10276-1</ITEMID><MINQTY>1</MINQTY><CONDITION>N</CONDITION></ITEM>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>75192-1</ITEMID><QTY>1</QTY><CONDITION>U</CONDITION></ITEM>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>99999-1</ITEMID><MINQTY>1</MINQTY></ITEM>
+  <ITEM><ITEMTYPE>P</ITEMTYPE><ITEMID>3001</ITEMID><MINQTY>10</MINQTY></ITEM>
+</INVENTORY>`
+	catalog := loadTestRebrickableCatalog(t)
+
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		notes := "Display model"
+		falcon := newTestLegoSet("75192", "UCS Falcon", "Star Wars", false, 0, 7541, 8, 849.99, 2017)
+		falcon.Notes = &notes
+		if err := store.Create(falcon); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		importService := services.NewImportService(store, services.NewCSVService())
+		result, err := importService.ImportBrickLink(strings.NewReader(inventory), services.BrickLinkInventory, catalog, services.ImportOptions{Strategy: models.ImportStrategyMerge})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.Imported != 2 || result.Updated != 1 || result.Failed != 1 {
+			t.Fatalf("Expected 2 created, 1 updated and 1 failed, got %+v", result)
+		}
+
+		colosseum, _ := store.GetBySetNumber("10276")
+		if colosseum == nil || colosseum.Title != "Colosseum" || colosseum.QuantityOwned != 2 || !colosseum.Owned ||
+			stringValue(colosseum.ConditionDescription) != "New" {
+			t.Errorf("Expected 10276 created with quantity 2 and condition New, got %+v", colosseum)
+		}
+		if stringValue(colosseum.BricklinkURL) != "https://www.bricklink.com/v2/catalog/catalogitem.page?S=10276-1" {
+			t.Errorf("Expected BrickLink URL, got %q", stringValue(colosseum.BricklinkURL))
+		}
+
+		updated, _ := store.GetBySetNumber("75192")
+		if !updated.Owned || updated.QuantityOwned != 1 || stringValue(updated.ConditionDescription) != "Used" {
+			t.Errorf("Expected 75192 to become owned and used, got %+v", updated)
+		}
+		if updated.Title != "Millennium Falcon" || stringValue(updated.Notes) != notes {
+			t.Errorf("Expected the title from the dump and notes kept, got %+v", updated)
+		}
+
+		// Without a dump or a title, the set number stands in
+		unknown, _ := store.GetBySetNumber("99999")
+		if unknown == nil || unknown.Title != "99999" {
+			t.Errorf("Expected 99999 titled with its number, got %+v", unknown)
+		}
+	})
+}
+
+func TestImportService_ImportBrickLink_Wanted(t *testing.T) {
+	wanted := `<INVENTORY>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>10276-1</ITEMID><MINQTY>1</MINQTY><CONDITION>X</CONDITION></ITEM>
+  <ITEM><ITEMTYPE>S</ITEMTYPE><ITEMID>21330-1</ITEMID><MINQTY>1</MINQTY></ITEM>
+</INVENTORY>`
+
+	store := db.NewMemoryLegoSetRepository()
+	owned := newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020)
+	if err := store.Create(owned); err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+
+	importService := services.NewImportService(store, services.NewCSVService())
+	result, err := importService.ImportBrickLink(strings.NewReader(wanted), services.BrickLinkWanted, nil, services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if result.Imported != 1 || result.Strategy != models.ImportStrategyOverwrite {
+		t.Fatalf("Expected 1 created, got %+v", result)
+	}
+
+	if got, _ := store.GetBySetNumber("10276"); !got.Owned || got.Title != "Colosseum" {
+		t.Errorf("Expected a wanted list to leave an owned set alone, got %+v", got)
+	}
+	if got, _ := store.GetBySetNumber("21330"); got == nil || got.Owned || got.QuantityOwned != 0 {
+		t.Errorf("Expected 21330 created as not owned, got %+v", got)
+	}
+
+	if _, err := importService.ImportBrickLink(strings.NewReader("<INVENTORY><ITEM>"), services.BrickLinkWanted, nil, services.ImportOptions{}); err == nil {
+		t.Error("Expected error for malformed XML")
+	}
+}
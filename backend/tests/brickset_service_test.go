@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+const bricksetExport = `SetID,Number,Variant,Theme,Subtheme,Year,Name,Minifigs,Pieces,USPrice,ImageURL,Owned,Wanted,QtyOwned
+29839,10276,1,Icons,Buildings,2020,Colosseum,,9036,549.99,https://images.brickset.com/sets/images/10276-1.jpg,1,0,1
+26725,75192,1,Star Wars,Ultimate Collector Series,2017,Millennium Falcon,8,7541,849.99,,1,0,2
+1234,6020,2,Castle,,1996,Magic Flyer,1,67,,,0,1,0
+5678,21330,1,Ideas,,MMXXI,Home Alone,6,3955,249.99,,1,0,1
+`
+
+func TestBricksetService_ParseCSV(t *testing.T) {
+	header, rows, err := services.NewBricksetService().ParseCSV(strings.NewReader(bricksetExport))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if want := []string{"SetID", "USPrice", "ImageURL"}; !reflect.DeepEqual(header.Unmapped, want) {
+		t.Errorf("Expected unmapped columns %v, got %v", want, header.Unmapped)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 rows, got %d", len(rows))
+	}
+
+	falcon := rows[1].Set
+	if falcon.SetNumber != "75192" || falcon.Title != "Millennium Falcon" || falcon.NumParts != 7541 || falcon.NumMinifigs != 8 {
+		t.Errorf("Unexpected set: %+v", falcon)
+	}
+	if stringValue(falcon.Series) != "Star Wars / Ultimate Collector Series" {
+		t.Errorf("Expected theme and subtheme as the series, got %q", stringValue(falcon.Series))
+	}
+	if !falcon.Owned || falcon.QuantityOwned != 2 {
+		t.Errorf("Expected 2 owned, got %v %d", falcon.Owned, falcon.QuantityOwned)
+	}
+
+	flyer := rows[2].Set
+	if flyer.SetNumber != "6020-2" || flyer.Owned || stringValue(flyer.Series) != "Castle" {
+		t.Errorf("Expected wanted 6020-2 not owned, got %+v", flyer)
+	}
+
+	if len(rows[3].Warnings) != 1 || rows[3].Warnings[0].Field != "release_year" {
+		t.Errorf("Expected a release year warning, got %+v", rows[3].Warnings)
+	}
+
+	if _, _, err := services.NewBricksetService().ParseCSV(strings.NewReader("Set Number,Title\n10276,Colosseum\n")); err == nil {
+		t.Error("Expected error for a file without Number and Name")
+	}
+}
+
+func TestImportService_ImportBrickset(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		notes := "Keep the box"
+		colosseum := newTestLegoSet("10276", "Colosseum", "Icons", false, 0, 9036, 0, 549.99, 2020)
+		colosseum.Notes = &notes
+		if err := store.Create(colosseum); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		preview, err := importService.ImportBrickset(strings.NewReader(bricksetExport), services.ImportOptions{DryRun: true})
+		if err != nil {
+			t.Fatalf("Failed to preview: %v", err)
+		}
+		if len(preview.UnmappedColumns) != 3 || preview.Imported != 3 || preview.Skipped != 1 {
+			t.Errorf("Expected 3 unmapped columns, 3 new sets and 1 skipped, got %+v", preview)
+		}
+		if got, _ := store.GetBySetNumber("75192"); got != nil {
+			t.Error("Expected a dry run to write nothing")
+		}
+
+		result, err := importService.ImportBrickset(strings.NewReader(bricksetExport), services.ImportOptions{Strategy: models.ImportStrategyMerge})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.Imported != 3 || result.Updated != 1 {
+			t.Fatalf("Expected 3 created and 1 updated, got %+v", result)
+		}
+
+		got, _ := store.GetBySetNumber("10276")
+		if !got.Owned || got.QuantityOwned != 1 || stringValue(got.Series) != "Icons / Buildings" || stringValue(got.Notes) != notes {
+			t.Errorf("Expected 10276 merged from Brickset, got %+v", got)
+		}
+		if home, _ := store.GetBySetNumber("21330"); home == nil || home.ReleaseYear != nil {
+			t.Errorf("Expected 21330 created without its unparseable year, got %+v", home)
+		}
+	})
+}
+
+func TestImportService_ImportBrickset_WantedOnly(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		// A wishlist export has Wanted but neither Owned nor QtyOwned
+		data := "Number,Variant,Name,Wanted\n75192,1,Millennium Falcon,1\n21330,1,Home Alone,0\n10276,1,Colosseum,maybe\n"
+
+		header, rows, err := services.NewBricksetService().ParseCSV(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if len(header.Unmapped) != 0 || !header.Has("owned") {
+			t.Errorf("Expected Wanted to be mapped to owned, got %+v", header)
+		}
+		if !rows[0].Filled["owned"] || rows[1].Filled["owned"] || rows[2].Filled["owned"] {
+			t.Errorf("Expected only the wanted set to fill owned, got %v, %v, %v", rows[0].Filled, rows[1].Filled, rows[2].Filled)
+		}
+		if len(rows[2].Warnings) != 1 || rows[2].Warnings[0].Field != "owned" {
+			t.Errorf("Expected a warning for the unparseable wanted flag, got %+v", rows[2].Warnings)
+		}
+
+		if _, err := importService.ImportBrickset(strings.NewReader(data), services.ImportOptions{Strategy: models.ImportStrategyMerge}); err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if falcon, _ := store.GetBySetNumber("75192"); falcon.Owned || falcon.QuantityOwned != 0 {
+			t.Errorf("Expected the wanted set to be marked not owned, got %v %d", falcon.Owned, falcon.QuantityOwned)
+		}
+		if home, _ := store.GetBySetNumber("21330"); !home.Owned || home.QuantityOwned != 2 {
+			t.Errorf("Expected a set that isn't wanted to stay owned, got %v %d", home.Owned, home.QuantityOwned)
+		}
+		if colosseum, _ := store.GetBySetNumber("10276"); colosseum == nil || colosseum.Owned {
+			t.Errorf("Expected 10276 created as not owned, got %+v", colosseum)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/api/handlers"
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+type testZipFile struct {
+	name string
+	data []byte
+}
+
+// newTestZip builds a zip archive with files in the given order
+func newTestZip(t *testing.T, files ...testZipFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		entry, err := archive.Create(file.name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", file.name, err)
+		}
+		entry.Write(file.data)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBulkImageService_ImportZip(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	uploadDir := t.TempDir()
+	service := services.NewBulkImageService(store, services.NewImageService(uploadDir))
+
+	falcon, _ := store.GetBySetNumber("75192")
+	writeTestPNG(t, uploadDir, "old_75192.png")
+	if err := store.Update(falcon.ID, map[string]interface{}{"image_filename": "old_75192.png"}); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+	// Only words that look like set numbers are tried
+	if err := store.Create(newTestLegoSet("box", "Storage Box", "Other", false, 0, 0, 0, 0, 2020)); err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+
+	image := testPNG(t, 40, 30)
+	archive := newTestZip(t,
+		testZipFile{"shelf/10273.jpg", image},
+		testZipFile{"box_75192-1.png", image},
+		testZipFile{"21330 front.gif", image},
+		testZipFile{"21330_back.gif", image},
+		testZipFile{"10273.txt", []byte("notes")},
+		testZipFile{"99999.jpg", image},
+		testZipFile{"shelf/", nil},
+		testZipFile{"__MACOSX/._10273.jpg", image},
+		testZipFile{".DS_Store", []byte{0}},
+	)
+
+	result, err := service.ImportZip(bytes.NewReader(archive), int64(len(archive)), services.BulkImageOptions{})
+	if err != nil {
+		t.Fatalf("Failed to import zip: %v", err)
+	}
+
+	matched := map[string]models.BulkImageMatch{}
+	for _, match := range result.Matched {
+		matched[match.File] = match
+	}
+	if len(result.Matched) != 4 || matched["shelf/10273.jpg"].SetNumber != "10273" ||
+		matched["box_75192-1.png"].SetNumber != "75192" || matched["21330 front.gif"].SetNumber != "21330" ||
+		matched["21330_back.gif"].SetNumber != "21330" {
+		t.Errorf("Expected 10273, 75192 and both 21330 images to match, got %+v", result.Matched)
+	}
+	if matched["21330 front.gif"].Added || !matched["21330_back.gif"].Added {
+		t.Errorf("Expected the second 21330 image to be added, got %+v", result.Matched)
+	}
+	// 75192 already has a primary image, which is kept
+	if falconMatch := matched["box_75192-1.png"]; !falconMatch.Added || falconMatch.Replaced != "" {
+		t.Errorf("Expected the 75192 image to be added alongside its primary image, got %+v", falconMatch)
+	}
+	if len(result.Unmatched) != 1 || result.Unmatched[0] != "99999.jpg" {
+		t.Errorf("Expected 99999.jpg to be unmatched, got %v", result.Unmatched)
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].File != "10273.txt" ||
+		!strings.Contains(result.Rejected[0].Reason, "unsupported image type") {
+		t.Errorf("Expected the text file to be rejected, got %+v", result.Rejected)
+	}
+
+	for _, match := range result.Matched {
+		set, _ := store.GetByID(match.SetID)
+		if !match.Added && stringValue(set.ImageFilename) != match.ImageFilename {
+			t.Errorf("Expected %s to use image %s, got %v", set.SetNumber, match.ImageFilename, set.ImageFilename)
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, match.ImageFilename)); err != nil {
+			t.Errorf("Expected %s to be stored: %v", match.ImageFilename, err)
+		}
+	}
+	alone := matched["21330 front.gif"]
+	checkImages(t, store, alone.SetID, alone.ImageFilename+"*,"+matched["21330_back.gif"].ImageFilename, alone.ImageFilename)
+	checkImages(t, store, falcon.ID, "old_75192.png*,"+matched["box_75192-1.png"].ImageFilename, "old_75192.png")
+	if _, err := os.Stat(filepath.Join(uploadDir, "old_75192.png")); err != nil {
+		t.Errorf("Expected the primary image to be kept: %v", err)
+	}
+}
+
+func TestBulkImageService_ImportZip_Replace(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	uploadDir := t.TempDir()
+	service := services.NewBulkImageService(store, services.NewImageService(uploadDir))
+
+	falcon, _ := store.GetBySetNumber("75192")
+	writeTestPNG(t, uploadDir, "old_75192.png")
+	if err := store.Update(falcon.ID, map[string]interface{}{"image_filename": "old_75192.png"}); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+
+	image := testPNG(t, 40, 30)
+	archive := newTestZip(t,
+		testZipFile{"75192-1_box.png", image},
+		testZipFile{"75192_built.png", image},
+	)
+	result, err := service.ImportZip(bytes.NewReader(archive), int64(len(archive)), services.BulkImageOptions{Replace: true})
+	if err != nil {
+		t.Fatalf("Failed to import zip: %v", err)
+	}
+	if len(result.Matched) != 2 {
+		t.Fatalf("Expected both files to match, got %+v", result)
+	}
+
+	box, built := result.Matched[0], result.Matched[1]
+	if box.Added || box.Replaced != "old_75192.png" || !built.Added || built.Replaced != "" {
+		t.Errorf("Expected the first file to replace the primary image and the second to be added, got %+v", result.Matched)
+	}
+	checkImages(t, store, falcon.ID, box.ImageFilename+"*,"+built.ImageFilename, box.ImageFilename)
+	if _, err := os.Stat(filepath.Join(uploadDir, "old_75192.png")); !os.IsNotExist(err) {
+		t.Error("Expected the replaced image to be deleted")
+	}
+}
+
+func TestBulkImageService_ImportZip_DryRun(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	uploadDir := t.TempDir()
+	service := services.NewBulkImageService(store, services.NewImageService(uploadDir))
+
+	archive := newTestZip(t, testZipFile{"10273.png", testPNG(t, 40, 30)})
+	result, err := service.ImportZip(bytes.NewReader(archive), int64(len(archive)), services.BulkImageOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to import zip: %v", err)
+	}
+	if !result.DryRun || len(result.Matched) != 1 || result.Matched[0].ImageFilename != "" {
+		t.Errorf("Expected a dry run match without a stored image, got %+v", result)
+	}
+
+	set, _ := store.GetBySetNumber("10273")
+	if set.ImageFilename != nil {
+		t.Errorf("Expected no image after a dry run, got %s", *set.ImageFilename)
+	}
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+		t.Errorf("Expected nothing stored, got %d files", len(entries))
+	}
+
+	if _, err := service.ImportZip(strings.NewReader("not a zip"), 9, services.BulkImageOptions{}); err == nil {
+		t.Error("Expected error for an invalid archive")
+	}
+}
+
+func TestImageHandler_BulkUpload(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	handler := handlers.NewImageHandler(services.NewBulkImageService(store, services.NewImageService(t.TempDir())))
+
+	archive := newTestZip(t,
+		testZipFile{"10273.png", testPNG(t, 40, 30)},
+		testZipFile{"40000.png", testPNG(t, 40, 30)},
+	)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("zip", "shelf.zip")
+	part.Write(archive)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/images/bulk", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := serve(handler.BulkUpload, req, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result models.BulkImageResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if len(result.Matched) != 1 || len(result.Unmatched) != 1 || len(result.Rejected) != 0 {
+		t.Errorf("Expected 1 matched and 1 unmatched file, got %+v", result)
+	}
+
+	rec = serve(handler.BulkUpload, httptest.NewRequest("POST", "/api/images/bulk?dryRun=true", bytes.NewReader(archive)), nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a raw body, got %d: %s", rec.Code, rec.Body.String())
+	}
+	result = models.BulkImageResult{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if len(result.Matched) != 1 || !result.Matched[0].Added {
+		t.Errorf("Expected 10273's new image to be added, got %+v", result.Matched)
+	}
+
+	rec = serve(handler.BulkUpload, httptest.NewRequest("POST", "/api/images/bulk?dryRun=true&replace=true", bytes.NewReader(archive)), nil)
+	result = models.BulkImageResult{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if len(result.Matched) != 1 || result.Matched[0].Added || result.Matched[0].Replaced == "" {
+		t.Errorf("Expected 10273's primary image to be replaced, got %+v", result.Matched)
+	}
+
+	rec = serve(handler.BulkUpload, httptest.NewRequest("POST", "/api/images/bulk", strings.NewReader("not a zip")), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid archive, got %d", rec.Code)
+	}
+}
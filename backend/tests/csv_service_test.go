@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"time"
 
 	"lego-catalog/internal/models"
 	"lego-catalog/internal/services"
@@ -108,3 +109,459 @@ func TestCSVService_ImportFromCSV_InvalidFormat(t *testing.T) {
 		t.Error("Expected error for invalid CSV format")
 	}
 }
+
+func TestCSVService_RoundTrip(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	alt := "10276-1"
+	year := 2020
+	desc := "Roman Colosseum"
+	series := "Creator Expert"
+	bricklink := "https://www.bricklink.com/v2/catalog/catalogitem.page?S=10276-1"
+	rebrickable := "https://rebrickable.com/sets/10276-1/colosseum/"
+	value := 549.99
+	valueDate := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	condition := "Sealed, minor shelf wear"
+	image := "abc_10276.jpg"
+	notes := "Awesome set, \"display\" piece"
+
+	original := &models.LegoSet{
+		SetNumber:            "10276",
+		AlternateSetNumber:   &alt,
+		Title:                "Colosseum",
+		Owned:                true,
+		QuantityOwned:        2,
+		ReleaseYear:          &year,
+		Description:          &desc,
+		Series:               &series,
+		NumParts:             9036,
+		NumMinifigs:          0,
+		BricklinkURL:         &bricklink,
+		RebrickableURL:       &rebrickable,
+		ApproximateValue:     &value,
+		ValueLastUpdated:     &valueDate,
+		ConditionDescription: &condition,
+		ImageFilename:        &image,
+		Notes:                &notes,
+	}
+
+	var buf bytes.Buffer
+	if err := csvService.ExportToCSV([]*models.LegoSet{original}, &buf); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+
+	sets, err := csvService.ImportFromCSV(&buf)
+	if err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("Expected 1 set, got %d", len(sets))
+	}
+
+	got := sets[0]
+	if got.SetNumber != original.SetNumber || got.Title != original.Title {
+		t.Errorf("Expected %s %s, got %s %s", original.SetNumber, original.Title, got.SetNumber, got.Title)
+	}
+	if !got.Owned || got.QuantityOwned != 2 || got.NumParts != 9036 {
+		t.Errorf("Unexpected owned/quantity/parts: %v %d %d", got.Owned, got.QuantityOwned, got.NumParts)
+	}
+	if got.ReleaseYear == nil || *got.ReleaseYear != year {
+		t.Errorf("Expected release year %d, got %v", year, got.ReleaseYear)
+	}
+	if got.ApproximateValue == nil || *got.ApproximateValue != value {
+		t.Errorf("Expected value %v, got %v", value, got.ApproximateValue)
+	}
+
+	optional := map[string][2]*string{
+		"alternate set number":  {original.AlternateSetNumber, got.AlternateSetNumber},
+		"description":           {original.Description, got.Description},
+		"series":                {original.Series, got.Series},
+		"bricklink url":         {original.BricklinkURL, got.BricklinkURL},
+		"rebrickable url":       {original.RebrickableURL, got.RebrickableURL},
+		"condition description": {original.ConditionDescription, got.ConditionDescription},
+		"notes":                 {original.Notes, got.Notes},
+	}
+	for name, pair := range optional {
+		if pair[1] == nil || *pair[1] != *pair[0] {
+			t.Errorf("Expected %s %q, got %v", name, *pair[0], pair[1])
+		}
+	}
+	if got.ValueLastUpdated == nil || *got.ValueLastUpdated != "2024-01-15" {
+		t.Errorf("Expected value last updated 2024-01-15, got %v", got.ValueLastUpdated)
+	}
+}
+
+func TestCSVService_ImportFromCSV_ImageFilenameIgnored(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	header, rows, err := csvService.ParseCSV(strings.NewReader("Set Number,Title,Image Filename\n10276,Colosseum,../../etc/passwd\n"), services.CSVImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if header.Has("image_filename") || len(header.Unmapped) != 0 {
+		t.Errorf("Expected the image filename column to be recognized and ignored, got %+v", header)
+	}
+	if len(rows) != 1 || len(rows[0].Warnings) != 0 || rows[0].Filled["image_filename"] {
+		t.Errorf("Expected one row without an image filename, got %+v", rows)
+	}
+
+	_, err = csvService.ImportFromCSVWithOptions(strings.NewReader("Set Number,Title,File\n10276,Colosseum,a.png\n"), services.CSVImportOptions{
+		ColumnMapping: map[string]string{"File": "image_filename"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "can't be imported") {
+		t.Errorf("Expected mapping a column to image_filename to fail, got %v", err)
+	}
+}
+
+func TestCSVService_ImportFromCSV_HeaderMatching(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	// Reordered columns, aliases, different case and an unknown column
+	csvData := `title,Extra Column,SET #,Theme,qty,PIECES
+Colosseum,ignored,10276,Creator Expert,1,9036`
+
+	sets, err := csvService.ImportFromCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("Expected 1 set, got %d", len(sets))
+	}
+
+	set := sets[0]
+	if set.SetNumber != "10276" || set.Title != "Colosseum" {
+		t.Errorf("Expected 10276 Colosseum, got %s %s", set.SetNumber, set.Title)
+	}
+	if set.Series == nil || *set.Series != "Creator Expert" {
+		t.Errorf("Expected series Creator Expert, got %v", set.Series)
+	}
+	if set.QuantityOwned != 1 || set.NumParts != 9036 {
+		t.Errorf("Expected quantity 1 and 9036 parts, got %d and %d", set.QuantityOwned, set.NumParts)
+	}
+	if set.Description != nil || set.ReleaseYear != nil {
+		t.Error("Expected missing optional columns to stay empty")
+	}
+}
+
+func TestCSVService_ImportFromCSV_ColumnMapping(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	csvData := `Item,Label,Value,Notes
+10276,Colosseum,Shelf 3,Gift`
+
+	opts := services.CSVImportOptions{
+		ColumnMapping: map[string]string{
+			"Item":  "set_number",
+			"label": "title",
+			"Value": "condition_description",
+			"Notes": "",
+		},
+	}
+
+	sets, err := csvService.ImportFromCSVWithOptions(strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Failed to import CSV: %v", err)
+	}
+	if len(sets) != 1 {
+		t.Fatalf("Expected 1 set, got %d", len(sets))
+	}
+
+	set := sets[0]
+	if set.SetNumber != "10276" || set.Title != "Colosseum" {
+		t.Errorf("Expected 10276 Colosseum, got %s %s", set.SetNumber, set.Title)
+	}
+	if set.ConditionDescription == nil || *set.ConditionDescription != "Shelf 3" {
+		t.Errorf("Expected mapped condition description, got %v", set.ConditionDescription)
+	}
+	if set.ApproximateValue != nil {
+		t.Errorf("Expected Value column to be remapped, got approximate value %v", *set.ApproximateValue)
+	}
+	if set.Notes != nil {
+		t.Errorf("Expected ignored Notes column, got %q", *set.Notes)
+	}
+}
+
+func TestCSVService_ImportFromCSV_InvalidMapping(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	tests := []struct {
+		name    string
+		csvData string
+		mapping map[string]string
+	}{
+		{"missing title", "Set Number,Series\n10276,Creator Expert", nil},
+		{"duplicate field", "Set Number,Set,Title\n10276,10276,Colosseum", nil},
+		{"unknown field", "Set Number,Title\n10276,Colosseum", map[string]string{"Title": "name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := services.CSVImportOptions{ColumnMapping: tt.mapping}
+			if _, err := csvService.ImportFromCSVWithOptions(strings.NewReader(tt.csvData), opts); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestCSVService_ParseCSV_Warnings(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	csvData := "Set Number,Title,Owned,Quantity Owned,Release Year,Number of Parts,Approximate Value,Value Last Updated\n" +
+		"10276,Colosseum,maybe,-1,20x0,lots,cheap,15/01/2024\n" +
+		"\n" +
+		"75192,\"Millennium\nFalcon\",yes,1,2017,7541,$849.99,2024-01-10\n"
+
+	_, rows, err := csvService.ParseCSV(strings.NewReader(csvData), services.CSVImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	fields := []string{}
+	for _, warning := range rows[0].Warnings {
+		fields = append(fields, warning.Field)
+	}
+	want := "owned,quantity_owned,release_year,num_parts,approximate_value,value_last_updated"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("Expected warnings for %s, got %v", want, rows[0].Warnings)
+	}
+
+	if rows[0].Line != 2 || rows[1].Line != 4 {
+		t.Errorf("Expected lines 2 and 4, got %d and %d", rows[0].Line, rows[1].Line)
+	}
+	if len(rows[1].Warnings) != 0 {
+		t.Errorf("Expected no warnings for second row, got %v", rows[1].Warnings)
+	}
+	if !rows[1].Set.Owned || rows[1].Set.ApproximateValue == nil || *rows[1].Set.ApproximateValue != 849.99 {
+		t.Errorf("Expected owned set worth 849.99, got %+v", rows[1].Set)
+	}
+}
+
+func TestCSVService_ExportToCSV_Dialects(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	value := 549.99
+	updated := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	sets := []*models.LegoSet{{
+		SetNumber:        "10276",
+		Title:            "Colosseum; Rome",
+		Owned:            true,
+		QuantityOwned:    1,
+		ApproximateValue: &value,
+		ValueLastUpdated: &updated,
+	}}
+	fields := []string{"set_number", "title", "approximate_value", "value_last_updated"}
+
+	tests := []struct {
+		name    string
+		dialect services.CSVDialect
+		want    string
+	}{
+		{
+			name: "default",
+			want: "Set Number,Title,Approximate Value,Value Last Updated\n10276,Colosseum; Rome,549.99,2024-03-15\n",
+		},
+		{
+			name:    "excel-eu",
+			dialect: services.CSVDialectExcelEU,
+			want:    "\ufeffSet Number;Title;Approximate Value;Value Last Updated\n10276;\"Colosseum; Rome\";549,99;15.03.2024\n",
+		},
+		{
+			name:    "tab with US dates",
+			dialect: services.CSVDialect{Delimiter: '\t', DateFormat: "MM/DD/YYYY"},
+			want:    "Set Number\tTitle\tApproximate Value\tValue Last Updated\n10276\tColosseum; Rome\t549.99\t03/15/2024\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			opts := services.CSVExportOptions{Fields: fields, Dialect: tt.dialect}
+			if err := csvService.ExportToCSVWithOptions(sets, opts, &buf); err != nil {
+				t.Fatalf("Failed to export CSV: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestCSVService_ImportFromCSV_Dialects(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	tests := []struct {
+		name    string
+		dialect services.CSVDialect
+		csvData string
+	}{
+		{
+			name:    "comma detected",
+			csvData: "Set Number,Title,Approximate Value,Value Last Updated\n10276,\"Colosseum; Rome\",549.99,2024-03-15\n",
+		},
+		{
+			name:    "semicolon detected",
+			csvData: "\ufeffSet Number;Title;Approximate Value;Value Last Updated\n10276;\"Colosseum; Rome\";549,99;15.03.2024\n",
+		},
+		{
+			name:    "tab detected",
+			csvData: "Set Number\tTitle\tApproximate Value\tValue Last Updated\n10276\tColosseum; Rome\t549.99\t2024-03-15\n",
+		},
+		{
+			name:    "pipe detected",
+			csvData: "\"Set Number\"|\"Title, Name\"|Approximate Value|Value Last Updated\n10276|Colosseum; Rome|549,99|2024-03-15\n",
+		},
+		{
+			name:    "excel-eu",
+			dialect: services.CSVDialectExcelEU,
+			csvData: "Set Number;Title;Approximate Value;Value Last Updated\n10276;\"Colosseum; Rome\";549,99;15.03.2024\n",
+		},
+		{
+			name:    "explicit date format",
+			dialect: services.CSVDialect{DateFormat: "MM/DD/YYYY"},
+			csvData: "Set Number,Title,Approximate Value,Value Last Updated\n10276,Colosseum; Rome,$549.99,03/15/2024\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := services.CSVImportOptions{Dialect: tt.dialect}
+			if tt.name == "pipe detected" {
+				opts.ColumnMapping = map[string]string{"Title, Name": "title"}
+			}
+			_, rows, err := csvService.ParseCSV(strings.NewReader(tt.csvData), opts)
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("Expected 1 row, got %d", len(rows))
+			}
+
+			row := rows[0]
+			if len(row.Warnings) != 0 {
+				t.Errorf("Expected no warnings, got %v", row.Warnings)
+			}
+			set := row.Set
+			if set.SetNumber != "10276" || set.Title != "Colosseum; Rome" {
+				t.Errorf("Expected 10276 Colosseum; Rome, got %s %s", set.SetNumber, set.Title)
+			}
+			if set.ApproximateValue == nil || *set.ApproximateValue != 549.99 {
+				t.Errorf("Expected value 549.99, got %v", set.ApproximateValue)
+			}
+			if set.ValueLastUpdated == nil || *set.ValueLastUpdated != "2024-03-15" {
+				t.Errorf("Expected value last updated 2024-03-15, got %v", set.ValueLastUpdated)
+			}
+		})
+	}
+}
+
+func TestCSVService_ImportFromCSV_DialectWarnings(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	tests := []struct {
+		name    string
+		dialect services.CSVDialect
+		value   string
+		date    string
+	}{
+		{"thousands separator", services.CSVDialect{}, "1,234", "2024-03-15"},
+		{"both separators", services.CSVDialect{}, "1.234,56", "2024-03-15"},
+		{"decimal point with comma dialect", services.CSVDialectExcelEU, "549.99", "15.03.2024"},
+		{"decimal comma with point dialect", services.CSVDialect{DecimalSeparator: '.'}, "549,99", "2024-03-15"},
+		{"ISO date with explicit format", services.CSVDialectExcelEU, "549,99", "2024-03-15"},
+		{"US date", services.CSVDialect{}, "549.99", "03/15/2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delimiter := string(tt.dialect.Delimiter)
+			if tt.dialect.Delimiter == 0 {
+				delimiter = ","
+			}
+			csvData := strings.Join([]string{"Set Number", "Title", "Approximate Value", "Value Last Updated"}, delimiter) + "\n" +
+				strings.Join([]string{"10276", "Colosseum", `"` + tt.value + `"`, tt.date}, delimiter) + "\n"
+
+			_, rows, err := csvService.ParseCSV(strings.NewReader(csvData), services.CSVImportOptions{Dialect: tt.dialect})
+			if err != nil {
+				t.Fatalf("Failed to parse CSV: %v", err)
+			}
+			if len(rows) != 1 || len(rows[0].Warnings) != 1 {
+				t.Fatalf("Expected 1 row with 1 warning, got %+v", rows)
+			}
+		})
+	}
+}
+
+func TestCSVService_RoundTrip_ExcelEU(t *testing.T) {
+	csvService := services.NewCSVService()
+
+	value := 1249.5
+	updated := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	notes := "Boxed; sealed"
+	sets := []*models.LegoSet{{
+		SetNumber:        "75192",
+		Title:            "Millennium Falcon",
+		Owned:            true,
+		QuantityOwned:    2,
+		ApproximateValue: &value,
+		ValueLastUpdated: &updated,
+		Notes:            &notes,
+	}}
+
+	var buf bytes.Buffer
+	opts := services.CSVExportOptions{Dialect: services.CSVDialectExcelEU}
+	if err := csvService.ExportToCSVWithOptions(sets, opts, &buf); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+
+	// Only the delimiter is detected; the rest comes from the dialect
+	_, rows, err := csvService.ParseCSV(&buf, services.CSVImportOptions{
+		Dialect: services.CSVDialect{DecimalSeparator: ',', DateFormat: "DD.MM.YYYY"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 1 || len(rows[0].Warnings) != 0 {
+		t.Fatalf("Expected 1 row without warnings, got %+v", rows)
+	}
+
+	set := rows[0].Set
+	if set.QuantityOwned != 2 || *set.ApproximateValue != 1249.5 || *set.ValueLastUpdated != "2024-01-02" || *set.Notes != notes {
+		t.Errorf("Round trip changed the set: %+v", set)
+	}
+}
+
+func TestCSVDialect_Validate(t *testing.T) {
+	valid := []services.CSVDialect{
+		{},
+		services.CSVDialectExcelEU,
+		{Delimiter: '\t', DateFormat: "YYYY/MM/DD"},
+	}
+	for _, dialect := range valid {
+		if err := dialect.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", dialect, err)
+		}
+	}
+
+	invalid := []services.CSVDialect{
+		{Delimiter: '"'},
+		{Delimiter: '\n'},
+		{DecimalSeparator: '_'},
+		{Delimiter: ',', DecimalSeparator: ','},
+		{DateFormat: "DD.MM.YY"},
+		{DateFormat: "DD-MM-DD"},
+		{DateFormat: "YYYY-MM"},
+	}
+	for _, dialect := range invalid {
+		if err := dialect.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", dialect)
+		}
+	}
+
+	if _, err := services.NewCSVService().NewExporter(&bytes.Buffer{}, services.CSVExportOptions{Dialect: invalid[0]}); err == nil {
+		t.Error("Expected NewExporter to reject an invalid dialect")
+	}
+}
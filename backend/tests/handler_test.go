@@ -0,0 +1,619 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/api/handlers"
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestHandler(t *testing.T) (*handlers.LegoSetHandler, db.LegoSetStore) {
+	t.Helper()
+	store := db.NewMemoryLegoSetRepository()
+	handler := handlers.NewLegoSetHandler(store, services.NewImageService(t.TempDir()), services.NewCSVService())
+	return handler, store
+}
+
+// serve calls a handler method with optional mux route variables
+func serve(handlerFunc http.HandlerFunc, req *http.Request, vars map[string]string) *httptest.ResponseRecorder {
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+	rec := httptest.NewRecorder()
+	handlerFunc(rec, req)
+	return rec
+}
+
+func TestLegoSetHandler_CreateLegoSet(t *testing.T) {
+	handler, store := newTestHandler(t)
+
+	body := `{"setNumber":"10276","title":"Colosseum","owned":true,"quantityOwned":1,"numParts":9036,"numMinifigs":0,"valueLastUpdated":"2024-01-15"}`
+	rec := serve(handler.CreateLegoSet, httptest.NewRequest("POST", "/api/lego-sets", strings.NewReader(body)), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created models.LegoSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.ID == "" || created.ValueLastUpdated == nil {
+		t.Errorf("Expected ID and parsed date, got %+v", created)
+	}
+
+	stored, _ := store.GetBySetNumber("10276")
+	if stored == nil {
+		t.Fatal("Expected set to be stored")
+	}
+
+	rec = serve(handler.CreateLegoSet, httptest.NewRequest("POST", "/api/lego-sets", strings.NewReader(body)), nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate set number, got %d", rec.Code)
+	}
+
+	rec = serve(handler.CreateLegoSet, httptest.NewRequest("POST", "/api/lego-sets", strings.NewReader(`{"setNumber":"1"}`)), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for missing title, got %d", rec.Code)
+	}
+	// Images are only set by uploading them
+	body = `{"setNumber":"75192","title":"Millennium Falcon","imageFilename":"../../etc/passwd"}`
+	rec = serve(handler.CreateLegoSet, httptest.NewRequest("POST", "/api/lego-sets", strings.NewReader(body)), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if falcon, _ := store.GetBySetNumber("75192"); falcon == nil || falcon.ImageFilename != nil {
+		t.Errorf("Expected the image filename to be ignored, got %+v", falcon)
+	}
+}
+
+func TestLegoSetHandler_GetUpdateDelete(t *testing.T) {
+	handler, store := newTestHandler(t)
+	sets := seedTestSets(t, store)
+	id := sets[0].ID
+
+	rec := serve(handler.GetLegoSet, httptest.NewRequest("GET", "/api/lego-sets/"+id, nil), map[string]string{"id": id})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = serve(handler.GetLegoSet, httptest.NewRequest("GET", "/api/lego-sets/missing", nil), map[string]string{"id": "missing"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+
+	update := `{"title":"Haunted House (Retired)","owned":true}`
+	rec = serve(handler.UpdateLegoSet, httptest.NewRequest("PUT", "/api/lego-sets/"+id, strings.NewReader(update)), map[string]string{"id": id})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var updated models.LegoSet
+	json.Unmarshal(rec.Body.Bytes(), &updated)
+	if updated.Title != "Haunted House (Retired)" || !updated.Owned {
+		t.Errorf("Expected update to be applied, got %+v", updated)
+	}
+
+	// Each nullable field is updated and read back from the store
+	fields := map[string]func(*models.LegoSet) *string{
+		"rebrickableUrl":       func(set *models.LegoSet) *string { return set.RebrickableURL },
+		"conditionDescription": func(set *models.LegoSet) *string { return set.ConditionDescription },
+	}
+	for field, get := range fields {
+		body := `{"` + field + `":"updated ` + field + `"}`
+		rec = serve(handler.UpdateLegoSet, httptest.NewRequest("PUT", "/api/lego-sets/"+id, strings.NewReader(body)), map[string]string{"id": id})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 updating %s, got %d: %s", field, rec.Code, rec.Body.String())
+		}
+		stored, _ := store.GetByID(id)
+		if got := stringValue(get(stored)); got != "updated "+field {
+			t.Errorf("Expected %s to be updated, got %q", field, got)
+		}
+	}
+
+	conflict := `{"setNumber":"75192"}`
+	rec = serve(handler.UpdateLegoSet, httptest.NewRequest("PUT", "/api/lego-sets/"+id, strings.NewReader(conflict)), map[string]string{"id": id})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+
+	rec = serve(handler.DeleteLegoSet, httptest.NewRequest("DELETE", "/api/lego-sets/"+id, nil), map[string]string{"id": id})
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	if remaining, _ := store.GetAll(nil, "", ""); len(remaining) != 2 {
+		t.Errorf("Expected 2 remaining sets, got %d", len(remaining))
+	}
+}
+
+func TestLegoSetHandler_GetAllAndStatistics(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	rec := serve(handler.GetAllLegoSets, httptest.NewRequest("GET", "/api/lego-sets?owned=true&sortBy=title&sortOrder=ASC", nil), nil)
+	var sets []*models.LegoSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &sets); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(sets) != 2 || sets[0].Title != "Home Alone" {
+		t.Errorf("Expected owned sets sorted by title, got %v", setNumbers(sets))
+	}
+
+	rec = serve(handler.GetStatistics, httptest.NewRequest("GET", "/api/statistics", nil), nil)
+	var stats models.Statistics
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Failed to decode statistics: %v", err)
+	}
+	if stats.OwnedSets != 2 {
+		t.Errorf("Expected 2 owned sets, got %d", stats.OwnedSets)
+	}
+}
+
+func TestLegoSetHandler_ExportCSV_Filtered(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+	if err := store.Create(newTestLegoSet("75313", "AT-AT", "Star Wars", false, 0, 6785, 9, 849.99, 2021)); err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+
+	rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?series=Star+Wars&owned=false&fields=set_number,Title", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if want := "Set Number,Title\n75313,AT-AT\n"; rec.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, rec.Body.String())
+	}
+
+	rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?q=ho&fields=title,owned", nil), nil)
+	if want := "Title,Owned\nHaunted House,false\nHome Alone,true\n"; rec.Body.String() != want {
+		t.Errorf("Expected search results sorted by title, got %q", rec.Body.String())
+	}
+
+	rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?q=a&sortBy=num_parts&sortOrder=DESC&fields=set_number", nil), nil)
+	if want := "Set Number\n75192\n75313\n21330\n10273\n"; rec.Body.String() != want {
+		t.Errorf("Expected search results sorted by parts, got %q", rec.Body.String())
+	}
+
+	for _, fields := range []string{"set_number,price_paid", "title,name"} {
+		rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?fields="+fields, nil), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for fields %s, got %d", fields, rec.Code)
+		}
+	}
+}
+
+// TestLegoSetHandler_Export_WholeCatalogFormats tests that the formats that
+// export the whole catalog reject the CSV export's filters
+func TestLegoSetHandler_Export_WholeCatalogFormats(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	for _, format := range []string{"json", "xlsx", "bricklink"} {
+		for _, query := range []string{"owned=true", "series=Ideas", "q=falcon", "sortBy=title", "fields=set_number", "dialect=excel-eu"} {
+			rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format="+format+"&"+query, nil), nil)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "only supported by CSV") {
+				t.Errorf("Expected status 400 for %s with %s, got %d: %s", format, query, rec.Code, rec.Body.String())
+			}
+		}
+
+		rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format="+format, nil), nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d: %s", format, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestLegoSetHandler_CSVDialect(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?dialect=excel-eu&owned=true&fields=set_number,title,approximate_value", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if want := "\ufeffSet Number;Title;Approximate Value\n21330;Home Alone;249,99\n75192;Millennium Falcon;849,99\n"; rec.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, rec.Body.String())
+	}
+
+	rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?dialect=excel-eu&delimiter=tab&bom=false&fields=set_number,approximate_value&owned=false", nil), nil)
+	if want := "Set Number\tApproximate Value\n10273\t249,99\n"; rec.Body.String() != want {
+		t.Errorf("Expected overrides to apply, got %q", rec.Body.String())
+	}
+
+	for _, query := range []string{"dialect=excel-us", "delimiter=%3B%3B", "decimal=_", "dateFormat=DD.MM.YY", "bom=maybe", "delimiter=,&decimal=,"} {
+		rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?"+query, nil), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rec.Code)
+		}
+	}
+
+	csvData := "Set Number;Title;Approximate Value;Value Last Updated\n10276;Colosseum;1549,99;15.03.2024\n"
+	rec = serve(handler.ImportCSV, newCSVUploadRequest(t, "/api/lego-sets/import?dialect=excel-eu", csvData), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	set, _ := store.GetBySetNumber("10276")
+	if set == nil || set.ApproximateValue == nil || *set.ApproximateValue != 1549.99 {
+		t.Fatalf("Expected 10276 worth 1549.99, got %+v", set)
+	}
+	if set.ValueLastUpdated == nil || set.ValueLastUpdated.Format("2006-01-02") != "2024-03-15" {
+		t.Errorf("Expected value last updated 2024-03-15, got %v", set.ValueLastUpdated)
+	}
+
+	rec = serve(handler.ImportCSV, newCSVUploadRequest(t, "/api/lego-sets/import?decimal=x", csvData), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid dialect, got %d", rec.Code)
+	}
+}
+
+// failingStore streams failAfter sets and then fails
+type failingStore struct {
+	db.LegoSetStore
+	failAfter int
+}
+
+func (s *failingStore) EachSet(ctx context.Context, filters map[string]interface{}, sortBy, sortOrder string, fn func(*models.LegoSet) error) error {
+	sent := 0
+	err := s.LegoSetStore.EachSet(ctx, filters, sortBy, sortOrder, func(set *models.LegoSet) error {
+		if sent == s.failAfter {
+			return errors.New("connection lost")
+		}
+		sent++
+		return fn(set)
+	})
+	if err == nil {
+		err = errors.New("connection lost")
+	}
+	return err
+}
+
+func TestLegoSetHandler_ExportCSV_Streaming(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	for i := 0; i < 1200; i++ {
+		if err := store.Create(newTestLegoSet(fmt.Sprintf("%05d", i), "Set", "Series", true, 1, 100, 1, 10, 2000)); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+	}
+	newHandler := func(store db.LegoSetStore) *handlers.LegoSetHandler {
+		return handlers.NewLegoSetHandler(store, services.NewImageService(t.TempDir()), services.NewCSVService())
+	}
+
+	rec := serve(newHandler(store).Export, httptest.NewRequest("GET", "/api/lego-sets/export?fields=set_number", nil), nil)
+	trailer := rec.Result().Trailer
+	if trailer.Get("X-Export-Status") != "complete" || trailer.Get("X-Export-Rows") != "1200" {
+		t.Errorf("Expected a complete export of 1200 rows, got trailers %v", trailer)
+	}
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 1201 {
+		t.Errorf("Expected a header and 1200 rows, got %d lines", lines)
+	}
+
+	// A failure after rows were sent ends the file with a marker
+	rec = serve(newHandler(&failingStore{LegoSetStore: store, failAfter: 1000}).Export,
+		httptest.NewRequest("GET", "/api/lego-sets/export?fields=set_number", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the started download to keep status 200, got %d", rec.Code)
+	}
+	trailer = rec.Result().Trailer
+	if trailer.Get("X-Export-Status") != "incomplete" || trailer.Get("X-Export-Rows") != "1000" {
+		t.Errorf("Expected an incomplete export of 1000 rows, got trailers %v", trailer)
+	}
+	if !strings.HasSuffix(rec.Body.String(), services.CSVTruncatedMarker+"export failed after 1000 rows\n") {
+		t.Errorf("Expected the body to end with the incomplete marker, got %q", rec.Body.String()[rec.Body.Len()-60:])
+	}
+
+	// A failure before anything was sent is a normal error response
+	rec = serve(newHandler(&failingStore{LegoSetStore: store, failAfter: 2}).Export,
+		httptest.NewRequest("GET", "/api/lego-sets/export", nil), nil)
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a JSON error, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestLegoSetHandler_ImportCSV(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	csvData := `Set Number,Alternate Set Number,Title,Owned,Quantity Owned,Release Year,Description,Series,Number of Parts,Number of Minifigs,Bricklink URL,Approximate Value,Value Last Updated,Notes
+10276,,Colosseum,true,1,2020,Roman Colosseum,Creator Expert,9036,0,,549.99,2024-01-15,
+75192,,Millennium Falcon,true,1,2017,,Star Wars,7541,8,,849.99,,`
+
+	rec := serve(handler.ImportCSV, newCSVUploadRequest(t, "/api/lego-sets/import", csvData), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result["imported"].(float64) != 1 || result["skipped"].(float64) != 1 {
+		t.Errorf("Expected 1 imported and 1 skipped, got %v", result)
+	}
+
+	if set, _ := store.GetBySetNumber("10276"); set == nil {
+		t.Error("Expected 10276 to be imported")
+	}
+}
+
+func TestLegoSetHandler_ImportCSV_DryRun(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	csvData := `Set Number,Title,Release Year,Number of Parts,Approximate Value
+10276,Colosseum,MMXX,9036,549.99
+75192,Millennium Falcon,2017,7541,849.99
+,Missing Set Number,2020,10,
+10276,Colosseum Again,2020,9036,$10
+21330,,2021,3955,
+40000,,2021,3955,`
+
+	rec := serve(handler.ImportCSV, newCSVUploadRequest(t, "/api/lego-sets/import?dryRun=true", csvData), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result models.ImportResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+
+	if !result.DryRun || result.Imported != 1 || result.Skipped != 3 || result.Failed != 2 {
+		t.Errorf("Expected dry run with 1 create, 3 skips and 2 errors, got %+v", result)
+	}
+
+	expected := []struct {
+		line   int
+		action models.ImportAction
+	}{
+		{2, models.ImportActionCreate},
+		{3, models.ImportActionSkip},
+		{4, models.ImportActionError},
+		{5, models.ImportActionSkip},
+		{6, models.ImportActionSkip},
+		{7, models.ImportActionError},
+	}
+	if len(result.Rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %d", len(expected), len(result.Rows))
+	}
+	for i, want := range expected {
+		row := result.Rows[i]
+		if row.Line != want.line || row.Action != want.action {
+			t.Errorf("Row %d: expected line %d %s, got line %d %s (%s)", i, want.line, want.action, row.Line, row.Action, row.Reason)
+		}
+	}
+
+	// A row without a title is only an error for a new set; an existing
+	// set is skipped before its title is checked
+	if reason := result.Rows[4].Reason; reason != "set already exists" {
+		t.Errorf("Expected the untitled existing set to be skipped, got %q", reason)
+	}
+	if reason := result.Rows[5].Reason; reason != "title is required" {
+		t.Errorf("Expected the untitled new set to fail, got %q", reason)
+	}
+
+	warnings := result.Rows[0].Warnings
+	if len(warnings) != 1 || warnings[0].Field != "release_year" {
+		t.Errorf("Expected a release year warning, got %+v", warnings)
+	}
+
+	// Nothing is written in a dry run
+	if set, _ := store.GetBySetNumber("10276"); set != nil {
+		t.Error("Expected dry run not to create 10276")
+	}
+}
+
+func TestLegoSetHandler_ExportImportJSON(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seeded := seedTestSets(t, store)
+
+	rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format=json", nil), nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected JSON export, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var catalog models.CatalogExport
+	if err := json.Unmarshal(rec.Body.Bytes(), &catalog); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if catalog.SchemaVersion != models.CatalogSchemaVersion || catalog.Count != 3 || catalog.Sets[0].ID != seeded[0].ID {
+		t.Errorf("Expected versioned export of 3 sets in creation order, got %+v", catalog)
+	}
+
+	target, targetStore := newTestHandler(t)
+	req := httptest.NewRequest("POST", "/api/lego-sets/import", bytes.NewReader(rec.Body.Bytes()))
+	req.Header.Set("Content-Type", "application/json")
+	rec = serve(target.Import, req, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if set, _ := targetStore.GetByID(seeded[2].ID); set == nil || set.SetNumber != "21330" {
+		t.Errorf("Expected 21330 to be restored with its ID, got %+v", set)
+	}
+
+	rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format=yaml", nil), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
+func TestLegoSetHandler_ImportRebrickable(t *testing.T) {
+	handler, store := newTestHandler(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, data := range map[string]string{
+		"setlist": "set_num,quantity\n10276-1,1\n",
+		"sets":    rebrickableSetsDump,
+		"themes":  rebrickableThemesDump,
+	} {
+		part, _ := writer.CreateFormFile(field, field+".csv")
+		part.Write([]byte(data))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/lego-sets/import?format=rebrickable", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := serve(handler.Import, req, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if set, _ := store.GetBySetNumber("10276"); set == nil || set.Title != "Colosseum" || stringValue(set.Series) != "Icons" {
+		t.Errorf("Expected 10276 imported from Rebrickable, got %+v", set)
+	}
+
+	body.Reset()
+	writer = multipart.NewWriter(&body)
+	writer.Close()
+	req = httptest.NewRequest("POST", "/api/lego-sets/import?format=rebrickable", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if rec := serve(handler.Import, req, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without any files, got %d", rec.Code)
+	}
+}
+
+func TestLegoSetHandler_ExportImportBrickLink(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format=bricklink&list=wanted", nil), nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("Expected XML export, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "<ITEMID>10273-1</ITEMID>") || strings.Contains(rec.Body.String(), "75192") {
+		t.Errorf("Expected only the unowned 10273 on the wanted list, got:\n%s", rec.Body.String())
+	}
+
+	target, targetStore := newTestHandler(t)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("xml", "wanted.xml")
+	part.Write(rec.Body.Bytes())
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/lego-sets/import?format=bricklink&list=wanted", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec = serve(target.Import, req, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if set, _ := targetStore.GetBySetNumber("10273"); set == nil || set.Owned {
+		t.Errorf("Expected 10273 imported as wanted, got %+v", set)
+	}
+
+	rec = serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format=bricklink&list=sold", nil), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown list, got %d", rec.Code)
+	}
+}
+
+func TestJobHandler_ImportJob(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	jobs := services.NewJobManager(services.NewImportService(store, services.NewCSVService()), 1)
+	handler := handlers.NewJobHandler(jobs)
+
+	rec := serve(handler.CreateImportJob, newCSVUploadRequest(t, "/api/jobs/import?strategy=merge", generateCSV(5)), nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var job models.Job
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if rec.Header().Get("Location") != "/api/jobs/"+job.ID {
+		t.Errorf("Expected Location header for job %s, got %q", job.ID, rec.Header().Get("Location"))
+	}
+	waitForJob(t, jobs, job.ID)
+
+	rec = serve(handler.GetJob, httptest.NewRequest("GET", "/api/jobs/"+job.ID, nil), map[string]string{"id": job.ID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if job.Status != models.JobStatusCompleted || job.Progress.Imported != 5 || job.Progress.Strategy != models.ImportStrategyMerge {
+		t.Errorf("Expected completed merge job with 5 imported, got %+v", job)
+	}
+
+	rec = serve(handler.CancelJob, httptest.NewRequest("POST", "/api/jobs/"+job.ID+"/cancel", nil), map[string]string{"id": job.ID})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 cancelling a finished job, got %d", rec.Code)
+	}
+
+	rec = serve(handler.GetJob, httptest.NewRequest("GET", "/api/jobs/missing", nil), map[string]string{"id": "missing"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+
+	rec = serve(handler.CreateImportJob, newCSVUploadRequest(t, "/api/jobs/import?strategy=replace", generateCSV(1)), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown strategy, got %d", rec.Code)
+	}
+}
+
+func TestBackupHandler_BackupRestore(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	uploadDir := t.TempDir()
+	seedBackupSets(t, store, uploadDir)
+	handler := handlers.NewBackupHandler(store, services.NewBackupService(services.NewImageService(uploadDir), services.NewImportService(store, services.NewCSVService())))
+
+	rec := serve(handler.CreateBackup, httptest.NewRequest("GET", "/api/backup", nil), nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected zip backup, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	backup := rec.Body.Bytes()
+
+	targetStore := db.NewMemoryLegoSetRepository()
+	target := handlers.NewBackupHandler(targetStore, services.NewBackupService(services.NewImageService(t.TempDir()), services.NewImportService(targetStore, services.NewCSVService())))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("backup", "backup.zip")
+	part.Write(backup)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/backup/restore?atomic=true", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec = serve(target.RestoreBackup, req, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result models.RestoreResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if result.Sets == nil || result.Sets.Imported != 3 || result.ImagesRestored != 2 || len(result.DanglingImages) != 1 {
+		t.Errorf("Expected 3 sets and 2 images restored with 1 dangling image, got %+v", result)
+	}
+
+	rec = serve(target.RestoreBackup, httptest.NewRequest("POST", "/api/backup/restore", strings.NewReader("not a zip")), nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid archive, got %d", rec.Code)
+	}
+}
+
+// newCSVUploadRequest builds a multipart request with a csv file field
+func newCSVUploadRequest(t *testing.T, target, csvData string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("csv", "sets.csv")
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(csvData))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
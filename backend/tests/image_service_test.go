@@ -0,0 +1,578 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/api/handlers"
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/services"
+)
+
+// memoryFile is an in-memory upload for SaveImage
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+// saveTestImage saves data as an upload named name
+func saveTestImage(imageService *services.ImageService, name string, data []byte) (string, error) {
+	header := &multipart.FileHeader{Filename: name, Size: int64(len(data))}
+	return imageService.SaveImage(memoryFile{bytes.NewReader(data)}, header, "abc", "10276")
+}
+
+// imageSize decodes the dimensions of a stored file
+func imageSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return config.Width, config.Height
+}
+
+func TestImageService_SaveImage_Variants(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	filename, err := saveTestImage(imageService, "colosseum.png", testPNG(t, 2000, 1000))
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if filename != "abc_10276.png" {
+		t.Errorf("Expected abc_10276.png, got %s", filename)
+	}
+
+	expected := map[string][2]int{
+		"thumbnail": {200, 100},
+		"medium":    {800, 400},
+		"full":      {1600, 800},
+	}
+	for _, variant := range services.ImageVariants {
+		path := filepath.Join(uploadDir, services.ImageVariantPath(filename, variant.Name))
+		width, height := imageSize(t, path)
+		if want := expected[variant.Name]; width != want[0] || height != want[1] {
+			t.Errorf("Expected %s to be %dx%d, got %dx%d", variant.Name, want[0], want[1], width, height)
+		}
+	}
+
+	urls := imageService.ImageURLs(filename)
+	if urls.Original != "/images/abc_10276.png" || urls.Thumbnail != "/images/variants/abc_10276.png/thumbnail.jpg" ||
+		urls.Full != "/images/variants/abc_10276.png/full.jpg" {
+		t.Errorf("Unexpected image URLs: %+v", urls)
+	}
+
+	if err := imageService.DeleteImage(filename); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, "variants", filename)); !os.IsNotExist(err) {
+		t.Error("Expected the variants to be deleted with the image")
+	}
+}
+
+func TestImageService_SaveImage_SmallImage(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	filename, err := saveTestImage(imageService, "small.png", testPNG(t, 120, 300))
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+
+	// Images are shrunk to fit but never enlarged
+	if width, height := imageSize(t, filepath.Join(uploadDir, services.ImageVariantPath(filename, "thumbnail"))); width != 80 || height != 200 {
+		t.Errorf("Expected an 80x200 thumbnail, got %dx%d", width, height)
+	}
+	if width, height := imageSize(t, filepath.Join(uploadDir, services.ImageVariantPath(filename, "full"))); width != 120 || height != 300 {
+		t.Errorf("Expected a 120x300 full variant, got %dx%d", width, height)
+	}
+}
+
+func TestImageService_SaveImage_Undecodable(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	if _, err := saveTestImage(imageService, "photo.jpg", []byte("not really a photo")); err == nil {
+		t.Fatal("Expected error for an image that can't be decoded")
+	}
+	if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+		t.Errorf("Expected nothing kept, got %d entries", len(entries))
+	}
+}
+
+func TestImageService_GenerateVariants(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	// An image stored before variants existed
+	writeTestPNG(t, uploadDir, "old_10276.png")
+	if imageService.HasVariants("old_10276.png") {
+		t.Fatal("Expected no variants yet")
+	}
+	if urls := imageService.ImageURLs("old_10276.png"); urls.Thumbnail != "/images/old_10276.png" {
+		t.Errorf("Expected the thumbnail to fall back to the original, got %s", urls.Thumbnail)
+	}
+
+	if err := imageService.GenerateVariants("old_10276.png"); err != nil {
+		t.Fatalf("Failed to generate variants: %v", err)
+	}
+	if !imageService.HasVariants("old_10276.png") {
+		t.Error("Expected variants after generating them")
+	}
+
+	if err := imageService.GenerateVariants("missing.png"); err == nil {
+		t.Error("Expected error for a missing image")
+	}
+	if err := imageService.GenerateVariants("../escape.png"); err == nil {
+		t.Error("Expected error for a filename outside the upload directory")
+	}
+}
+
+func TestImageService_RestoreImage_Variants(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	image := testPNG(t, 400, 300)
+	if err := imageService.RestoreImage("a_10276.png", bytes.NewReader(image)); err != nil {
+		t.Fatalf("Failed to restore image: %v", err)
+	}
+	if !imageService.HasVariants("a_10276.png") {
+		t.Error("Expected variants for a restored image")
+	}
+
+	// Files that aren't the image their name says are rejected, leaving the
+	// stored image alone
+	rejected := map[string][]byte{
+		"damaged":      []byte("damaged"),
+		"wrong format": testJPEG(t, 400, 300),
+	}
+	for name, data := range rejected {
+		if err := imageService.RestoreImage("a_10276.png", bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected %s image to be rejected", name)
+		}
+	}
+	if got := readStored(t, uploadDir, "a_10276.png"); !bytes.Equal(got, image) || !imageService.HasVariants("a_10276.png") {
+		t.Error("Expected the restored image and its variants to be kept")
+	}
+}
+
+func TestLegoSetHandler_ImageURLs(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	handler := handlers.NewLegoSetHandler(store, services.NewImageService(t.TempDir()), services.NewCSVService())
+
+	set, _ := store.GetBySetNumber("75192")
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("image", "falcon.png")
+	part.Write(testPNG(t, 400, 300))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/lego-sets/"+set.ID+"/image", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := serve(handler.UploadImage, req, map[string]string{"id": set.ID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(handler.GetLegoSet, httptest.NewRequest("GET", "/api/lego-sets/"+set.ID, nil), map[string]string{"id": set.ID})
+	want := `"imageUrls":{"original":"/images/` + set.ID + `_75192.png","thumbnail":"/images/variants/` + set.ID + `_75192.png/thumbnail.jpg"`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("Expected image URLs in %s", rec.Body.String())
+	}
+
+	rec = serve(handler.GetAllLegoSets, httptest.NewRequest("GET", "/api/lego-sets?owned=false", nil), nil)
+	if strings.Contains(rec.Body.String(), "imageUrls") {
+		t.Errorf("Expected no image URLs for sets without images, got %s", rec.Body.String())
+	}
+}
+
+// testJPEG encodes an image that is red on the left and blue on the right
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// exifTIFF builds EXIF data with an orientation and a location comment
+func exifTIFF(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 1, 0) // one IFD entry
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	return append(tiff, "GPS 41.8902N 12.4922E"...)
+}
+
+// withEXIF inserts an EXIF segment with an orientation and a location
+// comment after a JPEG's start of image marker
+func withEXIF(jpegData []byte, orientation uint16) []byte {
+	payload := append([]byte("Exif\x00\x00"), exifTIFF(orientation)...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+// pngChunk encodes a PNG chunk with its checksum
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testWebP is a 1x1 lossless WebP image
+const testWebP = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+// readStored reads an image from the upload directory
+func readStored(t *testing.T, uploadDir, filename string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(uploadDir, filename))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", filename, err)
+	}
+	return data
+}
+
+func TestImageService_SaveImage_StripsJPEGMetadata(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	plain := testJPEG(t, 40, 20)
+	filename, err := saveTestImage(imageService, "photo.JPEG", withEXIF(plain, 1))
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if filename != "abc_10276.jpg" {
+		t.Errorf("Expected abc_10276.jpg, got %s", filename)
+	}
+
+	// An upright JPEG only loses the EXIF segment
+	if stored := readStored(t, uploadDir, filename); !bytes.Equal(stored, plain) {
+		t.Errorf("Expected the JPEG without its EXIF segment, got %d bytes (want %d)", len(stored), len(plain))
+	}
+}
+
+func TestImageService_SaveImage_AppliesOrientation(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	// A landscape photo taken with the phone held upright is stored on its
+	// side with orientation 6
+	filename, err := saveTestImage(imageService, "photo.jpg", withEXIF(testJPEG(t, 40, 20), 6))
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+
+	stored := readStored(t, uploadDir, filename)
+	if bytes.Contains(stored, []byte("Exif")) || bytes.Contains(stored, []byte("GPS")) {
+		t.Error("Expected the EXIF data to be stripped")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("Failed to decode stored image: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 20 || bounds.Dy() != 40 {
+		t.Fatalf("Expected a 20x40 image, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	// Turned clockwise, the red left half ends up on top
+	if r, _, b, _ := img.At(10, 5).RGBA(); r < b {
+		t.Error("Expected red at the top")
+	}
+	if r, _, b, _ := img.At(10, 35).RGBA(); b < r {
+		t.Error("Expected blue at the bottom")
+	}
+
+	width, height := imageSize(t, filepath.Join(uploadDir, services.ImageVariantPath(filename, "thumbnail")))
+	if width != 20 || height != 40 {
+		t.Errorf("Expected the thumbnail to be upright, got %dx%d", width, height)
+	}
+}
+
+func TestImageService_SaveImage_StripsPNGMetadata(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	// Add text and EXIF chunks after the header chunk
+	plain := testPNG(t, 30, 20)
+	withText := append([]byte{}, plain[:33]...)
+	withText = append(withText, pngChunk("tEXt", []byte("Location\x0041.8902N 12.4922E"))...)
+	withText = append(withText, pngChunk("eXIf", []byte("MM\x00*\x00\x00\x00\x08"))...)
+	withText = append(withText, plain[33:]...)
+
+	filename, err := saveTestImage(imageService, "photo.png", withText)
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if stored := readStored(t, uploadDir, filename); !bytes.Equal(stored, plain) {
+		t.Errorf("Expected the PNG without its text and EXIF chunks")
+	}
+}
+
+func TestImageService_SaveImage_StripsGIFMetadata(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	var buf bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.White})
+	if err := gif.Encode(&buf, frame, nil); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+	// Put a comment extension before the trailer
+	data := buf.Bytes()
+	withComment := append([]byte{}, data[:len(data)-1]...)
+	withComment = append(withComment, 0x21, 0xfe, 6)
+	withComment = append(withComment, "secret"...)
+	withComment = append(withComment, 0, 0x3b)
+
+	filename, err := saveTestImage(imageService, "animation.gif", withComment)
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	stored := readStored(t, uploadDir, filename)
+	if bytes.Contains(stored, []byte("secret")) {
+		t.Error("Expected the GIF comment to be stripped")
+	}
+	if _, err := gif.Decode(bytes.NewReader(stored)); err != nil {
+		t.Errorf("Expected a valid GIF: %v", err)
+	}
+}
+
+func TestImageService_SaveImage_StripsWebPMetadata(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	simple, _ := base64.StdEncoding.DecodeString(testWebP)
+
+	// Rebuild it in the extended format with an EXIF chunk
+	vp8x := []byte("VP8X\x0a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	exif := []byte("EXIF\x0c\x00\x00\x00GPS 41.8902N")
+	body := append([]byte("WEBP"), vp8x...)
+	body = append(body, simple[12:]...)
+	body = append(body, exif...)
+	extended := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	extended = append(extended, body...)
+
+	filename, err := saveTestImage(imageService, "photo.webp", extended)
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if filename != "abc_10276.webp" {
+		t.Errorf("Expected abc_10276.webp, got %s", filename)
+	}
+
+	stored := readStored(t, uploadDir, filename)
+	if bytes.Contains(stored, []byte("EXIF")) || bytes.Contains(stored, []byte("GPS")) {
+		t.Error("Expected the EXIF chunk to be stripped")
+	}
+	if flags := stored[20]; flags&0x08 != 0 {
+		t.Errorf("Expected the EXIF flag to be cleared, got %#x", flags)
+	}
+	if size := binary.LittleEndian.Uint32(stored[4:]); int(size) != len(stored)-8 {
+		t.Errorf("Expected a RIFF size of %d, got %d", len(stored)-8, size)
+	}
+	if !imageService.HasVariants(filename) {
+		t.Error("Expected variants for the WebP image")
+	}
+}
+
+func TestImageService_SaveImage_AppliesPNGOrientation(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	plain := testPNG(t, 30, 20)
+	withExif := append([]byte{}, plain[:33]...)
+	withExif = append(withExif, pngChunk("eXIf", exifTIFF(6))...)
+	withExif = append(withExif, plain[33:]...)
+
+	filename, err := saveTestImage(imageService, "photo.png", withExif)
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	stored := readStored(t, uploadDir, filename)
+	if bytes.Contains(stored, []byte("eXIf")) || bytes.Contains(stored, []byte("GPS")) {
+		t.Error("Expected the EXIF chunk to be stripped")
+	}
+
+	img, err := png.Decode(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("Failed to decode stored image: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 20 || bounds.Dy() != 30 {
+		t.Fatalf("Expected a 20x30 image, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	// Turned clockwise, the bottom left pixel ends up top left
+	if c := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA); c.R != 0 || c.G != 19 {
+		t.Errorf("Expected the bottom left pixel at the top left, got %+v", c)
+	}
+}
+
+func TestImageService_SaveImage_AppliesWebPOrientation(t *testing.T) {
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+
+	// Widen the 1x1 image to 4x1; it is a single colour, so the image data
+	// decodes to any size
+	simple, _ := base64.StdEncoding.DecodeString(testWebP)
+	simple[21] = 3
+	vp8x := []byte("VP8X\x0a\x00\x00\x00\x08\x00\x00\x00\x03\x00\x00\x00\x00\x00")
+	exif := append([]byte("EXIF"), binary.LittleEndian.AppendUint32(nil, uint32(len(exifTIFF(6))))...)
+	exif = append(exif, exifTIFF(6)...)
+	if len(exif)%2 == 1 {
+		exif = append(exif, 0)
+	}
+	body := append([]byte("WEBP"), vp8x...)
+	body = append(body, simple[12:]...)
+	body = append(body, exif...)
+	extended := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	extended = append(extended, body...)
+
+	// There is no WebP encoder, so the turned image is stored as a PNG
+	filename, err := saveTestImage(imageService, "photo.webp", extended)
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	if filename != "abc_10276.png" {
+		t.Errorf("Expected abc_10276.png, got %s", filename)
+	}
+
+	stored := readStored(t, uploadDir, filename)
+	if bytes.Contains(stored, []byte("GPS")) {
+		t.Error("Expected the EXIF data to be stripped")
+	}
+	img, err := png.Decode(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("Failed to decode stored image: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 1 || bounds.Dy() != 4 {
+		t.Errorf("Expected a 1x4 image, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestImageService_SaveImage_Rejected(t *testing.T) {
+	// An IHDR chunk claiming a 10000x10000 image, with no image data
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 10000)
+	binary.BigEndian.PutUint32(ihdr[4:], 10000)
+	ihdr[8], ihdr[9] = 8, 2
+	huge := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", ihdr)...)
+
+	oversized := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 10<<20)...)
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want error
+	}{
+		{"disguised executable", "photo.jpg", []byte("MZ\x90\x00 this program cannot be run in DOS mode"), services.ErrUnsupportedImage},
+		{"disguised text", "photo.png", []byte("<svg xmlns='http://www.w3.org/2000/svg'/>"), services.ErrUnsupportedImage},
+		{"image with a wrong extension", "photo.txt", testPNG(t, 10, 10), services.ErrUnsupportedImage},
+		{"truncated", "photo.png", testPNG(t, 100, 100)[:60], services.ErrInvalidImage},
+		{"too many pixels", "photo.png", huge, services.ErrImageTooLarge},
+		{"too many bytes", "photo.png", oversized, services.ErrImageTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uploadDir := t.TempDir()
+			_, err := saveTestImage(services.NewImageService(uploadDir), tt.file, tt.data)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if entries, _ := os.ReadDir(uploadDir); len(entries) != 0 {
+				t.Errorf("Expected nothing stored, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestLegoSetHandler_UploadImage_Rejected(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+	set, _ := store.GetBySetNumber("10273")
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want int
+	}{
+		{"disguised", "photo.jpg", []byte("#!/bin/sh\necho hello\n"), http.StatusUnsupportedMediaType},
+		{"truncated", "photo.png", testPNG(t, 100, 100)[:60], http.StatusBadRequest},
+		{"oversized", "photo.png", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 10<<20)...), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			part, _ := writer.CreateFormFile("image", tt.file)
+			part.Write(tt.data)
+			writer.Close()
+
+			req := httptest.NewRequest("POST", "/api/lego-sets/"+set.ID+"/image", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			rec := serve(handler.UploadImage, req, map[string]string{"id": set.ID})
+			if rec.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if set, _ := store.GetByID(set.ID); set.ImageFilename != nil {
+		t.Errorf("Expected no image after rejected uploads, got %s", *set.ImageFilename)
+	}
+}
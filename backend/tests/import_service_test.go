@@ -0,0 +1,311 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+const upsertTestCSV = `Set Number,Title,Quantity Owned,Series,Approximate Value,Value Last Updated,Notes
+75192,Millennium Falcon,3,,899.99,2024-06-01,Second copy sealed
+21330,Home Alone,2,Ideas,249.99,,
+10276,Colosseum,1,Icons,549.99,,`
+
+func TestImportService_Strategies(t *testing.T) {
+	tests := []struct {
+		strategy models.ImportStrategy
+		updated  int
+		skipped  int
+		changes  []string
+		series   *string
+	}{
+		{models.ImportStrategySkip, 0, 2, nil, stringPtr("Star Wars")},
+		{models.ImportStrategyOverwrite, 1, 1, []string{"quantity_owned", "series", "approximate_value", "value_last_updated", "notes"}, nil},
+		{models.ImportStrategyMerge, 1, 1, []string{"quantity_owned", "approximate_value", "value_last_updated", "notes"}, stringPtr("Star Wars")},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+				seedTestSets(t, store)
+				importService := services.NewImportService(store, services.NewCSVService())
+
+				result, err := importService.ImportCSV(strings.NewReader(upsertTestCSV), services.ImportOptions{Strategy: tt.strategy})
+				if err != nil {
+					t.Fatalf("Failed to import: %v", err)
+				}
+
+				if result.Imported != 1 || result.Updated != tt.updated || result.Skipped != tt.skipped || result.Failed != 0 {
+					t.Fatalf("Expected 1 imported, %d updated and %d skipped, got %+v", tt.updated, tt.skipped, result)
+				}
+
+				// Home Alone matches the file exactly and is never changed
+				if row := result.Rows[1]; row.Action != models.ImportActionSkip {
+					t.Errorf("Expected unchanged set to be skipped, got %s", row.Action)
+				}
+
+				fields := []string{}
+				for _, change := range result.Rows[0].Changes {
+					fields = append(fields, change.Field)
+				}
+				if strings.Join(fields, ",") != strings.Join(tt.changes, ",") {
+					t.Errorf("Expected changes to %v, got %v", tt.changes, result.Rows[0].Changes)
+				}
+
+				falcon, err := store.GetBySetNumber("75192")
+				if err != nil || falcon == nil {
+					t.Fatalf("Failed to get 75192: %v", err)
+				}
+
+				if (tt.series == nil) != (falcon.Series == nil) || tt.series != nil && *falcon.Series != *tt.series {
+					t.Errorf("Expected series %v, got %v", tt.series, falcon.Series)
+				}
+
+				if tt.strategy == models.ImportStrategySkip {
+					if falcon.QuantityOwned != 1 {
+						t.Errorf("Expected quantity 1 to be kept, got %d", falcon.QuantityOwned)
+					}
+					return
+				}
+
+				if falcon.QuantityOwned != 3 || falcon.ApproximateValue == nil || *falcon.ApproximateValue != 899.99 {
+					t.Errorf("Expected quantity 3 worth 899.99, got %d worth %v", falcon.QuantityOwned, falcon.ApproximateValue)
+				}
+				if falcon.ValueLastUpdated == nil || falcon.ValueLastUpdated.Format("2006-01-02") != "2024-06-01" {
+					t.Errorf("Expected value last updated 2024-06-01, got %v", falcon.ValueLastUpdated)
+				}
+				if falcon.Notes == nil || *falcon.Notes != "Second copy sealed" {
+					t.Errorf("Expected notes to be updated, got %v", falcon.Notes)
+				}
+			})
+		})
+	}
+}
+
+func TestImportService_ImageFilenameNotImported(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+		falcon, _ := store.GetBySetNumber("75192")
+		if err := store.Update(falcon.ID, map[string]interface{}{"image_filename": falcon.ID + "_75192.png"}); err != nil {
+			t.Fatalf("Failed to set image: %v", err)
+		}
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		// Overwrite takes every column in the file, but never the image
+		csvData := "Set Number,Title,Image Filename\n75192,Millennium Falcon,other_10276.png\n40000,New Set,other_10276.png\n"
+		result, err := importService.ImportCSV(strings.NewReader(csvData), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.Imported != 1 || result.Updated != 0 || result.Skipped != 1 {
+			t.Errorf("Expected 1 imported and 1 unchanged, got %+v", result)
+		}
+
+		if got, _ := store.GetBySetNumber("75192"); stringValue(got.ImageFilename) != falcon.ID+"_75192.png" {
+			t.Errorf("Expected the image to be kept, got %v", got.ImageFilename)
+		}
+		if got, _ := store.GetBySetNumber("40000"); got == nil || got.ImageFilename != nil {
+			t.Errorf("Expected a new set without an image, got %+v", got)
+		}
+	})
+}
+
+func TestImportService_InvalidStrategy(t *testing.T) {
+	importService := services.NewImportService(db.NewMemoryLegoSetRepository(), services.NewCSVService())
+
+	_, err := importService.ImportCSV(strings.NewReader(upsertTestCSV), services.ImportOptions{Strategy: "replace"})
+	if err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestImportService_Atomic(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		csvData := `Set Number,Title,Quantity Owned
+10276,Colosseum,1
+75192,Millennium Falcon,5
+42115,,1`
+
+		opts := services.ImportOptions{Strategy: models.ImportStrategyMerge, Atomic: true}
+		result, err := importService.ImportCSV(strings.NewReader(csvData), opts)
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+
+		if !result.RolledBack || result.Failed != 1 {
+			t.Fatalf("Expected rollback after 1 failed row, got %+v", result)
+		}
+		if set, _ := store.GetBySetNumber("10276"); set != nil {
+			t.Error("Expected 10276 not to be created")
+		}
+		if set, _ := store.GetBySetNumber("75192"); set == nil || set.QuantityOwned != 1 {
+			t.Errorf("Expected 75192 quantity to stay 1, got %+v", set)
+		}
+
+		// Without the bad row the whole file is applied
+		csvData = strings.TrimSuffix(csvData, "\n42115,,1")
+		result, err = importService.ImportCSV(strings.NewReader(csvData), opts)
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.RolledBack || result.Imported != 1 || result.Updated != 1 {
+			t.Fatalf("Expected 1 imported and 1 updated, got %+v", result)
+		}
+		if set, _ := store.GetBySetNumber("75192"); set == nil || set.QuantityOwned != 5 {
+			t.Errorf("Expected 75192 quantity 5, got %+v", set)
+		}
+	})
+}
+
+// errTxAborted is what abortingStore returns once a query has failed
+var errTxAborted = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+
+// abortingStore makes a transaction reject every query after one fails, as
+// PostgreSQL does, so tests on SQLite catch imports that carry on querying
+type abortingStore struct {
+	db.LegoSetStore
+	aborted bool
+}
+
+func (s *abortingStore) RunInTx(fn func(store db.LegoSetStore) error) error {
+	return s.LegoSetStore.RunInTx(func(tx db.LegoSetStore) error {
+		return fn(&abortingStore{LegoSetStore: tx})
+	})
+}
+
+// do runs a query unless the transaction has already been aborted
+func (s *abortingStore) do(query func() error) error {
+	if s.aborted {
+		return errTxAborted
+	}
+	err := query()
+	if err != nil {
+		s.aborted = true
+	}
+	return err
+}
+
+func (s *abortingStore) GetBySetNumbers(setNumbers []string) (found map[string]*models.LegoSet, err error) {
+	err = s.do(func() error {
+		found, err = s.LegoSetStore.GetBySetNumbers(setNumbers)
+		return err
+	})
+	return found, err
+}
+
+func (s *abortingStore) GetByID(id string) (set *models.LegoSet, err error) {
+	err = s.do(func() error {
+		set, err = s.LegoSetStore.GetByID(id)
+		return err
+	})
+	return set, err
+}
+
+func (s *abortingStore) GetBySetNumber(setNumber string) (set *models.LegoSet, err error) {
+	err = s.do(func() error {
+		set, err = s.LegoSetStore.GetBySetNumber(setNumber)
+		return err
+	})
+	return set, err
+}
+
+func (s *abortingStore) CreateMany(sets []*models.LegoSet) error {
+	return s.do(func() error { return s.LegoSetStore.CreateMany(sets) })
+}
+
+func (s *abortingStore) Update(id string, updates map[string]interface{}) error {
+	return s.do(func() error { return s.LegoSetStore.Update(id, updates) })
+}
+
+func (s *abortingStore) Restore(set *models.LegoSet) error {
+	return s.do(func() error { return s.LegoSetStore.Restore(set) })
+}
+
+func TestImportService_Atomic_FailedWrite(t *testing.T) {
+	database := openTestSQLite(t, true)
+	// Any insert of set 60050 fails in the database itself
+	_, err := database.Exec(`CREATE TRIGGER reject_60050 BEFORE INSERT ON lego_sets
+		WHEN NEW.set_number = '60050' BEGIN SELECT RAISE(ABORT, 'set 60050 rejected'); END`)
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	store := &abortingStore{LegoSetStore: db.NewLegoSetRepository(database)}
+	importService := services.NewImportService(store, services.NewCSVService())
+	opts := services.ImportOptions{Atomic: true, SummaryOnly: true}
+
+	// The bad row is in the first batch, so a second batch follows it
+	var csvData strings.Builder
+	csvData.WriteString("Set Number,Title\n")
+	for i := 0; i < 150; i++ {
+		fmt.Fprintf(&csvData, "%d,Set %d\n", 60000+i, i)
+	}
+
+	result, err := importService.ImportCSV(strings.NewReader(csvData.String()), opts)
+	if err != nil {
+		t.Fatalf("Expected a rolled back result, got %v", err)
+	}
+	if !result.RolledBack || result.Failed == 0 || !strings.Contains(strings.Join(result.Errors, "\n"), "60050 rejected") {
+		t.Errorf("Expected the import to roll back after set 60050 failed, got %+v", result)
+	}
+
+	catalog := `{"schemaVersion": 2, "sets": [
+		{"setNumber": "60001", "title": "First"},
+		{"setNumber": "60050", "title": "Rejected"},
+		{"setNumber": "60002", "title": "After"}
+	]}`
+	result, err = importService.ImportJSON(strings.NewReader(catalog), opts)
+	if err != nil {
+		t.Fatalf("Expected a rolled back result, got %v", err)
+	}
+	if !result.RolledBack || result.Failed != 1 {
+		t.Errorf("Expected the restore to roll back after set 60050 failed, got %+v", result)
+	}
+
+	if sets, _ := store.GetAll(nil, "", ""); len(sets) != 0 {
+		t.Errorf("Expected nothing to be written, got %d sets", len(sets))
+	}
+}
+
+func TestImportService_LargeFile(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		var csvData strings.Builder
+		csvData.WriteString("Set Number,Title\n")
+		for i := 0; i < 250; i++ {
+			fmt.Fprintf(&csvData, "%d,Set %d\n", 60000+i, i)
+		}
+		// An existing set number in the middle of a batch
+		csvData.WriteString("75192,Millennium Falcon\n")
+
+		result, err := importService.ImportCSV(strings.NewReader(csvData.String()), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.Imported != 250 || result.Skipped != 1 || result.Failed != 0 {
+			t.Fatalf("Expected 250 imported and 1 skipped, got imported %d skipped %d failed %d: %v",
+				result.Imported, result.Skipped, result.Failed, result.Errors)
+		}
+
+		sets, err := store.GetAll(nil, "", "")
+		if err != nil {
+			t.Fatalf("Failed to get sets: %v", err)
+		}
+		if len(sets) != 253 {
+			t.Errorf("Expected 253 sets, got %d", len(sets))
+		}
+	})
+}
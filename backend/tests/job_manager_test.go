@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+// blockingStore holds GetBySetNumbers until release is closed
+type blockingStore struct {
+	db.LegoSetStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) GetBySetNumbers(setNumbers []string) (map[string]*models.LegoSet, error) {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return s.LegoSetStore.GetBySetNumbers(setNumbers)
+}
+
+func TestJobManager_Import(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	jobs := services.NewJobManager(services.NewImportService(store, services.NewCSVService()), 1)
+
+	csvData := generateCSV(250) + "75192,Millennium Falcon\n,No Set Number\n"
+	job := submitTestImport(t, jobs, csvData, services.ImportOptions{})
+	if job.Status != models.JobStatusQueued || job.BytesTotal != int64(len(csvData)) {
+		t.Errorf("Expected queued job of %d bytes, got %+v", len(csvData), job)
+	}
+
+	job = waitForJob(t, jobs, job.ID)
+	if job.Status != models.JobStatusCompleted {
+		t.Fatalf("Expected completed job, got %s: %s", job.Status, job.Error)
+	}
+
+	progress := job.Progress
+	if progress.Processed != 252 || progress.Imported != 250 || progress.Skipped != 1 || progress.Failed != 1 {
+		t.Errorf("Expected 252 processed, 250 imported, 1 skipped and 1 failed, got %+v", progress)
+	}
+	if len(progress.Errors) != 1 || len(progress.Rows) != 0 {
+		t.Errorf("Expected 1 error and no row reports, got %v and %d rows", progress.Errors, len(progress.Rows))
+	}
+	if job.BytesRead != job.BytesTotal || job.StartedAt == nil || job.FinishedAt == nil {
+		t.Errorf("Expected the whole file read with start and finish times, got %+v", job)
+	}
+
+	if set, _ := store.GetBySetNumber("60249"); set == nil {
+		t.Error("Expected the last generated set to be imported")
+	}
+	if len(jobs.List()) != 1 {
+		t.Errorf("Expected 1 listed job, got %d", len(jobs.List()))
+	}
+}
+
+func TestJobManager_Cancel(t *testing.T) {
+	store := &blockingStore{
+		LegoSetStore: db.NewMemoryLegoSetRepository(),
+		started:      make(chan struct{}, 1),
+		release:      make(chan struct{}),
+	}
+	jobs := services.NewJobManager(services.NewImportService(store, services.NewCSVService()), 1)
+
+	running := submitTestImport(t, jobs, generateCSV(250), services.ImportOptions{})
+	<-store.started
+	queued := submitTestImport(t, jobs, generateCSV(10), services.ImportOptions{})
+
+	// A queued job is cancelled straight away
+	job, err := jobs.Cancel(queued.ID)
+	if err != nil || job.Status != models.JobStatusCancelled {
+		t.Fatalf("Expected queued job to be cancelled, got %+v, %v", job, err)
+	}
+	if _, err := jobs.Cancel(queued.ID); err != services.ErrJobFinished {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+
+	// A running job stops after its current batch
+	if _, err := jobs.Cancel(running.ID); err != nil {
+		t.Fatalf("Failed to cancel running job: %v", err)
+	}
+	close(store.release)
+
+	job = waitForJob(t, jobs, running.ID)
+	if job.Status != models.JobStatusCancelled {
+		t.Fatalf("Expected cancelled job, got %s", job.Status)
+	}
+	if job.Progress.Imported != 100 {
+		t.Errorf("Expected the first batch of 100 to be imported, got %d", job.Progress.Imported)
+	}
+
+	if _, err := jobs.Get("missing"); err != services.ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+// generateCSV returns a CSV file of n new sets numbered from 60000
+func generateCSV(n int) string {
+	var b strings.Builder
+	b.WriteString("Set Number,Title\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%d,Set %d\n", 60000+i, i)
+	}
+	return b.String()
+}
+
+func submitTestImport(t *testing.T, jobs *services.JobManager, csvData string, opts services.ImportOptions) *models.Job {
+	t.Helper()
+
+	path, size, err := jobs.StageUpload(strings.NewReader(csvData), 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to stage upload: %v", err)
+	}
+	job, err := jobs.SubmitImport(path, "sets.csv", size, opts)
+	if err != nil {
+		os.Remove(path)
+		t.Fatalf("Failed to submit import: %v", err)
+	}
+	return job
+}
+
+func waitForJob(t *testing.T, jobs *services.JobManager, id string) *models.Job {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := jobs.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("Failed waiting for job: %v", err)
+	}
+	return job
+}
@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+func TestJSONService_ImportFromJSON_Invalid(t *testing.T) {
+	jsonService := services.NewJSONService()
+
+	tests := map[string]string{
+		"not json":        `Set Number,Title`,
+		"missing version": `{"sets": []}`,
+		"newer version":   `{"schemaVersion": 99, "sets": []}`,
+		"unknown field":   `{"schemaVersion": 1, "sets": [{"setNumber": "10276", "title": "Colosseum", "colour": "grey"}]}`,
+		"null set":        `{"schemaVersion": 1, "sets": [null]}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := jsonService.ImportFromJSON(strings.NewReader(data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestImportService_ImportJSON_RoundTrip(t *testing.T) {
+	source := db.NewMemoryLegoSetRepository()
+	seeded := seedTestSets(t, source)
+
+	full := createTestLegoSet()
+	full.SetNumber = "10276"
+	condition := "Sealed"
+	rebrickable := "https://rebrickable.com/sets/10276-1/"
+	full.ConditionDescription = &condition
+	full.RebrickableURL = &rebrickable
+	if err := source.Create(full); err != nil {
+		t.Fatalf("Failed to create set: %v", err)
+	}
+	image := full.ID + "_10276.jpg"
+	full.ImageFilename = &image
+	if err := source.Update(full.ID, map[string]interface{}{"image_filename": image}); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+
+	sets, err := source.GetAll(nil, "created_at", "ASC")
+	if err != nil {
+		t.Fatalf("Failed to get sets: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := services.NewJSONService().ExportToJSON(sets, nil, &buf); err != nil {
+		t.Fatalf("Failed to export JSON: %v", err)
+	}
+	exported := buf.String()
+
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		result, err := importService.ImportJSON(strings.NewReader(exported), services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to import JSON: %v", err)
+		}
+		if result.Imported != 4 || result.Failed != 0 {
+			t.Fatalf("Expected 4 imported, got %+v", result)
+		}
+
+		for _, want := range append(seeded, full) {
+			got, err := store.GetByID(want.ID)
+			if err != nil || got == nil {
+				t.Fatalf("Expected set %s to keep ID %s, got %v", want.SetNumber, want.ID, err)
+			}
+			if !got.CreatedAt.Truncate(time.Second).Equal(want.CreatedAt.Truncate(time.Second)) {
+				t.Errorf("Expected %s created at %v, got %v", want.SetNumber, want.CreatedAt, got.CreatedAt)
+			}
+			if stringValue(got.ImageFilename) != stringValue(want.ImageFilename) ||
+				stringValue(got.ConditionDescription) != stringValue(want.ConditionDescription) ||
+				stringValue(got.RebrickableURL) != stringValue(want.RebrickableURL) {
+				t.Errorf("Expected %s to round-trip every field, got %+v", want.SetNumber, got)
+			}
+		}
+
+		// Importing again changes nothing
+		result, err = importService.ImportJSON(strings.NewReader(exported), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import JSON: %v", err)
+		}
+		if result.Skipped != 4 {
+			t.Errorf("Expected 4 unchanged sets to be skipped, got %+v", result)
+		}
+	})
+}
+
+func TestImportService_ImportJSON_Conflicts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seeded := seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		falcon := seeded[1]
+		data := `{"schemaVersion": 1, "sets": [
+			{"id": "` + falcon.ID + `", "setNumber": "75192", "title": "UCS Millennium Falcon", "quantityOwned": 2, "createdAt": "2020-01-01T00:00:00Z", "updatedAt": "2020-01-02T00:00:00Z"},
+			{"id": "11111111-1111-1111-1111-111111111111", "setNumber": "21330", "title": "Home Alone"},
+			{"id": "not-a-uuid", "setNumber": "10276", "title": "Colosseum"},
+			{"setNumber": "42115", "title": "Lamborghini Sian"}
+		]}`
+
+		result, err := importService.ImportJSON(strings.NewReader(data), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import JSON: %v", err)
+		}
+
+		actions := []models.ImportAction{}
+		for _, row := range result.Rows {
+			actions = append(actions, row.Action)
+		}
+		want := []models.ImportAction{models.ImportActionUpdate, models.ImportActionError, models.ImportActionError, models.ImportActionCreate}
+		for i := range want {
+			if i >= len(actions) || actions[i] != want[i] {
+				t.Fatalf("Expected actions %v, got %v", want, actions)
+			}
+		}
+
+		got, _ := store.GetByID(falcon.ID)
+		if got == nil || got.Title != "UCS Millennium Falcon" || got.QuantityOwned != 2 || got.Series != nil {
+			t.Errorf("Expected 75192 to be replaced, got %+v", got)
+		}
+		if got != nil && got.CreatedAt.UTC().Format("2006-01-02") != "2020-01-01" {
+			t.Errorf("Expected restored created at, got %v", got.CreatedAt)
+		}
+		if result.Rows[3].ID == "" {
+			t.Error("Expected a new ID for a set without one")
+		}
+
+		if _, err := importService.ImportJSON(strings.NewReader(data), services.ImportOptions{Strategy: models.ImportStrategyMerge}); err == nil {
+			t.Error("Expected merge to be rejected")
+		}
+	})
+}
+
+func TestImportService_ImportJSON_ImageFilenames(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seeded := seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		house, falcon := seeded[0], seeded[1]
+		data := `{"schemaVersion": 1, "sets": [
+			{"id": "` + house.ID + `", "setNumber": "10273", "title": "Haunted House", "imageFilename": "` + house.ID + `_10273.jpg"},
+			{"id": "` + falcon.ID + `", "setNumber": "75192", "title": "Millennium Falcon", "imageFilename": "` + house.ID + `_10273.jpg"},
+			{"setNumber": "42115", "title": "Lamborghini Sian", "imageFilename": "../../etc/passwd"}
+		]}`
+
+		result, err := importService.ImportJSON(strings.NewReader(data), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import JSON: %v", err)
+		}
+		if result.Warnings != 2 || len(result.Rows[0].Warnings) != 0 {
+			t.Errorf("Expected warnings for the two images named after other sets, got %+v", result.Rows)
+		}
+
+		if got, _ := store.GetByID(house.ID); stringValue(got.ImageFilename) != house.ID+"_10273.jpg" {
+			t.Errorf("Expected the set's own image to be restored, got %v", got.ImageFilename)
+		}
+		if got, _ := store.GetByID(falcon.ID); got.ImageFilename != nil {
+			t.Errorf("Expected another set's image to be left out, got %v", *got.ImageFilename)
+		}
+		if got, _ := store.GetBySetNumber("42115"); got == nil || got.ImageFilename != nil {
+			t.Errorf("Expected the new set without an image, got %+v", got)
+		}
+	})
+}
+
+func TestImportService_ImportJSON_SetImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seeded := seedTestSets(t, store)
+		importService := services.NewImportService(store, services.NewCSVService())
+
+		house, falcon, alone := seeded[0], seeded[1], seeded[2]
+		front, back := house.ID+"_10273.jpg", house.ID+"_10273_0a1b2c3d.jpg"
+		data := `{"schemaVersion": 2, "sets": [
+			{"id": "` + house.ID + `", "setNumber": "10273", "title": "Haunted House", "imageFilename": "` + front + `"},
+			{"id": "` + falcon.ID + `", "setNumber": "75192", "title": "Millennium Falcon"},
+			{"id": "` + alone.ID + `", "setNumber": "21330", "title": "Home Alone", "imageFilename": "` + alone.ID + `_21330.jpg"}
+		], "images": [
+			{"id": "a", "setId": "` + house.ID + `", "filename": "` + back + `", "caption": "Box back", "kind": "box_back", "sortOrder": 0, "isPrimary": false},
+			{"id": "b", "setId": "` + house.ID + `", "filename": "` + front + `", "kind": "poster", "sortOrder": 1, "isPrimary": true},
+			{"id": "c", "setId": "` + falcon.ID + `", "filename": "` + falcon.ID + `_75192.jpg", "sortOrder": 0, "isPrimary": true},
+			{"id": "d", "setId": "` + alone.ID + `", "filename": "` + house.ID + `_10273.jpg", "sortOrder": 1, "isPrimary": false}
+		]}`
+
+		result, err := importService.ImportJSON(strings.NewReader(data), services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import JSON: %v", err)
+		}
+		if result.Updated != 3 || result.Failed != 0 {
+			t.Fatalf("Expected 3 sets updated, got %+v", result)
+		}
+		for i, want := range []string{"unknown kind", "no primary image", "isn't named after this set"} {
+			if warnings := result.Rows[i].Warnings; len(warnings) != 1 || !strings.Contains(warnings[0].Message, want) {
+				t.Errorf("Expected a warning about %s for %s, got %+v", want, result.Rows[i].SetNumber, warnings)
+			}
+		}
+
+		images := checkImages(t, store, house.ID, back+","+front+"*", front)
+		if stringValue(images[0].Caption) != "Box back" || stringValue(images[0].Kind) != "box_back" || images[1].Kind != nil {
+			t.Errorf("Expected the back image labelled and the unknown kind cleared, got %+v, %+v", images[0], images[1])
+		}
+		checkImages(t, store, falcon.ID, "", "")
+		checkImages(t, store, alone.ID, alone.ID+"_21330.jpg*", alone.ID+"_21330.jpg")
+	})
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
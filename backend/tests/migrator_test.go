@@ -0,0 +1,245 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/migrations"
+)
+
+func TestLoadMigrations_PairsAndOrders(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_notes.up.sql":      {Data: []byte("ALTER TABLE t ADD COLUMN notes TEXT;")},
+		"002_add_notes.down.sql":    {Data: []byte("ALTER TABLE t DROP COLUMN notes;")},
+		"001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (id INT);")},
+		"001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"README.md":                 {Data: []byte("not a migration")},
+	}
+
+	migrations, err := db.LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(migrations) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "create_table" {
+		t.Errorf("Expected first migration 001_create_table, got %03d_%s", migrations[0].Version, migrations[0].Name)
+	}
+	if migrations[1].Version != 2 {
+		t.Errorf("Expected second migration version 2, got %d", migrations[1].Version)
+	}
+	if migrations[0].Down != "DROP TABLE t;" {
+		t.Errorf("Expected down script to be paired, got %q", migrations[0].Down)
+	}
+	if migrations[0].Checksum == "" || migrations[0].Checksum == migrations[1].Checksum {
+		t.Error("Expected distinct checksums for each migration")
+	}
+}
+
+func TestLoadMigrations_Errors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing up script": {
+			"001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		},
+		"unversioned file": {
+			"create_table.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+		},
+		"duplicate version": {
+			"001_create_table.up.sql": {Data: []byte("CREATE TABLE t (id INT);")},
+			"001_create_other.up.sql": {Data: []byte("CREATE TABLE o (id INT);")},
+		},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := db.LoadMigrations(fsys); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadMigrations_EmbeddedMigrations(t *testing.T) {
+	versions := map[string][]int64{}
+
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		fsys, err := migrations.ForDialect(dialect)
+		if err != nil {
+			t.Fatalf("Failed to find %s migrations: %v", dialect, err)
+		}
+
+		loaded, err := db.LoadMigrations(fsys)
+		if err != nil {
+			t.Fatalf("Failed to load embedded %s migrations: %v", dialect, err)
+		}
+
+		for _, migration := range loaded {
+			if migration.Down == "" {
+				t.Errorf("%s migration %03d_%s has no down script", dialect, migration.Version, migration.Name)
+			}
+			versions[dialect] = append(versions[dialect], migration.Version)
+		}
+	}
+
+	// Every dialect must offer the same schema versions
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		if fmt.Sprint(versions["mysql"]) != fmt.Sprint(versions[dialect]) {
+			t.Errorf("Dialect migrations differ: mysql %v, %s %v", versions["mysql"], dialect, versions[dialect])
+		}
+	}
+}
+
+func TestMigrator_SQLiteUpDownStatus(t *testing.T) {
+	database := openTestSQLite(t, false)
+	fsys, _ := migrations.ForDialect("sqlite")
+	migrator, err := db.NewMigrator(database, fsys)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Failed to migrate up: %v", err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("Expected 3 migrations applied, got %d", len(applied))
+	}
+
+	// Applying again is a no-op
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no migrations on second run, got %d, %v", len(applied), err)
+	}
+
+	rolledBack, err := migrator.Down(ctx, 1)
+	if err != nil || len(rolledBack) != 1 || rolledBack[0].Version != 3 {
+		t.Fatalf("Expected to roll back version 3, got %v, %v", rolledBack, err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if len(statuses) != 3 || !statuses[1].Applied || statuses[2].Applied {
+		t.Errorf("Expected 002 applied and 003 pending, got %+v", statuses)
+	}
+
+	// An edited migration is refused once it has been applied
+	modified := fstest.MapFS{}
+	entries, _ := fs.ReadDir(fsys, ".")
+	for _, entry := range entries {
+		data, _ := fs.ReadFile(fsys, entry.Name())
+		modified[entry.Name()] = &fstest.MapFile{Data: data}
+	}
+	modified["001_create_lego_sets_table.up.sql"] = &fstest.MapFile{Data: []byte("-- edited\nSELECT 1;")}
+	edited, err := db.NewMigrator(database, modified)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	if _, err := edited.Up(ctx); !errors.Is(err, db.ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- Create table
+CREATE TABLE t (
+    id INT, -- identifier; never null
+    name VARCHAR(10) DEFAULT 'a;b'
+);
+
+/* seed; data */
+INSERT INTO t (id, name) VALUES (1, "x;y");
+-- trailing comment`
+
+	statements := db.SplitStatements(script)
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d: %q", len(statements), statements)
+	}
+	if statements[1] != `/* seed; data */
+INSERT INTO t (id, name) VALUES (1, "x;y")` {
+		t.Errorf("Unexpected second statement: %q", statements[1])
+	}
+}
+
+// openTestSQLite opens a fresh SQLite database in a temporary directory,
+// optionally with all migrations applied
+func openTestSQLite(t *testing.T, migrate bool) *db.Database {
+	t.Helper()
+
+	database, err := db.Open(db.NewSQLiteDialect(filepath.Join(t.TempDir(), "catalog.db")))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	if migrate {
+		fsys, err := migrations.ForDialect("sqlite")
+		if err != nil {
+			t.Fatalf("Failed to find migrations: %v", err)
+		}
+		migrator, err := db.NewMigrator(database, fsys)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+	}
+
+	return database
+}
+
+func TestSplitStatements_DollarQuoted(t *testing.T) {
+	script := `CREATE FUNCTION touch() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER t_touch BEFORE UPDATE ON t FOR EACH ROW EXECUTE FUNCTION touch();`
+
+	statements := db.SplitStatements(script)
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 statements, got %d: %q", len(statements), statements)
+	}
+	if !strings.HasSuffix(statements[0], "$$ LANGUAGE plpgsql") {
+		t.Errorf("Expected function body to stay intact, got %q", statements[0])
+	}
+}
+
+func TestDialect_Rebind(t *testing.T) {
+	t.Setenv("DB_DRIVER", "postgres")
+	postgres, err := db.DialectFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to select postgres dialect: %v", err)
+	}
+
+	got := postgres.Rebind("SELECT * FROM t WHERE a = ? AND b = '?' AND c IN (?, ?)")
+	want := "SELECT * FROM t WHERE a = $1 AND b = '?' AND c IN ($2, $3)"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	t.Setenv("DB_DRIVER", "mysql")
+	mysql, _ := db.DialectFromEnv()
+	if mysql.Rebind("a = ?") != "a = ?" {
+		t.Error("Expected MySQL placeholders to be left alone")
+	}
+
+	t.Setenv("DB_DRIVER", "oracle")
+	if _, err := db.DialectFromEnv(); err == nil {
+		t.Error("Expected an error for an unsupported driver")
+	}
+}
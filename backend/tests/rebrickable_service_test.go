@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+const rebrickableSetsDump = `set_num,name,year,theme_id,num_parts,img_url
+10276-1,Colosseum,2020,721,9036,https://cdn.rebrickable.com/media/sets/10276-1.jpg
+75192-1,Millennium Falcon,2017,171,7541,https://cdn.rebrickable.com/media/sets/75192-1.jpg
+21330-1,Home Alone,2021,576,3955,https://cdn.rebrickable.com/media/sets/21330-1.jpg
+6020-2,Magic Flyer,1996,186,67,
+`
+
+const rebrickableThemesDump = `id,name,parent_id
+158,Star Wars,
+171,Ultimate Collector Series,158
+576,LEGO Ideas and CUUSOO,
+721,Icons,
+`
+
+func loadTestRebrickableCatalog(t *testing.T) *services.RebrickableCatalog {
+	t.Helper()
+
+	catalog, err := services.NewRebrickableService().LoadCatalog(strings.NewReader(rebrickableSetsDump), strings.NewReader(rebrickableThemesDump))
+	if err != nil {
+		t.Fatalf("Failed to load catalog: %v", err)
+	}
+	return catalog
+}
+
+func TestRebrickableService_LoadCatalog(t *testing.T) {
+	catalog := loadTestRebrickableCatalog(t)
+
+	if catalog.Len() != 4 {
+		t.Errorf("Expected 4 sets, got %d", catalog.Len())
+	}
+
+	set := catalog.Lookup("75192")
+	if set == nil || set.Name != "Millennium Falcon" || set.Year != 2017 || set.NumParts != 7541 {
+		t.Fatalf("Expected 75192 to match 75192-1, got %+v", set)
+	}
+	if theme := catalog.Theme(set.ThemeID); theme != "Star Wars" {
+		t.Errorf("Expected the top-level theme Star Wars, got %q", theme)
+	}
+	if catalog.Lookup("6020") != nil || catalog.Lookup("6020-2") == nil {
+		t.Error("Expected only 6020-2 to match a second version")
+	}
+
+	if _, err := services.NewRebrickableService().LoadCatalog(strings.NewReader("id,title\n1,x\n"), nil); err == nil {
+		t.Error("Expected error for a file without set_num")
+	}
+}
+
+func TestRebrickableService_ParseSetList(t *testing.T) {
+	catalog := loadTestRebrickableCatalog(t)
+	setList := `Set Number,Quantity,Includes Spares,Inventory ver
+10276-1,1,True,1
+75192-1,2,True,1
+10276-1,1,True,1
+6020-2,many,True,1
+99999-1,1,True,1
+`
+
+	header, rows, err := services.NewRebrickableService().ParseSetList(strings.NewReader(setList), catalog)
+	if err != nil {
+		t.Fatalf("Failed to parse set list: %v", err)
+	}
+	if !header.Has("title") || !header.Has("quantity_owned") {
+		t.Errorf("Expected title and quantity columns, got %v", header.Fields)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 rows after combining duplicates, got %d", len(rows))
+	}
+
+	colosseum := rows[0].Set
+	if colosseum.SetNumber != "10276" || colosseum.QuantityOwned != 2 || !colosseum.Owned {
+		t.Errorf("Expected 10276 with quantity 2, got %+v", colosseum)
+	}
+	if colosseum.Title != "Colosseum" || stringValue(colosseum.Series) != "Icons" || colosseum.NumParts != 9036 ||
+		colosseum.ReleaseYear == nil || *colosseum.ReleaseYear != 2020 {
+		t.Errorf("Expected metadata from the dump, got %+v", colosseum)
+	}
+	if stringValue(colosseum.RebrickableURL) != "https://rebrickable.com/sets/10276-1/" {
+		t.Errorf("Expected Rebrickable URL, got %q", stringValue(colosseum.RebrickableURL))
+	}
+
+	if rows[2].Set.SetNumber != "6020-2" || len(rows[2].Warnings) != 2 {
+		t.Errorf("Expected 6020-2 to keep its version and warn about the quantity, got %+v", rows[2])
+	}
+	if rows[3].Set.Title != "" || len(rows[3].Warnings) != 1 || rows[3].Warnings[0].Field != "title" {
+		t.Errorf("Expected a warning for a set missing from the dump, got %+v", rows[3])
+	}
+}
+
+func TestImportService_ImportRebrickable(t *testing.T) {
+	catalog := loadTestRebrickableCatalog(t)
+	setList := "set_num,quantity\n75192-1,1\n21330-1,3\n99999-1,1\n"
+
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		notes := "Bought at the LEGO store"
+		falcon := newTestLegoSet("75192", "UCS Falcon", "", true, 1, 0, 8, 849.99, 2017)
+		falcon.Series = nil
+		falcon.Notes = &notes
+		if err := store.Create(falcon); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		importService := services.NewImportService(store, services.NewCSVService())
+		result, err := importService.ImportRebrickable(strings.NewReader(setList), catalog, services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if result.Imported != 1 || result.Updated != 1 || result.Failed != 1 || result.Strategy != models.ImportStrategyOverwrite {
+			t.Fatalf("Expected 1 created, 1 updated and 1 failed, got %+v", result)
+		}
+
+		updated, _ := store.GetBySetNumber("75192")
+		if updated.Title != "Millennium Falcon" || stringValue(updated.Series) != "Star Wars" || updated.NumParts != 7541 {
+			t.Errorf("Expected metadata from Rebrickable, got %+v", updated)
+		}
+		if stringValue(updated.Notes) != notes || updated.NumMinifigs != 8 {
+			t.Errorf("Expected fields Rebrickable doesn't supply to be kept, got %+v", updated)
+		}
+
+		created, _ := store.GetBySetNumber("21330")
+		if created == nil || created.Title != "Home Alone" || created.QuantityOwned != 3 {
+			t.Errorf("Expected 21330 created from the dump, got %+v", created)
+		}
+	})
+}
+
+func TestImportService_EnrichFromRebrickable(t *testing.T) {
+	catalog := loadTestRebrickableCatalog(t)
+
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		colosseum := newTestLegoSet("10276", "My Colosseum", "", true, 1, 0, 0, 549.99, 2020)
+		colosseum.Series = nil
+		colosseum.ReleaseYear = nil
+		if err := store.Create(colosseum); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+		custom := newTestLegoSet("MOC-1", "Custom build", "MOCs", true, 1, 120, 0, 0, 2024)
+		if err := store.Create(custom); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		importService := services.NewImportService(store, services.NewCSVService())
+		result, err := importService.EnrichFromRebrickable(catalog, services.ImportOptions{})
+		if err != nil {
+			t.Fatalf("Failed to enrich: %v", err)
+		}
+		if result.Updated != 1 || result.Skipped != 1 || result.Strategy != models.ImportStrategySkip {
+			t.Fatalf("Expected 1 updated and 1 skipped, got %+v", result)
+		}
+
+		got, _ := store.GetBySetNumber("10276")
+		if got.Title != "My Colosseum" {
+			t.Errorf("Expected the title to be kept, got %q", got.Title)
+		}
+		if stringValue(got.Series) != "Icons" || got.NumParts != 9036 || got.ReleaseYear == nil || *got.ReleaseYear != 2020 {
+			t.Errorf("Expected empty fields filled from the dump, got %+v", got)
+		}
+
+		result, err = importService.EnrichFromRebrickable(catalog, services.ImportOptions{Strategy: models.ImportStrategyOverwrite})
+		if err != nil {
+			t.Fatalf("Failed to enrich: %v", err)
+		}
+		if got, _ := store.GetBySetNumber("10276"); got.Title != "Colosseum" {
+			t.Errorf("Expected overwrite to replace the title, got %q", got.Title)
+		}
+	})
+}
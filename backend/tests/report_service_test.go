@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lego-catalog/internal/api/handlers"
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+)
+
+// writeTestPNG stores a small PNG in dir
+func writeTestPNG(t *testing.T, dir, name string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), testPNG(t, 400, 300), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+}
+
+// testPNG encodes a gradient image of the given size
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// pdfPageCount counts the page objects in an uncompressed PDF structure
+func pdfPageCount(pdf []byte) int {
+	return bytes.Count(pdf, []byte("/Type /Page\n")) + bytes.Count(pdf, []byte("/Type /Page "))
+}
+
+func TestReportService_GenerateReport(t *testing.T) {
+	uploadDir := t.TempDir()
+	writeTestPNG(t, uploadDir, "colosseum.png")
+	if err := os.WriteFile(filepath.Join(uploadDir, "broken.jpg"), []byte("not an image"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	colosseum := newTestLegoSet("10276", "Colosseum", "Icons", true, 2, 9036, 0, 549.99, 2020)
+	image := "colosseum.png"
+	colosseum.ImageFilename = &image
+	broken := "broken.jpg"
+	falcon := newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017)
+	falcon.ImageFilename = &broken
+	flyer := newTestLegoSet("6020", "Magic Flyer", "Castle", false, 0, 67, 1, 40, 1996)
+	sets := []*models.LegoSet{colosseum, falcon, flyer}
+	stats := &models.Statistics{TotalSets: 3, OwnedSets: 2, TotalValue: 1949.97, MostExpensiveSet: falcon}
+
+	reportService := services.NewReportService(services.NewImageService(uploadDir))
+	opts := services.ReportOptions{
+		OwnedOnly:     true,
+		GroupBySeries: true,
+		PreparedBy:    "Jordan Brick",
+		Date:          time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	if err := reportService.GenerateReport(sets, stats, opts, &buf); err != nil {
+		t.Fatalf("Failed to generate report: %v", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("Expected a PDF, got %q", pdf[:min(len(pdf), 16)])
+	}
+	// A summary page and one page of sets
+	if pages := pdfPageCount(pdf); pages != 2 {
+		t.Errorf("Expected 2 pages, got %d", pages)
+	}
+	// The readable image is embedded once; the broken one is left out
+	if images := bytes.Count(pdf, []byte("/Subtype /Image")); images != 1 {
+		t.Errorf("Expected 1 embedded image, got %d", images)
+	}
+
+	// Enough sets to run onto more pages
+	var many []*models.LegoSet
+	for i := 0; i < 60; i++ {
+		set := newTestLegoSet(fmt.Sprintf("%05d", i), "Set", "Series", true, 1, 100, 1, 10, 2000)
+		set.ImageFilename = &image
+		many = append(many, set)
+	}
+	buf.Reset()
+	if err := reportService.GenerateReport(many, stats, services.ReportOptions{}, &buf); err != nil {
+		t.Fatalf("Failed to generate report: %v", err)
+	}
+	if pages := pdfPageCount(buf.Bytes()); pages < 4 {
+		t.Errorf("Expected the listing to run over several pages, got %d pages", pages)
+	}
+	if images := bytes.Count(buf.Bytes(), []byte("/Subtype /Image")); images != 1 {
+		t.Errorf("Expected a shared image to be embedded once, got %d", images)
+	}
+}
+
+func TestReportHandler_InsuranceReport(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	handler := handlers.NewReportHandler(store, services.NewReportService(services.NewImageService(t.TempDir())))
+
+	rec := serve(handler.InsuranceReport, httptest.NewRequest("GET", "/api/reports/insurance?groupBy=series&preparedBy=Jordan&date=2024-06-01", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("Expected a PDF, got %s", rec.Header().Get("Content-Type"))
+	}
+
+	for _, target := range []string{
+		"/api/reports/insurance?date=June",
+		"/api/reports/insurance?groupBy=year",
+		"/api/reports/insurance?ownedOnly=maybe",
+	} {
+		if rec := serve(handler.InsuranceReport, httptest.NewRequest("GET", target, nil), nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", target, rec.Code)
+		}
+	}
+}
@@ -1,85 +1,484 @@
 package tests
 
 import (
+	"context"
+	"errors"
+	"os"
 	"testing"
 	"time"
 
 	"lego-catalog/internal/db"
 	"lego-catalog/internal/models"
+	"lego-catalog/migrations"
 )
 
+// testStores returns a fresh instance of every LegoSetStore implementation
+// that can run without external services. Setting TEST_DB_DRIVER to mysql or
+// postgres also runs the tests against the server configured by the usual
+// DB_* variables; its lego_sets table is emptied first.
+func testStores(t *testing.T) map[string]db.LegoSetStore {
+	t.Helper()
+	stores := map[string]db.LegoSetStore{
+		"memory": db.NewMemoryLegoSetRepository(),
+		"sqlite": db.NewLegoSetRepository(openTestSQLite(t, true)),
+	}
+
+	if driver := os.Getenv("TEST_DB_DRIVER"); driver != "" {
+		stores[driver] = db.NewLegoSetRepository(openTestServerDatabase(t, driver))
+	}
+
+	return stores
+}
+
+// openTestServerDatabase connects to an external test database, applies
+// migrations and removes any existing sets
+func openTestServerDatabase(t *testing.T, driver string) *db.Database {
+	t.Helper()
+	t.Setenv("DB_DRIVER", driver)
+
+	if err := db.InitDatabase(); err != nil {
+		t.Fatalf("Failed to initialize %s test database: %v", driver, err)
+	}
+	database, err := db.NewDatabase()
+	if err != nil {
+		t.Fatalf("Failed to connect to %s test database: %v", driver, err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	fsys, err := migrations.ForDialect(database.Dialect.Name())
+	if err != nil {
+		t.Fatalf("Failed to find migrations: %v", err)
+	}
+	migrator, err := db.NewMigrator(database, fsys)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate %s test database: %v", driver, err)
+	}
+	if _, err := database.Exec("DELETE FROM lego_sets"); err != nil {
+		t.Fatalf("Failed to clear %s test database: %v", driver, err)
+	}
+
+	return database
+}
+
+// forEachStore runs fn as a subtest against every store implementation
+func forEachStore(t *testing.T, fn func(t *testing.T, store db.LegoSetStore)) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			fn(t, store)
+		})
+	}
+}
+
 // TestLegoSetRepository_Create tests creating a new Lego set
 func TestLegoSetRepository_Create(t *testing.T) {
-	// This is a placeholder test that demonstrates the test structure
-	// In a real implementation, you would use a test database
-
-	t.Run("Create valid Lego set", func(t *testing.T) {
-		// Skip if no test database is configured
-		t.Skip("Skipping database test - requires test database setup")
-
-		// Example test structure:
-		// database, err := db.NewDatabase()
-		// if err != nil {
-		//     t.Fatalf("Failed to connect to test database: %v", err)
-		// }
-		// defer database.Close()
-
-		// repo := db.NewLegoSetRepository(database)
-
-		// set := &models.LegoSet{
-		//     SetNumber: "10276",
-		//     Title:     "Colosseum",
-		//     Owned:     true,
-		//     QuantityOwned: 1,
-		//     NumParts:  9036,
-		// }
-
-		// err = repo.Create(set)
-		// if err != nil {
-		//     t.Errorf("Failed to create set: %v", err)
-		// }
-
-		// if set.ID == "" {
-		//     t.Error("Expected ID to be set after creation")
-		// }
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		set := createTestLegoSet()
+		if err := store.Create(set); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		if set.ID == "" {
+			t.Error("Expected ID to be set after creation")
+		}
+		if set.CreatedAt.IsZero() {
+			t.Error("Expected CreatedAt to be set after creation")
+		}
+
+		duplicate := createTestLegoSet()
+		if err := store.Create(duplicate); !errors.Is(err, db.ErrDuplicateSetNumber) {
+			t.Errorf("Expected ErrDuplicateSetNumber, got %v", err)
+		}
 	})
 }
 
 // TestLegoSetRepository_GetByID tests retrieving a set by ID
 func TestLegoSetRepository_GetByID(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		set := createTestLegoSet()
+		if err := store.Create(set); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+
+		found, err := store.GetByID(set.ID)
+		if err != nil {
+			t.Fatalf("Failed to get set: %v", err)
+		}
+		if found == nil || found.SetNumber != "10276" || found.Title != "Colosseum" {
+			t.Fatalf("Expected to find set 10276, got %+v", found)
+		}
+		if found.Series == nil || *found.Series != "Test Series" {
+			t.Error("Expected optional fields to be stored")
+		}
+
+		missing, err := store.GetByID("does-not-exist")
+		if err != nil || missing != nil {
+			t.Errorf("Expected nil, nil for a missing set, got %v, %v", missing, err)
+		}
+
+		bySetNumber, err := store.GetBySetNumber("10276")
+		if err != nil || bySetNumber == nil || bySetNumber.ID != set.ID {
+			t.Errorf("Expected to find set by set number, got %v, %v", bySetNumber, err)
+		}
+	})
 }
 
 // TestLegoSetRepository_GetAll tests retrieving all sets
 func TestLegoSetRepository_GetAll(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		all, err := store.GetAll(nil, "", "")
+		if err != nil {
+			t.Fatalf("Failed to get sets: %v", err)
+		}
+		if len(all) != 3 {
+			t.Fatalf("Expected 3 sets, got %d", len(all))
+		}
+		if all[0].SetNumber != "21330" {
+			t.Errorf("Expected newest set first by default, got %s", all[0].SetNumber)
+		}
+
+		owned, err := store.GetAll(map[string]interface{}{"owned": true}, "num_parts", "DESC")
+		if err != nil {
+			t.Fatalf("Failed to filter sets: %v", err)
+		}
+		if len(owned) != 2 || owned[0].SetNumber != "75192" || owned[1].SetNumber != "21330" {
+			t.Errorf("Expected owned sets ordered by parts, got %v", setNumbers(owned))
+		}
+
+		series, err := store.GetAll(map[string]interface{}{"series": "Ideas"}, "title", "ASC")
+		if err != nil {
+			t.Fatalf("Failed to filter by series: %v", err)
+		}
+		if len(series) != 1 || series[0].SetNumber != "21330" {
+			t.Errorf("Expected only the Ideas set, got %v", setNumbers(series))
+		}
+
+		// Search combines with the other filters
+		searched, err := store.GetAll(map[string]interface{}{"search": "ho", "owned": true}, "title", "ASC")
+		if err != nil {
+			t.Fatalf("Failed to filter by search: %v", err)
+		}
+		if len(searched) != 1 || searched[0].SetNumber != "21330" {
+			t.Errorf("Expected only the owned match, got %v", setNumbers(searched))
+		}
+
+		// Unknown sort fields fall back to the default ordering
+		unsorted, err := store.GetAll(nil, "notes; DROP TABLE lego_sets", "ASC")
+		if err != nil {
+			t.Fatalf("Failed to get sets with invalid sort: %v", err)
+		}
+		if unsorted[0].SetNumber != "21330" {
+			t.Errorf("Expected default ordering for invalid sort field, got %v", setNumbers(unsorted))
+		}
+	})
+}
+
+// TestLegoSetRepository_EachSet tests streaming sets one at a time
+func TestLegoSetRepository_EachSet(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		var visited []*models.LegoSet
+		err := store.EachSet(context.Background(), map[string]interface{}{"owned": true}, "num_parts", "DESC", func(set *models.LegoSet) error {
+			visited = append(visited, set)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to stream sets: %v", err)
+		}
+		if got := setNumbers(visited); len(got) != 2 || got[0] != "75192" || got[1] != "21330" {
+			t.Errorf("Expected owned sets by parts, got %v", got)
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = store.EachSet(context.Background(), nil, "", "", func(*models.LegoSet) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) || calls != 1 {
+			t.Errorf("Expected to stop at the first error, got %v after %d calls", err, calls)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = store.EachSet(ctx, nil, "", "", func(*models.LegoSet) error { return nil })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancelled context to stop the stream, got %v", err)
+		}
+	})
 }
 
 // TestLegoSetRepository_Search tests searching for sets
 func TestLegoSetRepository_Search(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		results, err := store.Search("falcon")
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 1 || results[0].SetNumber != "75192" {
+			t.Errorf("Expected case-insensitive title match, got %v", setNumbers(results))
+		}
+
+		results, err = store.Search("HO")
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 2 || results[0].Title != "Haunted House" || results[1].Title != "Home Alone" {
+			t.Errorf("Expected matches ordered by title, got %v", setNumbers(results))
+		}
+	})
 }
 
 // TestLegoSetRepository_Update tests updating a set
 func TestLegoSetRepository_Update(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		sets := seedTestSets(t, store)
+		target := sets[0]
+
+		err := store.Update(target.ID, map[string]interface{}{
+			"title":          "Haunted House (Retired)",
+			"quantity_owned": 3,
+			"owned":          true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to update set: %v", err)
+		}
+
+		updated, err := store.GetByID(target.ID)
+		if err != nil {
+			t.Fatalf("Failed to get updated set: %v", err)
+		}
+		if updated.Title != "Haunted House (Retired)" || updated.QuantityOwned != 3 || !updated.Owned {
+			t.Errorf("Expected updates to be applied, got %+v", updated)
+		}
+		if !updated.UpdatedAt.After(target.UpdatedAt) && !updated.UpdatedAt.Equal(target.UpdatedAt) {
+			t.Error("Expected UpdatedAt to move forward")
+		}
+
+		err = store.Update(target.ID, map[string]interface{}{"set_number": sets[1].SetNumber})
+		if !errors.Is(err, db.ErrDuplicateSetNumber) {
+			t.Errorf("Expected ErrDuplicateSetNumber, got %v", err)
+		}
+
+		if err := store.Update("does-not-exist", map[string]interface{}{"title": "x"}); err == nil {
+			t.Error("Expected an error updating a missing set")
+		}
+	})
 }
 
 // TestLegoSetRepository_Delete tests deleting a set
 func TestLegoSetRepository_Delete(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		sets := seedTestSets(t, store)
+
+		if err := store.Delete(sets[0].ID); err != nil {
+			t.Fatalf("Failed to delete set: %v", err)
+		}
+
+		deleted, err := store.GetByID(sets[0].ID)
+		if err != nil || deleted != nil {
+			t.Errorf("Expected deleted set to be gone, got %v, %v", deleted, err)
+		}
+
+		if err := store.Delete(sets[0].ID); err == nil {
+			t.Error("Expected an error deleting a missing set")
+		}
+	})
 }
 
 // TestLegoSetRepository_GetStatistics tests getting collection statistics
 func TestLegoSetRepository_GetStatistics(t *testing.T) {
-	t.Skip("Skipping database test - requires test database setup")
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		stats, err := store.GetStatistics()
+		if err != nil {
+			t.Fatalf("Failed to get statistics: %v", err)
+		}
+
+		if stats.TotalSets != 3 || stats.OwnedSets != 2 {
+			t.Errorf("Expected 3 total and 2 owned sets, got %d and %d", stats.TotalSets, stats.OwnedSets)
+		}
+		// Only owned sets count, multiplied by quantity
+		if stats.TotalPieces != 7541+3955*2 {
+			t.Errorf("Expected %d pieces, got %d", 7541+3955*2, stats.TotalPieces)
+		}
+		if stats.TotalMinifigs != 8+6*2 {
+			t.Errorf("Expected %d minifigs, got %d", 8+6*2, stats.TotalMinifigs)
+		}
+		if diff := stats.TotalValue - (849.99 + 249.99*2); diff > 0.001 || diff < -0.001 {
+			t.Errorf("Expected total value %.2f, got %.2f", 849.99+249.99*2, stats.TotalValue)
+		}
+		if stats.MostExpensiveSet == nil || stats.MostExpensiveSet.SetNumber != "75192" {
+			t.Error("Expected 75192 to be the most expensive owned set")
+		}
+		if stats.OldestSet == nil || stats.OldestSet.SetNumber != "75192" {
+			t.Error("Expected 75192 to be the oldest owned set")
+		}
+		if stats.NewestSet == nil || stats.NewestSet.SetNumber != "21330" {
+			t.Error("Expected 21330 to be the newest owned set")
+		}
+
+		series, err := store.GetAllSeries()
+		if err != nil {
+			t.Fatalf("Failed to get series: %v", err)
+		}
+		if len(series) != 3 || series[0] != "Fairground Collection" || series[2] != "Star Wars" {
+			t.Errorf("Expected sorted distinct series, got %v", series)
+		}
+	})
 }
 
-// Helper functions for tests
-func createTestDatabase(t *testing.T) *db.Database {
+// TestLegoSetRepository_CreateMany tests batch inserts and lookups
+func TestLegoSetRepository_CreateMany(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		sets := []*models.LegoSet{
+			newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020),
+			newTestLegoSet("42115", "Lamborghini Sian", "Technic", false, 0, 3696, 0, 379.99, 2020),
+		}
+		if err := store.CreateMany(sets); err != nil {
+			t.Fatalf("Failed to create sets: %v", err)
+		}
+		if sets[0].ID == "" || sets[1].ID == "" {
+			t.Error("Expected IDs to be assigned")
+		}
+
+		found, err := store.GetBySetNumbers([]string{"10276", "42115", "75192", "99999"})
+		if err != nil {
+			t.Fatalf("Failed to get sets: %v", err)
+		}
+		if len(found) != 3 || found["42115"] == nil || found["42115"].Title != "Lamborghini Sian" {
+			t.Errorf("Expected 3 sets keyed by set number, got %v", found)
+		}
+
+		// A duplicate anywhere in the batch inserts nothing
+		err = store.CreateMany([]*models.LegoSet{
+			newTestLegoSet("60000", "New Set", "City", false, 0, 100, 1, 9.99, 2024),
+			newTestLegoSet("21330", "Home Alone", "Ideas", true, 1, 3955, 6, 249.99, 2021),
+		})
+		if !errors.Is(err, db.ErrDuplicateSetNumber) {
+			t.Errorf("Expected ErrDuplicateSetNumber, got %v", err)
+		}
+		if set, _ := store.GetBySetNumber("60000"); set != nil {
+			t.Error("Expected failed batch to insert nothing")
+		}
+	})
+}
+
+// TestLegoSetRepository_RunInTx tests commit and rollback
+func TestLegoSetRepository_RunInTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		seedTestSets(t, store)
+
+		rollback := errors.New("rollback")
+		err := store.RunInTx(func(tx db.LegoSetStore) error {
+			if err := tx.Create(newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020)); err != nil {
+				return err
+			}
+			// Writes are visible inside the transaction
+			if set, err := tx.GetBySetNumber("10276"); err != nil || set == nil {
+				t.Errorf("Expected 10276 inside the transaction, got %v, %v", set, err)
+			}
+			return rollback
+		})
+		if err != rollback {
+			t.Fatalf("Expected the callback's error, got %v", err)
+		}
+		if set, _ := store.GetBySetNumber("10276"); set != nil {
+			t.Error("Expected rolled back create to be discarded")
+		}
+
+		err = store.RunInTx(func(tx db.LegoSetStore) error {
+			return tx.Create(newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020))
+		})
+		if err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+		if set, _ := store.GetBySetNumber("10276"); set == nil {
+			t.Error("Expected committed create to be kept")
+		}
+	})
+}
+
+// TestMemoryLegoSetRepository_RunInTx_ConcurrentWrite tests that a write
+// made while a transaction runs survives the commit
+func TestMemoryLegoSetRepository_RunInTx_ConcurrentWrite(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+
+	done := make(chan error, 1)
+	err := store.RunInTx(func(tx db.LegoSetStore) error {
+		go func() {
+			done <- store.Create(newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020))
+		}()
+		// Give the concurrent create time to run if it isn't blocked
+		time.Sleep(20 * time.Millisecond)
+		return tx.Create(newTestLegoSet("42115", "Lamborghini Sián", "Technic", false, 0, 3696, 0, 379.99, 2020))
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to create set concurrently: %v", err)
+	}
+
+	for _, setNumber := range []string{"10273", "10276", "42115"} {
+		if set, _ := store.GetBySetNumber(setNumber); set == nil {
+			t.Errorf("Expected set %s to be kept", setNumber)
+		}
+	}
+}
+
+// seedTestSets creates three sets in creation order
+func seedTestSets(t *testing.T, store db.LegoSetStore) []*models.LegoSet {
 	t.Helper()
-	// This would create a test database connection
-	return nil
+
+	sets := []*models.LegoSet{
+		newTestLegoSet("10273", "Haunted House", "Fairground Collection", false, 0, 3231, 0, 249.99, 2019),
+		newTestLegoSet("75192", "Millennium Falcon", "Star Wars", true, 1, 7541, 8, 849.99, 2017),
+		newTestLegoSet("21330", "Home Alone", "Ideas", true, 2, 3955, 6, 249.99, 2021),
+	}
+
+	for _, set := range sets {
+		if err := store.Create(set); err != nil {
+			t.Fatalf("Failed to seed set %s: %v", set.SetNumber, err)
+		}
+		// Keep created_at distinct for stores with coarse timestamps
+		time.Sleep(time.Millisecond)
+	}
+
+	return sets
+}
+
+func setNumbers(sets []*models.LegoSet) []string {
+	numbers := make([]string, len(sets))
+	for i, set := range sets {
+		numbers[i] = set.SetNumber
+	}
+	return numbers
+}
+
+func newTestLegoSet(setNumber, title, series string, owned bool, quantity, parts, minifigs int, value float64, year int) *models.LegoSet {
+	return &models.LegoSet{
+		SetNumber:        setNumber,
+		Title:            title,
+		Series:           &series,
+		Owned:            owned,
+		QuantityOwned:    quantity,
+		NumParts:         parts,
+		NumMinifigs:      minifigs,
+		ApproximateValue: &value,
+		ReleaseYear:      &year,
+	}
 }
 
 func createTestLegoSet() *models.LegoSet {
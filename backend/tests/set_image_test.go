@@ -0,0 +1,408 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"lego-catalog/internal/api/handlers"
+	"lego-catalog/internal/db"
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+	"lego-catalog/migrations"
+)
+
+// imageFilenames lists the filenames of images in order, with a * after the
+// primary one
+func imageFilenames(images []*models.SetImage) string {
+	names := make([]string, len(images))
+	for i, image := range images {
+		names[i] = image.Filename
+		if image.IsPrimary {
+			names[i] += "*"
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// checkImages compares a set's images and image filename with what the
+// test expects
+func checkImages(t *testing.T, store db.LegoSetStore, setID, want, wantFilename string) []*models.SetImage {
+	t.Helper()
+
+	images, err := store.ListImages(setID)
+	if err != nil {
+		t.Fatalf("Failed to list images: %v", err)
+	}
+	if got := imageFilenames(images); got != want {
+		t.Errorf("Expected images %s, got %s", want, got)
+	}
+
+	set, _ := store.GetByID(setID)
+	if got := stringValue(set.ImageFilename); got != wantFilename {
+		t.Errorf("Expected image filename %q, got %q", wantFilename, got)
+	}
+	return images
+}
+
+func TestLegoSetRepository_SetImages(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		set := createTestLegoSet()
+		set.ImageFilename = stringPtr("front.png")
+		if err := store.Create(set); err != nil {
+			t.Fatalf("Failed to create set: %v", err)
+		}
+		images := checkImages(t, store, set.ID, "front.png*", "front.png")
+		front := images[0]
+
+		back := &models.SetImage{SetID: set.ID, Filename: "back.png", Caption: stringPtr("Box back"), Kind: stringPtr("box_back")}
+		built := &models.SetImage{SetID: set.ID, Filename: "built.png"}
+		for _, image := range []*models.SetImage{back, built} {
+			if err := store.AddImage(image); err != nil {
+				t.Fatalf("Failed to add image: %v", err)
+			}
+		}
+		if back.ID == "" || back.IsPrimary || back.SortOrder != 1 || built.SortOrder != 2 {
+			t.Errorf("Expected images added after the primary one, got %+v and %+v", back, built)
+		}
+		checkImages(t, store, set.ID, "front.png*,back.png,built.png", "front.png")
+
+		got, err := store.GetImage(set.ID, back.ID)
+		if err != nil || got == nil || stringValue(got.Caption) != "Box back" || stringValue(got.Kind) != "box_back" {
+			t.Errorf("Expected the box back image, got %+v, %v", got, err)
+		}
+		if got, _ := store.GetImage("other-set", back.ID); got != nil {
+			t.Error("Expected no image for another set")
+		}
+
+		// Reordering needs every image exactly once
+		if err := store.ReorderImages(set.ID, []string{built.ID, front.ID}); !errors.Is(err, db.ErrInvalidImageOrder) {
+			t.Errorf("Expected ErrInvalidImageOrder for a missing image, got %v", err)
+		}
+		if err := store.ReorderImages(set.ID, []string{built.ID, front.ID, front.ID}); !errors.Is(err, db.ErrInvalidImageOrder) {
+			t.Errorf("Expected ErrInvalidImageOrder for a repeated image, got %v", err)
+		}
+		if err := store.ReorderImages(set.ID, []string{built.ID, front.ID, back.ID}); err != nil {
+			t.Fatalf("Failed to reorder images: %v", err)
+		}
+		checkImages(t, store, set.ID, "built.png,front.png*,back.png", "front.png")
+
+		if err := store.SetPrimaryImage(set.ID, back.ID); err != nil {
+			t.Fatalf("Failed to set primary image: %v", err)
+		}
+		checkImages(t, store, set.ID, "built.png,front.png,back.png*", "back.png")
+
+		back.Caption = stringPtr("Back of the box")
+		back.Kind = nil
+		if err := store.UpdateImage(back); err != nil {
+			t.Fatalf("Failed to update image: %v", err)
+		}
+		if got, _ := store.GetImage(set.ID, back.ID); stringValue(got.Caption) != "Back of the box" || got.Kind != nil || !got.IsPrimary {
+			t.Errorf("Expected the new caption and no kind, got %+v", got)
+		}
+
+		// Deleting the primary image promotes the first remaining one
+		if err := store.DeleteImage(set.ID, back.ID); err != nil {
+			t.Fatalf("Failed to delete image: %v", err)
+		}
+		checkImages(t, store, set.ID, "built.png*,front.png", "built.png")
+
+		for _, err := range []error{
+			store.DeleteImage(set.ID, back.ID),
+			store.SetPrimaryImage(set.ID, back.ID),
+			store.UpdateImage(back),
+		} {
+			if !errors.Is(err, db.ErrImageNotFound) {
+				t.Errorf("Expected ErrImageNotFound, got %v", err)
+			}
+		}
+
+		// Setting image_filename replaces the primary image's file, and
+		// clearing it removes the primary image and promotes the next one
+		if err := store.Update(set.ID, map[string]interface{}{"image_filename": "rebuilt.png"}); err != nil {
+			t.Fatalf("Failed to update set: %v", err)
+		}
+		checkImages(t, store, set.ID, "rebuilt.png*,front.png", "rebuilt.png")
+		if err := store.Update(set.ID, map[string]interface{}{"image_filename": "front.png"}); err != nil {
+			t.Fatalf("Failed to update set: %v", err)
+		}
+		checkImages(t, store, set.ID, "rebuilt.png,front.png*", "front.png")
+		if err := store.Update(set.ID, map[string]interface{}{"image_filename": nil}); err != nil {
+			t.Fatalf("Failed to update set: %v", err)
+		}
+		checkImages(t, store, set.ID, "rebuilt.png*", "rebuilt.png")
+		if err := store.Update(set.ID, map[string]interface{}{"image_filename": ""}); err != nil {
+			t.Fatalf("Failed to update set: %v", err)
+		}
+		checkImages(t, store, set.ID, "", "")
+
+		minifig := &models.SetImage{SetID: set.ID, Filename: "minifig.png", Kind: stringPtr("minifig")}
+		if err := store.AddImage(minifig); err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
+		if !minifig.IsPrimary {
+			t.Error("Expected an image added to a set without a primary image to become primary")
+		}
+		checkImages(t, store, set.ID, "minifig.png*", "minifig.png")
+
+		if err := store.Delete(set.ID); err != nil {
+			t.Fatalf("Failed to delete set: %v", err)
+		}
+		if images, _ := store.ListImages(set.ID); len(images) != 0 {
+			t.Errorf("Expected the images to be deleted with the set, got %d", len(images))
+		}
+	})
+}
+
+func TestLegoSetRepository_SetImages_ImportPaths(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store db.LegoSetStore) {
+		withImage := newTestLegoSet("10276", "Colosseum", "Icons", true, 1, 9036, 0, 549.99, 2020)
+		withImage.ImageFilename = stringPtr("colosseum.png")
+		withoutImage := newTestLegoSet("10294", "Titanic", "Icons", true, 1, 9090, 0, 679.99, 2021)
+		if err := store.CreateMany([]*models.LegoSet{withImage, withoutImage}); err != nil {
+			t.Fatalf("Failed to create sets: %v", err)
+		}
+		checkImages(t, store, withImage.ID, "colosseum.png*", "colosseum.png")
+		checkImages(t, store, withoutImage.ID, "", "")
+
+		// Restoring a set replaces its primary image like an update
+		restored, _ := store.GetByID(withImage.ID)
+		restored.ImageFilename = stringPtr("restored.png")
+		if err := store.Restore(restored); err != nil {
+			t.Fatalf("Failed to restore set: %v", err)
+		}
+		checkImages(t, store, withImage.ID, "restored.png*", "restored.png")
+
+		// Restoring it without an image filename removes the primary image
+		// and promotes the next one, keeping the restored timestamps
+		for _, filename := range []string{"box.png", "built.png"} {
+			if err := store.AddImage(&models.SetImage{SetID: withImage.ID, Filename: filename}); err != nil {
+				t.Fatalf("Failed to add image: %v", err)
+			}
+		}
+		restored, _ = store.GetByID(withImage.ID)
+		restored.ImageFilename = nil
+		if err := store.Restore(restored); err != nil {
+			t.Fatalf("Failed to restore set: %v", err)
+		}
+		checkImages(t, store, withImage.ID, "box.png*,built.png", "box.png")
+		if got, _ := store.GetByID(withImage.ID); !got.UpdatedAt.Equal(restored.UpdatedAt) {
+			t.Errorf("Expected the restored updated_at %v, got %v", restored.UpdatedAt, got.UpdatedAt)
+		}
+
+		// An atomic import that rolls back leaves the images alone
+		err := store.RunInTx(func(tx db.LegoSetStore) error {
+			if err := tx.AddImage(&models.SetImage{SetID: withoutImage.ID, Filename: "titanic.png"}); err != nil {
+				return err
+			}
+			return errors.New("roll back")
+		})
+		if err == nil {
+			t.Fatal("Expected the transaction to fail")
+		}
+		checkImages(t, store, withoutImage.ID, "", "")
+	})
+}
+
+func TestMigration_SetImagesFromImageFilename(t *testing.T) {
+	database := openTestSQLite(t, false)
+	fsys, _ := migrations.ForDialect("sqlite")
+
+	// Create the schema as it was before set_images
+	before := fstest.MapFS{}
+	entries, _ := fs.ReadDir(fsys, ".")
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "001_") || strings.HasPrefix(entry.Name(), "002_") {
+			data, _ := fs.ReadFile(fsys, entry.Name())
+			before[entry.Name()] = &fstest.MapFile{Data: data}
+		}
+	}
+	for _, migrationFS := range []fs.FS{before, fsys} {
+		migrator, err := db.NewMigrator(database, migrationFS)
+		if err != nil {
+			t.Fatalf("Failed to create migrator: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		if migrationFS != fsys {
+			_, err = database.Exec(`INSERT INTO lego_sets (id, set_number, title, image_filename) VALUES
+				('a', '10276', 'Colosseum', 'a_10276.png'), ('b', '10294', 'Titanic', NULL), ('c', '21330', 'Home Alone', '')`)
+			if err != nil {
+				t.Fatalf("Failed to insert sets: %v", err)
+			}
+		}
+	}
+
+	store := db.NewLegoSetRepository(database)
+	images := checkImages(t, store, "a", "a_10276.png*", "a_10276.png")
+	if len(images[0].ID) != 36 || images[0].ID[14] != '4' {
+		t.Errorf("Expected a version 4 UUID, got %q", images[0].ID)
+	}
+	checkImages(t, store, "b", "", "")
+	checkImages(t, store, "c", "", "")
+}
+
+// newImageUploadRequest builds a multipart upload of an image with form
+// fields
+func newImageUploadRequest(t *testing.T, target, name string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, value := range fields {
+		writer.WriteField(field, value)
+	}
+	part, _ := writer.CreateFormFile("image", name)
+	part.Write(data)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestSetImageHandler(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+	handler := handlers.NewSetImageHandler(store, imageService)
+	set, _ := store.GetBySetNumber("10273")
+	target := "/api/lego-sets/" + set.ID + "/images"
+	vars := map[string]string{"id": set.ID}
+
+	add := func(fields map[string]string) *models.SetImage {
+		t.Helper()
+		rec := serve(handler.AddImage, newImageUploadRequest(t, target, "photo.png", testPNG(t, 40, 30), fields), vars)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var image models.SetImage
+		json.Unmarshal(rec.Body.Bytes(), &image)
+		return &image
+	}
+	list := func() []*models.SetImage {
+		t.Helper()
+		rec := serve(handler.ListImages, httptest.NewRequest("GET", target, nil), vars)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var images []*models.SetImage
+		json.Unmarshal(rec.Body.Bytes(), &images)
+		return images
+	}
+
+	front := add(map[string]string{"caption": "Box front", "kind": "box_front"})
+	back := add(map[string]string{"kind": "box_back"})
+	if !front.IsPrimary || back.IsPrimary || stringValue(front.Caption) != "Box front" || front.URLs == nil {
+		t.Errorf("Expected the first image to be primary with its caption and URLs, got %+v and %+v", front, back)
+	}
+	if front.Filename == back.Filename || !strings.HasPrefix(front.Filename, set.ID+"_10273_") {
+		t.Errorf("Expected a filename of its own for each image, got %s and %s", front.Filename, back.Filename)
+	}
+	if images := list(); len(images) != 2 || images[0].ID != front.ID || images[1].URLs.Thumbnail == "" {
+		t.Errorf("Expected both images with URLs, got %+v", images)
+	}
+
+	rec := serve(handler.AddImage, newImageUploadRequest(t, target, "photo.png", testPNG(t, 40, 30), map[string]string{"kind": "poster"}), vars)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown kind") {
+		t.Errorf("Expected status 400 for an unknown kind, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = serve(handler.AddImage, newImageUploadRequest(t, target, "photo.jpg", []byte("not an image"), nil), vars)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for a file that isn't an image, got %d", rec.Code)
+	}
+
+	imageVars := map[string]string{"id": set.ID, "imageId": back.ID}
+	rec = serve(handler.UpdateImage, httptest.NewRequest("PATCH", target+"/"+back.ID, strings.NewReader(`{"caption":"Box back"}`)), imageVars)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"caption":"Box back","kind":"box_back"`) {
+		t.Errorf("Expected the caption to be set and the kind kept, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(handler.ReorderImages, httptest.NewRequest("PUT", target+"/order", strings.NewReader(`{"imageIds":["`+back.ID+`"]}`)), vars)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an incomplete order, got %d", rec.Code)
+	}
+	order := `{"imageIds":["` + back.ID + `","` + front.ID + `"]}`
+	rec = serve(handler.ReorderImages, httptest.NewRequest("PUT", target+"/order", strings.NewReader(order)), vars)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(handler.SetPrimaryImage, httptest.NewRequest("POST", target+"/"+back.ID+"/primary", nil), imageVars)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if images := list(); imageFilenames(images) != back.Filename+"*,"+front.Filename {
+		t.Errorf("Expected the back image first and primary, got %s", imageFilenames(images))
+	}
+	if updated, _ := store.GetByID(set.ID); stringValue(updated.ImageFilename) != back.Filename {
+		t.Errorf("Expected the set's image to be the primary image, got %v", updated.ImageFilename)
+	}
+
+	rec = serve(handler.DeleteImage, httptest.NewRequest("DELETE", target+"/"+back.ID, nil), imageVars)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if imageService.ImageExists(back.Filename) {
+		t.Error("Expected the deleted image's file to be removed")
+	}
+	if images := list(); imageFilenames(images) != front.Filename+"*" {
+		t.Errorf("Expected the front image to become primary, got %s", imageFilenames(images))
+	}
+
+	rec = serve(handler.DeleteImage, httptest.NewRequest("DELETE", target+"/"+back.ID, nil), imageVars)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted image, got %d", rec.Code)
+	}
+	rec = serve(handler.ListImages, httptest.NewRequest("GET", "/api/lego-sets/missing/images", nil), map[string]string{"id": "missing"})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing set, got %d", rec.Code)
+	}
+}
+
+func TestLegoSetHandler_DeleteLegoSet_DeletesImages(t *testing.T) {
+	store := db.NewMemoryLegoSetRepository()
+	seedTestSets(t, store)
+	uploadDir := t.TempDir()
+	imageService := services.NewImageService(uploadDir)
+	legoSetHandler := handlers.NewLegoSetHandler(store, imageService, services.NewCSVService())
+	setImageHandler := handlers.NewSetImageHandler(store, imageService)
+
+	set, _ := store.GetBySetNumber("75192")
+	target := "/api/lego-sets/" + set.ID + "/images"
+	for i := 0; i < 2; i++ {
+		rec := serve(setImageHandler.AddImage, newImageUploadRequest(t, target, "falcon.png", testPNG(t, 40, 30), nil), map[string]string{"id": set.ID})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serve(legoSetHandler.DeleteLegoSet, httptest.NewRequest("DELETE", "/api/lego-sets/"+set.ID, nil), map[string]string{"id": set.ID})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var left []string
+	filepath.WalkDir(uploadDir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			left = append(left, path)
+		}
+		return nil
+	})
+	if len(left) != 0 {
+		t.Errorf("Expected every image file and variant to be deleted, got %v", left)
+	}
+}
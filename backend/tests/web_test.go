@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"lego-catalog/internal/web"
+)
+
+func newTestSPAHandler() http.Handler {
+	return web.NewSPAHandler(fstest.MapFS{
+		"index.html":        {Data: []byte("<html>app</html>")},
+		"assets/index.js":   {Data: []byte("console.log('app')")},
+		"assets/bricks.png": {Data: []byte("png")},
+	})
+}
+
+func TestSPAHandler_ServesStaticFiles(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestSPAHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/assets/index.js", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "console.log") {
+		t.Error("Expected asset contents")
+	}
+	if !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") {
+		t.Error("Expected fingerprinted assets to be cached")
+	}
+}
+
+func TestSPAHandler_FallsBackToIndex(t *testing.T) {
+	for _, path := range []string{"/", "/sets", "/sets/123/edit"} {
+		rec := httptest.NewRecorder()
+		newTestSPAHandler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", path, rec.Code)
+		}
+		if rec.Body.String() != "<html>app</html>" {
+			t.Errorf("%s: expected index.html, got %q", path, rec.Body.String())
+		}
+	}
+}
+
+func TestSPAHandler_NotFound(t *testing.T) {
+	for _, path := range []string{"/api/unknown", "/images/missing.jpg", "/assets/missing.js"} {
+		rec := httptest.NewRecorder()
+		newTestSPAHandler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"lego-catalog/internal/models"
+	"lego-catalog/internal/services"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestXLSXService_ExportToXLSX(t *testing.T) {
+	updated := time.Date(2024, 3, 15, 18, 30, 0, 0, time.UTC)
+	rebrickable := "https://rebrickable.com/sets/10276-1/"
+
+	colosseum := newTestLegoSet("10276", "Colosseum", "Icons", true, 2, 9036, 0, 549.99, 2020)
+	colosseum.ValueLastUpdated = &updated
+	colosseum.RebrickableURL = &rebrickable
+	castle := newTestLegoSet("00375", "King's Castle", "", true, 1, 767, 9, 120, 1978)
+	castle.Series = nil
+	flyer := newTestLegoSet("6020", "Magic Flyer", "Castle", false, 0, 67, 1, 40, 1996)
+	sets := []*models.LegoSet{colosseum, castle, flyer}
+
+	stats := &models.Statistics{TotalSets: 3, OwnedSets: 2, TotalValue: 1219.98, MostExpensiveSet: colosseum}
+
+	var buf bytes.Buffer
+	if err := services.NewXLSXService().ExportToXLSX(sets, stats, &buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer f.Close()
+
+	if want := []string{"Sets", "Statistics", "Series"}; !reflect.DeepEqual(f.GetSheetList(), want) {
+		t.Errorf("Expected sheets %v, got %v", want, f.GetSheetList())
+	}
+
+	cell := func(sheet, name string) string {
+		t.Helper()
+		value, err := f.GetCellValue(sheet, name)
+		if err != nil {
+			t.Fatalf("Failed to read %s!%s: %v", sheet, name, err)
+		}
+		return value
+	}
+
+	if got := cell("Sets", "A1"); got != "Set Number" {
+		t.Errorf("Expected header Set Number, got %q", got)
+	}
+	// Set numbers stay text so leading zeros survive
+	if got := cell("Sets", "A3"); got != "00375" {
+		t.Errorf("Expected set number 00375, got %q", got)
+	}
+	if kind, _ := f.GetCellType("Sets", "I2"); kind == excelize.CellTypeSharedString || kind == excelize.CellTypeInlineString {
+		t.Error("Expected number of parts as a number")
+	}
+	if got := cell("Sets", "M2"); got != "$549.99" {
+		t.Errorf("Expected value formatted as currency, got %q", got)
+	}
+	if got := cell("Sets", "N2"); got != "2024-03-15" {
+		t.Errorf("Expected value date 2024-03-15, got %q", got)
+	}
+	if ok, link, _ := f.GetCellHyperLink("Sets", "L2"); !ok || link != rebrickable {
+		t.Errorf("Expected Rebrickable URL as a hyperlink, got %v %q", ok, link)
+	}
+
+	if got := cell("Statistics", "B6"); got != "$1,219.98" {
+		t.Errorf("Expected total value $1,219.98, got %q", got)
+	}
+	if got := cell("Statistics", "B8"); got != "10276 Colosseum" {
+		t.Errorf("Expected most expensive set 10276 Colosseum, got %q", got)
+	}
+
+	// Series are sorted with sets without one last
+	rows, err := f.GetRows("Series")
+	if err != nil {
+		t.Fatalf("Failed to read series: %v", err)
+	}
+	if len(rows) != 5 || rows[1][0] != "Castle" || rows[2][0] != "Icons" || rows[3][0] != "(No series)" || rows[4][0] != "Total" {
+		t.Fatalf("Unexpected series rows: %v", rows)
+	}
+	if rows[2][3] != "2" || rows[2][4] != "18072" || rows[2][6] != "$1,099.98" {
+		t.Errorf("Expected Icons owned totals times quantity, got %v", rows[2])
+	}
+	if formula, _ := f.GetCellFormula("Series", "E5"); formula != "SUM(E2:E4)" {
+		t.Errorf("Expected a totals formula, got %q", formula)
+	}
+}
+
+func TestLegoSetHandler_ExportXLSX(t *testing.T) {
+	handler, store := newTestHandler(t)
+	seedTestSets(t, store)
+
+	rec := serve(handler.Export, httptest.NewRequest("GET", "/api/lego-sets/export?format=xlsx", nil), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Errorf("Unexpected content type %q", got)
+	}
+
+	f, err := excelize.OpenReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open workbook: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Sets")
+	if err != nil || len(rows) != 4 {
+		t.Errorf("Expected a header and 3 sets, got %d rows (%v)", len(rows), err)
+	}
+}
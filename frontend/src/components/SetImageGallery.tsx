@@ -0,0 +1,177 @@
+import React, { useEffect, useState } from 'react';
+import { imageApi } from '../services/api';
+import { useToast } from '../contexts/ToastContext';
+import type { LegoSet, SetImage, SetImageKind } from '../types';
+
+const kindLabels: Record<SetImageKind, string> = {
+  box_front: 'Box front',
+  box_back: 'Box back',
+  built: 'Built model',
+  minifig: 'Minifig',
+  other: 'Other',
+};
+
+interface SetImageGalleryProps {
+  set: LegoSet;
+}
+
+const SetImageGallery: React.FC<SetImageGalleryProps> = ({ set }) => {
+  const toast = useToast();
+  const [images, setImages] = useState<SetImage[]>([]);
+  const [selectedId, setSelectedId] = useState<string | null>(null);
+  const [caption, setCaption] = useState('');
+  const [kind, setKind] = useState<SetImageKind | ''>('');
+  const [busy, setBusy] = useState(false);
+
+  useEffect(() => {
+    loadImages();
+  }, [set.id]);
+
+  const loadImages = async () => {
+    try {
+      setImages(await imageApi.list(set.id));
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
+  const selected = images.find((image) => image.id === selectedId) ?? images.find((image) => image.isPrimary) ?? images[0];
+
+  const run = async (action: () => Promise<void>, failure: string) => {
+    try {
+      setBusy(true);
+      await action();
+    } catch (err: any) {
+      const errorMessage = err.response?.data?.error || err.message || failure;
+      toast.showError(errorMessage);
+      console.error(err);
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const handleAdd = (e: React.ChangeEvent<HTMLInputElement>) => {
+    const file = e.target.files?.[0];
+    e.target.value = '';
+    if (!file) return;
+
+    run(async () => {
+      const image = await imageApi.add(set.id, file, { caption: caption || undefined, kind: kind || undefined });
+      setImages([...images, image]);
+      setSelectedId(image.id);
+      setCaption('');
+      setKind('');
+    }, 'Failed to add image');
+  };
+
+  const handleMove = (image: SetImage, offset: number) => {
+    const index = images.indexOf(image);
+    const target = index + offset;
+    if (target < 0 || target >= images.length) return;
+
+    const ids = images.map((i) => i.id);
+    [ids[index], ids[target]] = [ids[target], ids[index]];
+    run(async () => setImages(await imageApi.reorder(set.id, ids)), 'Failed to reorder images');
+  };
+
+  const handleSetPrimary = (image: SetImage) => {
+    run(async () => setImages(await imageApi.setPrimary(set.id, image.id)), 'Failed to set primary image');
+  };
+
+  const handleDelete = (image: SetImage) => {
+    if (!window.confirm('Delete this image?')) return;
+
+    run(async () => {
+      await imageApi.delete(set.id, image.id);
+      setSelectedId(null);
+      await loadImages();
+    }, 'Failed to delete image');
+  };
+
+  const buttonClass =
+    'px-2 py-1 text-xs font-medium rounded border border-gray-300 dark:border-gray-600 text-gray-700 dark:text-gray-200 bg-white dark:bg-gray-800 hover:bg-gray-50 dark:hover:bg-gray-700 disabled:opacity-50';
+
+  return (
+    <div className="w-full">
+      {selected ? (
+        <img
+          src={selected.urls?.full ?? `/images/${selected.filename}`}
+          alt={selected.caption || set.title}
+          className="w-full max-h-96 object-contain bg-gray-100 dark:bg-gray-900"
+        />
+      ) : (
+        <div className="w-full h-64 bg-gray-200 dark:bg-gray-700 flex items-center justify-center">
+          <svg className="h-24 w-24 text-gray-400" fill="none" viewBox="0 0 24 24" stroke="currentColor">
+            <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M4 16l4.586-4.586a2 2 0 012.828 0L16 16m-2-2l1.586-1.586a2 2 0 012.828 0L20 14m-6-6h.01M6 20h12a2 2 0 002-2V6a2 2 0 00-2-2H6a2 2 0 00-2 2v12a2 2 0 002 2z" />
+          </svg>
+        </div>
+      )}
+
+      <div className="px-6 pt-4 space-y-3">
+        {selected && (
+          <div className="flex flex-wrap items-center justify-between gap-2">
+            <p className="text-sm text-gray-700 dark:text-gray-300">
+              {selected.kind && <span className="font-medium">{kindLabels[selected.kind]}</span>}
+              {selected.kind && selected.caption && ' · '}
+              {selected.caption}
+              {selected.isPrimary && <span className="ml-2 text-xs text-primary-600 dark:text-primary-400">Primary</span>}
+            </p>
+            <div className="flex gap-1">
+              <button className={buttonClass} disabled={busy} onClick={() => handleMove(selected, -1)} title="Move earlier">←</button>
+              <button className={buttonClass} disabled={busy} onClick={() => handleMove(selected, 1)} title="Move later">→</button>
+              {!selected.isPrimary && (
+                <button className={buttonClass} disabled={busy} onClick={() => handleSetPrimary(selected)}>Make primary</button>
+              )}
+              <button className={buttonClass} disabled={busy} onClick={() => handleDelete(selected)}>Delete</button>
+            </div>
+          </div>
+        )}
+
+        {images.length > 1 && (
+          <div className="flex gap-2 overflow-x-auto">
+            {images.map((image) => (
+              <button
+                key={image.id}
+                onClick={() => setSelectedId(image.id)}
+                className={`flex-shrink-0 rounded border-2 ${image.id === selected?.id ? 'border-primary-500' : 'border-transparent'}`}
+              >
+                <img
+                  src={image.urls?.thumbnail ?? `/images/${image.filename}`}
+                  alt={image.caption || set.title}
+                  className="h-16 w-16 object-cover rounded"
+                />
+              </button>
+            ))}
+          </div>
+        )}
+
+        <div className="flex flex-wrap items-center gap-2">
+          <select
+            value={kind}
+            onChange={(e) => setKind(e.target.value as SetImageKind | '')}
+            className="text-sm rounded border border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-800 text-gray-700 dark:text-gray-200 px-2 py-1"
+          >
+            <option value="">Kind (optional)</option>
+            {Object.entries(kindLabels).map(([value, label]) => (
+              <option key={value} value={value}>{label}</option>
+            ))}
+          </select>
+          <input
+            type="text"
+            value={caption}
+            onChange={(e) => setCaption(e.target.value)}
+            placeholder="Caption (optional)"
+            maxLength={500}
+            className="text-sm rounded border border-gray-300 dark:border-gray-600 bg-white dark:bg-gray-800 text-gray-700 dark:text-gray-200 px-2 py-1 flex-1 min-w-0"
+          />
+          <label className={`${buttonClass} cursor-pointer`}>
+            Add photo
+            <input type="file" accept="image/*" className="hidden" disabled={busy} onChange={handleAdd} />
+          </label>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default SetImageGallery;
@@ -173,7 +173,7 @@ const Dashboard: React.FC = () => {
                 {statistics.mostExpensiveSet.imageFilename && (
                   <div className="w-24 h-24 bg-gray-100 dark:bg-gray-900 rounded flex items-center justify-center flex-shrink-0">
                     <img
-                      src={`/images/${statistics.mostExpensiveSet.imageFilename}`}
+                      src={statistics.mostExpensiveSet.imageUrls?.thumbnail ?? `/images/${statistics.mostExpensiveSet.imageFilename}`}
                       alt={statistics.mostExpensiveSet.title}
                       className="max-w-full max-h-full object-contain rounded"
                     />
@@ -203,7 +203,7 @@ const Dashboard: React.FC = () => {
                 {statistics.largestSet.imageFilename && (
                   <div className="w-24 h-24 bg-gray-100 dark:bg-gray-900 rounded flex items-center justify-center flex-shrink-0">
                     <img
-                      src={`/images/${statistics.largestSet.imageFilename}`}
+                      src={statistics.largestSet.imageUrls?.thumbnail ?? `/images/${statistics.largestSet.imageFilename}`}
                       alt={statistics.largestSet.title}
                       className="max-w-full max-h-full object-contain rounded"
                     />
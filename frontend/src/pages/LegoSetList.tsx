@@ -398,7 +398,9 @@ const LegoSetList: React.FC = () => {
               {set.imageFilename ? (
                 <div className="w-full h-48 bg-gray-100 dark:bg-gray-900 flex items-center justify-center">
                   <img
-                    src={`/images/${set.imageFilename}`}
+                    src={set.imageUrls?.thumbnail ?? `/images/${set.imageFilename}`}
+                    srcSet={set.imageUrls ? `${set.imageUrls.thumbnail} 1x, ${set.imageUrls.medium} 2x` : undefined}
+                    loading="lazy"
                     alt={set.title}
                     className="max-w-full max-h-full object-contain"
                   />
@@ -2,6 +2,7 @@ import React, { useEffect, useState } from 'react';
 import { useParams, useNavigate, useLocation, Link } from 'react-router-dom';
 import { legoSetApi } from '../services/api';
 import { useToast } from '../contexts/ToastContext';
+import SetImageGallery from '../components/SetImageGallery';
 import type { LegoSet } from '../types';
 
 const LegoSetView: React.FC = () => {
@@ -101,22 +102,8 @@ const LegoSetView: React.FC = () => {
 
       {/* Main content card */}
       <div className="bg-white dark:bg-gray-800 shadow rounded-lg overflow-hidden">
-        {/* Image section */}
-        {set.imageFilename ? (
-          <div className="w-full">
-            <img
-              src={`/images/${set.imageFilename}`}
-              alt={set.title}
-              className="w-full max-h-96 object-contain bg-gray-100 dark:bg-gray-900"
-            />
-          </div>
-        ) : (
-          <div className="w-full h-64 bg-gray-200 dark:bg-gray-700 flex items-center justify-center">
-            <svg className="h-24 w-24 text-gray-400" fill="none" viewBox="0 0 24 24" stroke="currentColor">
-              <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M4 16l4.586-4.586a2 2 0 012.828 0L16 16m-2-2l1.586-1.586a2 2 0 012.828 0L20 14m-6-6h.01M6 20h12a2 2 0 002-2V6a2 2 0 00-2-2H6a2 2 0 00-2 2v12a2 2 0 002 2z" />
-            </svg>
-          </div>
-        )}
+        {/* Images */}
+        <SetImageGallery set={set} />
 
         {/* Set details */}
         <div className="p-6 space-y-6">
@@ -1,5 +1,5 @@
 import axios from 'axios';
-import type { LegoSet, CreateLegoSetRequest, UpdateLegoSetRequest, Statistics, ImportResult, FilterOptions } from '../types';
+import type { LegoSet, CreateLegoSetRequest, UpdateLegoSetRequest, Statistics, ImportResult, ImportStrategy, CSVDialectName, Job, RestoreResult, BulkImageResult, ImageURLs, SetImage, SetImageKind, FilterOptions } from '../types';
 
 const API_BASE_URL = '/api';
 
@@ -16,6 +16,7 @@ export const legoSetApi = {
     const params = new URLSearchParams();
     if (filters?.series) params.append('series', filters.series);
     if (filters?.owned !== undefined) params.append('owned', filters.owned.toString());
+    if (filters?.q) params.append('q', filters.q);
     if (filters?.sortBy) params.append('sortBy', filters.sortBy);
     if (filters?.sortOrder) params.append('sortOrder', filters.sortOrder);
 
@@ -55,11 +56,11 @@ export const legoSetApi = {
   },
 
   // Upload an image for a Lego set
-  uploadImage: async (id: string, file: File): Promise<{ imageFilename: string }> => {
+  uploadImage: async (id: string, file: File): Promise<{ imageFilename: string; imageUrls: ImageURLs }> => {
     const formData = new FormData();
     formData.append('image', file);
 
-    const response = await api.post<{ imageFilename: string }>(
+    const response = await api.post<{ imageFilename: string; imageUrls: ImageURLs }>(
       `/lego-sets/${id}/image`,
       formData,
       {
@@ -83,20 +84,191 @@ export const legoSetApi = {
     return response.data;
   },
 
-  // Export to CSV
-  exportCSV: async (): Promise<Blob> => {
+  // Export to CSV, optionally filtered and with only the given fields
+  exportCSV: async (filters?: FilterOptions, fields?: string[], dialect?: CSVDialectName): Promise<Blob> => {
     const response = await api.get('/lego-sets/export', {
+      params: { ...filters, fields: fields?.join(','), dialect },
       responseType: 'blob',
     });
     return response.data;
   },
 
+  // Export the whole catalog as JSON
+  exportJSON: async (): Promise<Blob> => {
+    const response = await api.get('/lego-sets/export', {
+      params: { format: 'json' },
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+
+  // Export as an Excel workbook with statistics and series sheets
+  exportXLSX: async (): Promise<Blob> => {
+    const response = await api.get('/lego-sets/export', {
+      params: { format: 'xlsx' },
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+
+  // Restore a catalog exported as JSON
+  importJSON: async (
+    file: File,
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: Exclude<ImportStrategy, 'merge'> } = {}
+  ): Promise<ImportResult> => {
+    const formData = new FormData();
+    formData.append('file', file);
+
+    const response = await api.post<ImportResult>('/lego-sets/import', formData, {
+      params: { ...options, format: 'json' },
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // Import a Rebrickable set list, or fill in metadata for existing sets
+  // when only the sets.csv dump is given
+  importRebrickable: async (
+    files: { setList?: File; sets?: File; themes?: File },
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: ImportStrategy } = {}
+  ): Promise<ImportResult> => {
+    const formData = new FormData();
+    if (files.setList) formData.append('setlist', files.setList);
+    if (files.sets) formData.append('sets', files.sets);
+    if (files.themes) formData.append('themes', files.themes);
+
+    const response = await api.post<ImportResult>('/lego-sets/import', formData, {
+      params: { ...options, format: 'rebrickable' },
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // Export owned sets as a BrickLink XML inventory, or unowned sets as a
+  // wanted list
+  exportBrickLink: async (list: 'inventory' | 'wanted' = 'inventory'): Promise<Blob> => {
+    const response = await api.get('/lego-sets/export', {
+      params: { format: 'bricklink', list },
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+
+  // Import a BrickLink XML inventory or wanted list, with an optional
+  // Rebrickable dump for titles
+  importBrickLink: async (
+    files: { xml: File; sets?: File; themes?: File },
+    options: { list?: 'inventory' | 'wanted'; dryRun?: boolean; atomic?: boolean; strategy?: ImportStrategy } = {}
+  ): Promise<ImportResult> => {
+    const formData = new FormData();
+    formData.append('xml', files.xml);
+    if (files.sets) formData.append('sets', files.sets);
+    if (files.themes) formData.append('themes', files.themes);
+
+    const response = await api.post<ImportResult>('/lego-sets/import', formData, {
+      params: { ...options, format: 'bricklink' },
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // Import a Brickset collection export
+  importBrickset: async (
+    file: File,
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: ImportStrategy } = {}
+  ): Promise<ImportResult> => {
+    const formData = new FormData();
+    formData.append('csv', file);
+
+    const response = await api.post<ImportResult>('/lego-sets/import', formData, {
+      params: { ...options, format: 'brickset' },
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
   // Import from CSV
-  importCSV: async (file: File): Promise<ImportResult> => {
+  importCSV: async (
+    file: File,
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: ImportStrategy; dialect?: CSVDialectName } = {}
+  ): Promise<ImportResult> => {
     const formData = new FormData();
     formData.append('csv', file);
 
     const response = await api.post<ImportResult>('/lego-sets/import', formData, {
+      params: options,
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+};
+
+export const jobApi = {
+  // Start a background CSV import
+  startImport: async (
+    file: File,
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: ImportStrategy; dialect?: CSVDialectName } = {}
+  ): Promise<Job> => {
+    const formData = new FormData();
+    formData.append('csv', file);
+
+    const response = await api.post<Job>('/jobs/import', formData, {
+      params: options,
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // Get all jobs
+  getAll: async (): Promise<Job[]> => {
+    const response = await api.get<Job[]>('/jobs');
+    return response.data;
+  },
+
+  // Get a single job
+  getById: async (id: string): Promise<Job> => {
+    const response = await api.get<Job>(`/jobs/${id}`);
+    return response.data;
+  },
+
+  // Cancel a job
+  cancel: async (id: string): Promise<Job> => {
+    const response = await api.post<Job>(`/jobs/${id}/cancel`);
+    return response.data;
+  },
+};
+
+export const backupApi = {
+  // Download a backup bundle of every set and image
+  create: async (): Promise<Blob> => {
+    const response = await api.get('/backup', {
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+
+  // Restore sets and images from a backup bundle
+  restore: async (
+    file: File,
+    options: { dryRun?: boolean; atomic?: boolean; strategy?: Exclude<ImportStrategy, 'merge'> } = {}
+  ): Promise<RestoreResult> => {
+    const formData = new FormData();
+    formData.append('backup', file);
+
+    const response = await api.post<RestoreResult>('/backup/restore', formData, {
+      params: options,
       headers: {
         'Content-Type': 'multipart/form-data',
       },
@@ -105,4 +277,77 @@ export const legoSetApi = {
   },
 };
 
+export const imageApi = {
+  // Upload a zip of images named after set numbers
+  bulkUpload: async (file: File, options: { dryRun?: boolean; replace?: boolean } = {}): Promise<BulkImageResult> => {
+    const formData = new FormData();
+    formData.append('zip', file);
+
+    const response = await api.post<BulkImageResult>('/images/bulk', formData, {
+      params: options,
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // List a set's images in display order
+  list: async (setId: string): Promise<SetImage[]> => {
+    const response = await api.get<SetImage[]>(`/lego-sets/${setId}/images`);
+    return response.data;
+  },
+
+  // Add an image to a set
+  add: async (setId: string, file: File, options: { caption?: string; kind?: SetImageKind } = {}): Promise<SetImage> => {
+    const formData = new FormData();
+    formData.append('image', file);
+    if (options.caption) formData.append('caption', options.caption);
+    if (options.kind) formData.append('kind', options.kind);
+
+    const response = await api.post<SetImage>(`/lego-sets/${setId}/images`, formData, {
+      headers: {
+        'Content-Type': 'multipart/form-data',
+      },
+    });
+    return response.data;
+  },
+
+  // Change an image's caption or kind; empty strings clear them
+  update: async (setId: string, imageId: string, data: { caption?: string; kind?: SetImageKind | '' }): Promise<SetImage> => {
+    const response = await api.patch<SetImage>(`/lego-sets/${setId}/images/${imageId}`, data);
+    return response.data;
+  },
+
+  // Put a set's images in a new order, listing every image ID
+  reorder: async (setId: string, imageIds: string[]): Promise<SetImage[]> => {
+    const response = await api.put<SetImage[]>(`/lego-sets/${setId}/images/order`, { imageIds });
+    return response.data;
+  },
+
+  // Make an image the set's primary image
+  setPrimary: async (setId: string, imageId: string): Promise<SetImage[]> => {
+    const response = await api.post<SetImage[]>(`/lego-sets/${setId}/images/${imageId}/primary`);
+    return response.data;
+  },
+
+  // Delete one of a set's images
+  delete: async (setId: string, imageId: string): Promise<void> => {
+    await api.delete(`/lego-sets/${setId}/images/${imageId}`);
+  },
+};
+
+export const reportApi = {
+  // Download a PDF insurance report with a summary page to sign
+  insurance: async (
+    options: { ownedOnly?: boolean; groupBy?: 'series'; preparedBy?: string; date?: string } = {}
+  ): Promise<Blob> => {
+    const response = await api.get('/reports/insurance', {
+      params: options,
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+};
+
 export default api;
@@ -16,11 +16,35 @@ export interface LegoSet {
   valueLastUpdated?: string;
   conditionDescription?: string;
   imageFilename?: string;
+  imageUrls?: ImageURLs;
   notes?: string;
   createdAt: string;
   updatedAt: string;
 }
 
+// URLs of a set's image and its resized variants
+export interface ImageURLs {
+  original: string;
+  thumbnail: string;
+  medium: string;
+  full: string;
+}
+
+export type SetImageKind = 'box_front' | 'box_back' | 'built' | 'minifig' | 'other';
+
+// One of the photos of a set. The primary image is the set's imageFilename.
+export interface SetImage {
+  id: string;
+  setId: string;
+  filename: string;
+  caption?: string;
+  kind?: SetImageKind;
+  sortOrder: number;
+  isPrimary: boolean;
+  createdAt: string;
+  urls?: ImageURLs;
+}
+
 export interface CreateLegoSetRequest {
   setNumber: string;
   alternateSetNumber?: string;
@@ -72,10 +96,102 @@ export interface Statistics {
   newestSet?: LegoSet;
 }
 
+export type ImportAction = 'create' | 'update' | 'skip' | 'error';
+
+export type ImportStrategy = 'skip' | 'overwrite' | 'merge';
+
+// Named CSV dialects; excel-eu uses ; separators, decimal commas and DD.MM.YYYY dates
+export type CSVDialectName = 'default' | 'excel-eu';
+
+export interface FieldWarning {
+  field: string;
+  message: string;
+}
+
+export interface FieldChange {
+  field: string;
+  from: unknown;
+  to: unknown;
+}
+
+export interface ImportRowResult {
+  line: number;
+  id?: string;
+  setNumber: string;
+  title?: string;
+  action: ImportAction;
+  reason?: string;
+  warnings?: FieldWarning[];
+  changes?: FieldChange[];
+}
+
 export interface ImportResult {
+  dryRun: boolean;
+  atomic: boolean;
+  rolledBack: boolean;
+  strategy: ImportStrategy;
   imported: number;
+  updated: number;
   skipped: number;
+  failed: number;
+  warnings: number;
+  unmappedColumns?: string[];
   errors: string[];
+  rows: ImportRowResult[];
+}
+
+export type JobStatus = 'queued' | 'running' | 'completed' | 'failed' | 'cancelled';
+
+export interface Job {
+  id: string;
+  type: string;
+  status: JobStatus;
+  filename?: string;
+  bytesTotal: number;
+  bytesRead: number;
+  progress: ImportResult;
+  error?: string;
+  createdAt: string;
+  startedAt?: string;
+  finishedAt?: string;
+}
+
+export interface ImageReference {
+  setId: string;
+  setNumber: string;
+  filename: string;
+}
+
+export interface RestoreResult {
+  sets: ImportResult;
+  imagesRestored: number;
+  imagesUnchanged: number;
+  imagesKept: number;
+  danglingImages: ImageReference[];
+  unreferencedImages: string[];
+  errors: string[];
+}
+
+export interface BulkImageMatch {
+  file: string;
+  setId: string;
+  setNumber: string;
+  imageFilename: string;
+  replaced?: string;
+  added?: boolean;
+}
+
+export interface BulkImageRejection {
+  file: string;
+  setNumber?: string;
+  reason: string;
+}
+
+export interface BulkImageResult {
+  dryRun: boolean;
+  matched: BulkImageMatch[];
+  unmatched: string[];
+  rejected: BulkImageRejection[];
 }
 
 export type SortField = 'title' | 'set_number' | 'release_year' | 'approximate_value' | 'num_parts' | 'created_at';
@@ -84,6 +200,7 @@ export type SortOrder = 'ASC' | 'DESC';
 export interface FilterOptions {
   series?: string;
   owned?: boolean;
+  q?: string;
   sortBy?: SortField;
   sortOrder?: SortOrder;
 }
@@ -0,0 +1,21 @@
+#!/bin/bash
+# Builds the frontend and embeds it, together with the SQL migrations,
+# into a single lego-catalog server binary
+
+set -e
+
+ROOT_DIR="$(cd "$(dirname "$0")/.." && pwd)"
+WEB_DIST="$ROOT_DIR/backend/internal/web/dist"
+OUTPUT="${1:-$ROOT_DIR/backend/lego-catalog}"
+
+echo "📦 Building frontend..."
+(cd "$ROOT_DIR/frontend" && npm ci && npm run build)
+
+echo "📋 Copying frontend build into the server..."
+find "$WEB_DIST" -mindepth 1 ! -name .gitkeep -delete
+cp -R "$ROOT_DIR/frontend/dist/." "$WEB_DIST/"
+
+echo "🔨 Building server binary..."
+(cd "$ROOT_DIR/backend" && go build -o "$OUTPUT" ./cmd/server)
+
+echo "✅ Built $OUTPUT"